@@ -0,0 +1,170 @@
+// idgen-admin workID运维工具，查看redis中workID的占用情况，强制释放残留的workID，预留或取消预留workID。
+//
+//	idgen-admin -addr 127.0.0.1:6379 -app qw-scrm list
+//	idgen-admin -app qw-scrm -mod default_mod occupancy
+//	idgen-admin -app qw-scrm release 12
+//	idgen-admin -app qw-scrm reserve 100 "migration"
+//	idgen-admin -app qw-scrm unreserve 100
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/goredis/v9"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const usage = `usage: idgen-admin [flags] <command> [args]
+
+commands:
+  list                     列出所有被占用的workID
+  occupancy                统计workID占用情况
+  release <workID>         强制释放workID，原持有者续约时会发现租约丢失
+  reserve <workID> [note]  预留空闲的workID，预留后不会被实例占用
+  unreserve <workID>       取消预留
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "idgen-admin:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("idgen-admin", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	var (
+		addr     = fs.String("addr", "127.0.0.1:6379", "redis地址，集群或哨兵使用逗号分隔多个地址")
+		master   = fs.String("master", "", "哨兵模式的master名称")
+		password = fs.String("password", os.Getenv("REDIS_PASSWORD"), "redis密码，默认读取环境变量 REDIS_PASSWORD")
+		db       = fs.Int("db", 0, "redis数据库")
+		app      = fs.String("app", "", "应用名")
+		mod      = fs.String("mod", "", "模块名，默认 default_mod")
+		prefix   = fs.String("prefix", "workid:", "key前缀")
+		max      = fs.Int("max", 1024, "workID上限")
+		hashTag  = fs.Bool("hashtag", false, "key使用 hash tag，与服务的 redisworker.WithHashTag 保持一致")
+		asJSON   = fs.Bool("json", false, "以JSON输出")
+		timeout  = fs.Duration("timeout", time.Second*10, "超时时间")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *app == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("app and command are required")
+	}
+
+	client := redis.NewUniversalClient(
+		&redis.UniversalOptions{Addrs: strings.Split(*addr, ","), MasterName: *master, Password: *password, DB: *db},
+	)
+	defer client.Close()
+	opts := []redisworker.Option{redisworker.WithKeyPrefix(*prefix), redisworker.WithMaxWorkID(*max)}
+	if *hashTag {
+		opts = append(opts, redisworker.WithHashTag())
+	}
+	admin := redisworker.NewAdmin(*app, goredis.NewPool(client), opts...)
+	admin.SetModName(*mod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "list":
+		leases, err := admin.List(ctx)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return writeJSON(out, leases)
+		}
+		return writeLeases(out, leases)
+	case "occupancy":
+		o, err := admin.Occupancy(ctx)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return writeJSON(out, o)
+		}
+		_, err = fmt.Fprintf(out, "total %d, held %d, reserved %d, free %d\n", o.Total, o.Held, o.Reserved, o.Free)
+		return err
+	case "release", "reserve", "unreserve":
+		if len(rest) == 0 {
+			return errors.Errorf("%s: workID is required", cmd)
+		}
+		workID, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return errors.Wrapf(err, "%s: invalid workID %q", cmd, rest[0])
+		}
+		var ok bool
+		switch cmd {
+		case "release":
+			ok, err = admin.ForceRelease(ctx, workID)
+		case "reserve":
+			note := ""
+			if len(rest) > 1 {
+				note = rest[1]
+			}
+			ok, err = admin.Reserve(ctx, workID, note)
+		default:
+			ok, err = admin.Unreserve(ctx, workID)
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Errorf("%s: workID %d unchanged", cmd, workID)
+		}
+		_, err = fmt.Fprintf(out, "%s %d ok\n", cmd, workID)
+		return err
+	default:
+		fs.Usage()
+		return errors.Errorf("unknown command %q", cmd)
+	}
+}
+
+// writeLeases 以表格输出租约
+func writeLeases(out io.Writer, leases []workid.LeaseInfo) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKID\tHOSTNAME\tPID\tSTARTED\tLAST HEARTBEAT\tTTL\tVERSION\tOWNER")
+	for _, lease := range leases {
+		fmt.Fprintf(
+			w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			lease.WorkID, lease.Hostname, lease.PID, formatTime(lease.StartedAt), formatTime(lease.LastHeartbeat),
+			lease.TTL.Round(time.Millisecond), lease.Version, lease.Owner,
+		)
+	}
+	return w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
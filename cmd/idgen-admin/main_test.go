@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gosharedlib/idgenerator/v2/internal/testredis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/goredis/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+func Test_run_args(t *testing.T) {
+	addr, password := testredis.Server(t)
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "test_01",
+			args:    []string{"-addr", addr, "-password", password, "list"},
+			wantErr: "app and command are required",
+		},
+		{
+			name:    "test_02",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test"},
+			wantErr: "app and command are required",
+		},
+		{
+			name:    "test_03",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "-max", "x", "list"},
+			wantErr: "invalid value",
+		},
+		{
+			name:    "test_04",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "stat"},
+			wantErr: `unknown command "stat"`,
+		},
+		{
+			name:    "test_05",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "release"},
+			wantErr: "release: workID is required",
+		},
+		{
+			name:    "test_06",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "reserve", "x"},
+			wantErr: `reserve: invalid workID "x"`,
+		},
+		{
+			name:    "test_07",
+			args:    []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "-max", "4", "unreserve", "4"},
+			wantErr: redisworker.ErrWorkIDOutOfRange.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var out bytes.Buffer
+				err := run(tt.args, &out)
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("run() error = %v, want %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func Test_run_commands(t *testing.T) {
+	addr, password := testredis.Server(t)
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: password})
+	t.Cleanup(func() { _ = client.Close() })
+	worker := redisworker.NewRedisWorker("idgen-admin-test", goredis.NewPool(client), redisworker.WithMaxWorkID(4))
+	lease := worker.Get(context.TODO())
+	if _, err := lease.Acquire(context.TODO()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	t.Cleanup(func() { _ = lease.Release(context.TODO()) })
+	workID, _ := lease.ID()
+	id, reserved := strconv.Itoa(workID), strconv.Itoa((workID+1)%4)
+
+	flags := []string{"-addr", addr, "-password", password, "-app", "idgen-admin-test", "-max", "4"}
+	// 按顺序执行，后面的命令依赖前面命令的结果
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "test_01",
+			args: []string{"list"},
+			want: "WORKID",
+		},
+		{
+			name: "test_02",
+			args: []string{"-json", "list"},
+			want: `"workId": ` + id,
+		},
+		{
+			name: "test_03",
+			args: []string{"occupancy"},
+			want: "total 4, held 1, reserved 0, free 3\n",
+		},
+		{
+			name: "test_04",
+			args: []string{"reserve", reserved, "migration"},
+			want: "reserve " + reserved + " ok\n",
+		},
+		{
+			name:    "test_05",
+			args:    []string{"reserve", id},
+			wantErr: true,
+		},
+		{
+			name: "test_06",
+			args: []string{"-json", "occupancy"},
+			want: `"reserved": 1`,
+		},
+		{
+			name: "test_07",
+			args: []string{"unreserve", reserved},
+			want: "unreserve " + reserved + " ok\n",
+		},
+		{
+			name: "test_08",
+			args: []string{"release", id},
+			want: "release " + id + " ok\n",
+		},
+		{
+			name:    "test_09",
+			args:    []string{"release", id},
+			wantErr: true,
+		},
+		{
+			name: "test_10",
+			args: []string{"occupancy"},
+			want: "total 4, held 0, reserved 0, free 4\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var out bytes.Buffer
+				err := run(append(append([]string{}, flags...), tt.args...), &out)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if !strings.Contains(out.String(), tt.want) {
+					t.Errorf("run() output = %q, want %q", out.String(), tt.want)
+				}
+			},
+		)
+	}
+}
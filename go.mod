@@ -1,8 +1,9 @@
-module github.com/gosharedlib/idgenerator
+module github.com/gosharedlib/idgenerator/v2
 
 go 1.21.5
 
 require (
+	github.com/alicebob/miniredis/v2 v2.31.1
 	github.com/bwmarrin/snowflake v0.3.0
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/go-redis/redis/v7 v7.4.1
@@ -11,9 +12,13 @@ require (
 	github.com/gomodule/redigo v1.9.2
 	github.com/pkg/errors v0.9.1
 	github.com/redis/go-redis/v9 v9.5.1
+	github.com/yuin/gopher-lua v1.1.1
 )
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sys v0.22.0 // indirect
 )
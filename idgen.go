@@ -2,12 +2,12 @@ package idgenerator
 
 import (
 	guid "github.com/gofrs/uuid"
-	"github.com/gosharedlib/idgenerator/md5"
-	"github.com/gosharedlib/idgenerator/snowflake"
-	"github.com/gosharedlib/idgenerator/uuid"
-	"github.com/gosharedlib/idgenerator/workid"
-	"github.com/gosharedlib/idgenerator/workid/redisworker"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/md5"
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/uuid"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 )
 
 var (
@@ -17,9 +17,13 @@ var (
 // IDGenerator 代表 Key 生成器.
 type IDGenerator interface {
 	// NewRedisWorker 基于redis的workerID生成器
-	NewRedisWorker(appName string, pool redis.Pool) workid.Worker
-	// NewSnowflakeGenerator 雪花算法生成器
+	NewRedisWorker(appName string, pool redis.Pool, opts ...redisworker.Option) workid.Worker
+	// NewQuorumWorker 基于多个独立redis节点多数派的workerID生成器
+	NewQuorumWorker(appName string, pools []redis.Pool, opts ...redisworker.Option) workid.Worker
+	// NewSnowflakeGenerator 雪花算法生成器，创建失败时生成ID返回错误
 	NewSnowflakeGenerator(worker workid.Conn, epoch ...int64) snowflake.Generator
+	// NewGenerator 雪花算法生成器，创建失败时直接返回错误
+	NewGenerator(worker workid.Conn, epoch ...int64) (snowflake.Generator, error)
 	// NewUUIDV1Generator UUID V1
 	NewUUIDV1Generator() uuid.Generator
 	// NewUUIDV2Generator UUID V2，由于安全缺陷，上游依赖已移除 V2 实现
@@ -41,14 +45,24 @@ func newDefaultGenerator() IDGenerator {
 	return &idGenerator{}
 }
 
-func NewRedisWorker(appName string, pool redis.Pool) workid.Worker {
-	return global.NewRedisWorker(appName, pool)
+func NewRedisWorker(appName string, pool redis.Pool, opts ...redisworker.Option) workid.Worker {
+	return global.NewRedisWorker(appName, pool, opts...)
+}
+
+func NewQuorumWorker(appName string, pools []redis.Pool, opts ...redisworker.Option) workid.Worker {
+	return global.NewQuorumWorker(appName, pools, opts...)
 }
 
 func NewSnowflakeGenerator(worker workid.Conn, epoch ...int64) snowflake.Generator {
 	return global.NewSnowflakeGenerator(worker, epoch...)
 }
 
+// NewGenerator 创建雪花算法生成器，获取workID失败或workID超出节点范围时返回错误，
+// 需要在启动时检查错误的应使用该方法而不是 NewSnowflakeGenerator
+func NewGenerator(worker workid.Conn, epoch ...int64) (snowflake.Generator, error) {
+	return global.NewGenerator(worker, epoch...)
+}
+
 func NewUUIDV1Generator() uuid.Generator {
 	return global.NewUUIDV1Generator()
 }
@@ -74,14 +88,22 @@ func NewMD5Generator(str string) md5.Generator {
 	return global.NewMD5Generator(str)
 }
 
-func (g *idGenerator) NewRedisWorker(appName string, pool redis.Pool) workid.Worker {
-	return redisworker.NewRedisWorker(appName, pool)
+func (g *idGenerator) NewRedisWorker(appName string, pool redis.Pool, opts ...redisworker.Option) workid.Worker {
+	return redisworker.NewRedisWorker(appName, pool, opts...)
+}
+
+func (g *idGenerator) NewQuorumWorker(appName string, pools []redis.Pool, opts ...redisworker.Option) workid.Worker {
+	return redisworker.NewQuorumWorker(appName, pools, opts...)
 }
 
 func (g *idGenerator) NewSnowflakeGenerator(worker workid.Conn, epoch ...int64) snowflake.Generator {
 	return snowflake.NewSnowflakeGenerator(worker, epoch...)
 }
 
+func (g *idGenerator) NewGenerator(worker workid.Conn, epoch ...int64) (snowflake.Generator, error) {
+	return snowflake.NewGenerator(worker, epoch...)
+}
+
 func (g *idGenerator) NewUUIDV1Generator() uuid.Generator {
 	return uuid.NewV1Generator()
 }
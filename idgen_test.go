@@ -5,12 +5,10 @@ import (
 	"reflect"
 	"testing"
 
-	goRedis "github.com/go-redis/redis"
-	"github.com/gosharedlib/idgenerator/snowflake"
-	"github.com/gosharedlib/idgenerator/workid"
-	"github.com/gosharedlib/idgenerator/workid/redisworker"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis/goredis"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
 )
 
 func TestNewRedisWorker(t *testing.T) {
@@ -18,13 +16,7 @@ func TestNewRedisWorker(t *testing.T) {
 		appName string
 		pool    redis.Pool
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
+	pool := redistest.NewPool()
 	tests := []struct {
 		name string
 		args args
@@ -57,19 +49,11 @@ func TestNewSnowflakeGenerator(t *testing.T) {
 		worker workid.Conn
 		epoch  []int64
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
+	pool := redistest.NewPool()
 	worker := NewRedisWorker("test01", pool).Get(context.TODO())
-	worker1 := NewRedisWorker("test02", pool).Get(context.TODO())
 	tests := []struct {
 		name string
 		args args
-		want snowflake.Generator
 	}{
 		{
 			name: "test01",
@@ -77,18 +61,63 @@ func TestNewSnowflakeGenerator(t *testing.T) {
 				worker: worker,
 				epoch:  []int64{},
 			},
-			want: snowflake.NewSnowflakeGenerator(worker1),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(
 			tt.name, func(t *testing.T) {
 				got := NewSnowflakeGenerator(tt.args.worker, tt.args.epoch...)
-				if !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("NewSnowflakeGenerator() = %v, want %v", got, tt.want)
+				id, err := got.GenID()
+				if err != nil || id == "" {
+					t.Errorf("GenID() = %v, err %v", id, err)
+				}
+				intID, err := got.GenIntID()
+				if err != nil || intID <= 0 {
+					t.Errorf("GenIntID() = %v, err %v", intID, err)
+				}
+			},
+		)
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	type args struct {
+		worker workid.Conn
+		epoch  []int64
+	}
+	pool := redistest.NewPool()
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "test01",
+			args: args{
+				worker: NewRedisWorker("test01", pool).Get(context.TODO()),
+			},
+		},
+		{
+			name: "test02",
+			args: args{
+				worker: NewRedisWorker("test02", pool, redisworker.WithKeyPrefix("")).Get(context.TODO()),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got, err := NewGenerator(tt.args.worker, tt.args.epoch...)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("NewGenerator() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if id, err := got.GenIntID(); err != nil || id <= 0 {
+					t.Errorf("GenIntID() = %v, err %v", id, err)
 				}
-				t.Log(got.GenID())
-				t.Log(got.GenIntID())
 			},
 		)
 	}
@@ -0,0 +1,18 @@
+// Package testredis 测试用的redis服务端，只在测试中使用，不进入公开的 redistest 包，使用方不会因此依赖 miniredis
+package testredis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Server 启动用于测试客户端适配器的redis服务端，返回地址与密码。设置环境变量 REDIS_ADDR 时使用该地址与 REDIS_PASSWORD，
+// 否则启动内存redis(miniredis)，测试结束后关闭
+func Server(t testing.TB) (addr, password string) {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr, os.Getenv("REDIS_PASSWORD")
+	}
+	return miniredis.RunT(t).Addr(), ""
+}
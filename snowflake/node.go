@@ -0,0 +1,119 @@
+package snowflake
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/pkg/errors"
+)
+
+// maxWait 时钟回拨或当前毫秒的序列号用尽时，等待本地时钟前进的最长时间
+const maxWait = time.Millisecond * 10
+
+var (
+	// processStart 单调时钟的起点
+	processStart = time.Now()
+	// wallClock 墙上时间(Unix毫秒)，只在创建节点时读取，测试时替换
+	wallClock = func() int64 {
+		return time.Now().UnixMilli()
+	}
+	// monotonic 单调时钟读数，不受NTP等调整墙上时间的影响，测试时替换
+	monotonic = func() time.Duration {
+		return time.Since(processStart)
+	}
+)
+
+// node 雪花算法节点，与 github.com/bwmarrin/snowflake 的位分配相同，生成的ID可以用 snowflake.ID 解析。
+// 时间戳为创建节点时的墙上时间加上之后单调时钟经过的时间，运行期间墙上时间被调整不影响生成ID。
+// 只有重新创建节点(workID切换)时才再次读取墙上时间，此时早于上一个节点最近一次生成ID的时间戳即为时钟回拨，
+// 最多等待 maxWait，超过后返回错误，不会一直等待
+type node struct {
+	mu    sync.Mutex
+	epoch int64         // 起始时间(Unix毫秒)
+	base  int64         // 创建节点时的时间戳，相对epoch
+	start time.Duration // 创建节点时的单调时钟读数
+	id    int64         // 节点号，即workID
+	time  int64         // 最近一次生成ID的时间戳，相对epoch
+	step  int64         // 当前毫秒内的序列号
+}
+
+// newNode workID超出节点位数允许的范围时返回 ErrInvalidNodeID。
+// last为上一个节点最近一次生成ID的时间戳(相对epoch)，新节点生成的ID不早于该时间戳，没有上一个节点时为0
+func newNode(workID int, epoch int64, last int64) (*node, error) {
+	if workID < 0 || workID > MaxNodeID() {
+		return nil, errors.Wrapf(ErrInvalidNodeID, "workid %d out of range [0, %d]", workID, MaxNodeID())
+	}
+	return &node{epoch: epoch, base: wallClock() - epoch, start: monotonic(), id: int64(workID), time: last}, nil
+}
+
+// generate 生成ID。时钟回拨超过 maxWait 时返回 ErrClockMovedBackwards，
+// 当前毫秒的序列号用尽且 maxWait 内时钟没有前进时返回 ErrSequenceExhausted
+func (n *node) generate() (snowflake.ID, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t := n.now()
+	if t < n.time {
+		// 回拨较小时等待时钟追上最近一次生成ID的时间戳
+		var ok bool
+		if n.time-t <= maxWait.Milliseconds() {
+			t, ok = n.waitUntil(n.time)
+		}
+		if !ok {
+			return 0, errors.Wrapf(ErrClockMovedBackwards, "clock moved backwards by %dms", n.time-t)
+		}
+	}
+	if t == n.time {
+		n.step = (n.step + 1) & stepMask()
+		if n.step == 0 {
+			var ok bool
+			if t, ok = n.waitUntil(n.time + 1); !ok {
+				// 保持用尽状态，下一次调用仍需等待下一毫秒，避免复用已生成的序列号
+				n.step = stepMask()
+				return 0, errors.Wrapf(ErrSequenceExhausted, "sequence of %d exhausted", n.time+n.epoch)
+			}
+		}
+	} else {
+		n.step = 0
+	}
+	n.time = t
+	return snowflake.ID(t<<(snowflake.NodeBits+snowflake.StepBits) | n.id<<snowflake.StepBits | n.step), nil
+}
+
+// now 当前时间戳，相对epoch
+func (n *node) now() int64 {
+	return n.base + (monotonic() - n.start).Milliseconds()
+}
+
+// last 最近一次生成ID的时间戳，相对epoch
+func (n *node) last() int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.time
+}
+
+// unixMilli ID的时间戳(Unix毫秒)，按节点的epoch计算，不依赖 snowflake.Epoch
+func (n *node) unixMilli(id snowflake.ID) int64 {
+	return id.Int64()>>(snowflake.NodeBits+snowflake.StepBits) + n.epoch
+}
+
+// waitUntil 等待本地时钟到达target(相对epoch)，超过 maxWait 仍未到达时返回false
+func (n *node) waitUntil(target int64) (int64, bool) {
+	deadline := time.Now().Add(maxWait)
+	for {
+		t := n.now()
+		if t >= target {
+			return t, true
+		}
+		if !time.Now().Before(deadline) {
+			return t, false
+		}
+		time.Sleep(time.Millisecond / 10)
+	}
+}
+
+// stepMask 序列号掩码
+func stepMask() int64 {
+	return -1 ^ (-1 << snowflake.StepBits)
+}
@@ -0,0 +1,128 @@
+package snowflake
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// setClock 替换墙上时间与单调时钟，测试结束后恢复
+func setClock(t *testing.T, wall func() int64, mono func() time.Duration) {
+	originWall, originMono := wallClock, monotonic
+	wallClock, monotonic = wall, mono
+	t.Cleanup(
+		func() {
+			wallClock, monotonic = originWall, originMono
+		},
+	)
+}
+
+func TestNode_clockMovedBackwards(t *testing.T) {
+	tests := []struct {
+		name     string
+		backward int64 // 墙上时间回拨的毫秒数
+		reanchor bool  // 回拨后重新创建节点
+		recover  bool  // 等待期间时钟追上
+		wantErr  error
+	}{
+		{
+			// 运行期间墙上时间回拨不影响生成ID
+			name:     "test_01",
+			backward: 100,
+		},
+		{
+			name:     "test_02",
+			backward: 100,
+			reanchor: true,
+			wantErr:  ErrClockMovedBackwards,
+		},
+		{
+			// 回拨较小，等待后时钟仍未追上
+			name:     "test_03",
+			backward: 2,
+			reanchor: true,
+			wantErr:  ErrClockMovedBackwards,
+		},
+		{
+			name:     "test_04",
+			backward: 2,
+			reanchor: true,
+			recover:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				ms, mono := int64(defaultEpoch+1000), time.Duration(0)
+				setClock(
+					t, func() int64 {
+						return ms
+					}, func() time.Duration {
+						if tt.recover {
+							mono += time.Millisecond
+						}
+						return mono
+					},
+				)
+				n, err := newNode(1, defaultEpoch, 0)
+				if err != nil {
+					t.Fatalf("newNode() error = %v", err)
+				}
+				first, err := n.generate()
+				if err != nil {
+					t.Fatalf("generate() error = %v", err)
+				}
+				ms -= tt.backward
+				if tt.reanchor {
+					if n, err = newNode(1, defaultEpoch, n.last()); err != nil {
+						t.Fatalf("newNode() error = %v", err)
+					}
+				}
+				id, err := n.generate()
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("generate() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && id <= first {
+					t.Errorf("generate() = %v, want greater than %v", id, first)
+				}
+			},
+		)
+	}
+}
+
+func TestNode_sequenceExhausted(t *testing.T) {
+	ms, mono := int64(defaultEpoch+1000), time.Duration(0)
+	setClock(
+		t, func() int64 {
+			return ms
+		}, func() time.Duration {
+			return mono
+		},
+	)
+	n, err := newNode(1, defaultEpoch, 0)
+	if err != nil {
+		t.Fatalf("newNode() error = %v", err)
+	}
+	var last int64
+	for i := int64(0); i <= stepMask(); i++ {
+		id, err := n.generate()
+		if err != nil {
+			t.Fatalf("generate() error = %v", err)
+		}
+		if id.Int64() <= last || id.Step() != i || id.Node() != 1 || id.Int64()>>22 != ms-defaultEpoch {
+			t.Fatalf("generate() = %v, step %v, node %v", id, id.Step(), id.Node())
+		}
+		last = id.Int64()
+	}
+	// 当前毫秒的序列号用尽且时钟没有前进
+	for i := 0; i < 2; i++ {
+		if _, err := n.generate(); !errors.Is(err, ErrSequenceExhausted) {
+			t.Fatalf("generate() error = %v, want %v", err, ErrSequenceExhausted)
+		}
+	}
+	mono += time.Millisecond
+	id, err := n.generate()
+	if err != nil || id.Int64() <= last || id.Step() != 0 {
+		t.Errorf("generate() = %v, %v, want step 0 of next millisecond", id, err)
+	}
+}
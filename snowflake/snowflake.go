@@ -2,50 +2,150 @@ package snowflake
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/bwmarrin/snowflake"
-	"github.com/gosharedlib/idgenerator/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/pkg/errors"
 )
 
 const defaultEpoch = 1648656000000
 
+// ErrClockMovedBackwards 本地时钟回拨超过允许等待的时间，继续生成可能与之前的ID重复
+var ErrClockMovedBackwards = errors.New("时钟回拨")
+
+// ErrSequenceExhausted 当前毫秒的序列号已用尽，且本地时钟没有前进到下一毫秒
+var ErrSequenceExhausted = errors.New("序列号已用尽")
+
+// ErrInvalidNodeID workID超出雪花算法节点位数允许的范围
+var ErrInvalidNodeID = errors.New("workid超出节点范围")
+
 type snowflakeIDGenerator struct {
-	node *snowflake.Node
+	node     atomic.Pointer[node] // 租约丢失后重新占用到不同的workID时切换，切换失败时为空
+	worker   workid.Conn
+	observer workid.TimestampObserver // worker实现 workid.TimestampObserver 时不为空
 }
 
 // Generator ID生成器
 type Generator interface {
-	// GenID 生成字符串 Key.
-	GenID() string
-	// GenIntID 生成整型 Key.
-	GenIntID() int64
+	// GenID 生成字符串 Key. workID租约丢失或已释放后返回 workid.ErrLeaseLost，
+	// 时钟回拨返回 ErrClockMovedBackwards，当前毫秒的序列号用尽且时钟没有前进时返回 ErrSequenceExhausted
+	GenID() (string, error)
+	// GenIntID 生成整型 Key. 错误与 GenID 相同
+	GenIntID() (int64, error)
 }
 
+// MaxNodeID 当前节点位数下允许的最大workID
+func MaxNodeID() int {
+	return int(-1 ^ (-1 << snowflake.NodeBits))
+}
+
+// NewSnowflakeGenerator 使用worker占用的workID创建生成器。worker可以直接传入 workid.Worker.Get 返回的租约，
+// 租约已占用workID时使用持有的workID，不会再占用新的workID。
+// 获取workID失败或workID超出节点范围时不会panic，返回的生成器在每次生成ID时返回该错误，需要在创建时处理错误的使用 NewGenerator
 func NewSnowflakeGenerator(worker workid.Conn, epoch ...int64) Generator {
-	snowflake.Epoch = defaultEpoch
+	g, err := NewGenerator(worker, epoch...)
+	if err != nil {
+		return failedGenerator{err: err}
+	}
+	return g
+}
+
+// NewGenerator 使用worker占用的workID创建生成器，是创建时检查错误的方式：获取workID失败时返回 workid.ErrNoWorkIDAvailable 等错误，
+// workID超出节点范围时返回 ErrInvalidNodeID。epoch为起始时间(Unix毫秒)，只对当前生成器生效，
+// 不修改 github.com/bwmarrin/snowflake 的全局 Epoch，解析ID中的时间需使用相同的epoch
+func NewGenerator(worker workid.Conn, epoch ...int64) (Generator, error) {
+	start := int64(defaultEpoch)
 	if len(epoch) > 0 {
-		snowflake.Epoch = epoch[0]
+		start = epoch[0]
 	}
 
-	workID, err := worker.GetWorkID(context.Background())
+	workID, err := acquire(worker)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	n, err := newNode(workID, start, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	observer, _ := worker.(workid.TimestampObserver)
+	g := &snowflakeIDGenerator{worker: worker, observer: observer}
+	g.node.Store(n)
+	if notifier, ok := worker.(workid.WorkIDNotifier); ok {
+		notifier.OnWorkIDChange(
+			func(workID int) {
+				// 超出节点范围时节点为空，生成ID返回 workid.ErrLeaseLost；新节点的时间戳不早于切换前最近一次生成的ID
+				var last int64
+				if previous := g.node.Load(); previous != nil {
+					last = previous.last()
+				}
+				n, _ := newNode(workID, start, last)
+				g.node.Store(n)
+			},
+		)
+	}
+	return g, nil
+}
+
+// acquire 获取workID，租约通过 Acquire 获取
+func acquire(worker workid.Conn) (int, error) {
+	if lease, ok := worker.(workid.Lease); ok {
+		return lease.Acquire(context.Background())
 	}
-	node, err := snowflake.NewNode(int64(workID))
+	return worker.GetWorkID(context.Background())
+}
+
+func (g *snowflakeIDGenerator) GenID() (string, error) {
+	id, err := g.generate()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
+	return id.String(), nil
+}
+
+func (g *snowflakeIDGenerator) GenIntID() (int64, error) {
+	id, err := g.generate()
 	if err != nil {
-		panic(err)
+		return 0, err
+	}
+	return id.Int64(), nil
+}
+
+// generate 生成ID。生成之后再检查租约，保证ID的时间戳不晚于租约到期时间，避免GC停顿等情况下产生重复ID。
+// 检查租约之后workID已切换时，使用新的workID重新生成
+func (g *snowflakeIDGenerator) generate() (snowflake.ID, error) {
+	for {
+		n := g.node.Load()
+		if n == nil {
+			return 0, errors.WithStack(workid.ErrLeaseLost)
+		}
+		id, err := n.generate()
+		if err != nil {
+			return 0, err
+		}
+		if state := g.worker.LeaseState(); state != workid.LeaseHeld && state != workid.LeaseAtRisk {
+			return 0, errors.WithStack(workid.ErrLeaseLost)
+		}
+		if g.node.Load() != n {
+			continue
+		}
+		if g.observer != nil {
+			g.observer.ObserveTimestamp(n.unixMilli(id))
+		}
+		return id, nil
 	}
+}
 
-	return &snowflakeIDGenerator{node: node}
+// failedGenerator 创建失败的生成器，生成ID时返回创建时的错误
+type failedGenerator struct {
+	err error
 }
 
-func (g snowflakeIDGenerator) GenID() string {
-	return g.node.Generate().String()
+func (g failedGenerator) GenID() (string, error) {
+	return "", g.err
 }
 
-func (g snowflakeIDGenerator) GenIntID() int64 {
-	return g.node.Generate().Int64()
+func (g failedGenerator) GenIntID() (int64, error) {
+	return 0, g.err
 }
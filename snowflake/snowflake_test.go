@@ -0,0 +1,262 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+)
+
+// stubConn 固定workID与租约状态的连接
+type stubConn struct {
+	workID int
+	state  workid.LeaseState
+	err    error // 获取workID返回的错误
+}
+
+func (c *stubConn) GetWorkID(_ context.Context) (int, error) {
+	return c.workID, c.err
+}
+
+func (c *stubConn) CleanWorkID(_ context.Context) error {
+	return nil
+}
+
+func (c *stubConn) LeaseState() workid.LeaseState {
+	return c.state
+}
+
+func (c *stubConn) OnLeaseStateChange(_ workid.LeaseListener) {}
+
+func (c *stubConn) Health(_ context.Context) (workid.Health, error) {
+	return workid.Health{WorkID: c.workID, State: c.state}, nil
+}
+
+func (c *stubConn) Release(_ context.Context) error {
+	c.state = workid.LeaseNone
+	return nil
+}
+
+// notifierConn workID变化时通知生成器的连接
+type notifierConn struct {
+	stubConn
+	onChange func(workID int)
+}
+
+func (c *notifierConn) OnWorkIDChange(fn func(workID int)) {
+	c.onChange = fn
+}
+
+// stubLease 记录 Acquire 调用次数的租约，GetWorkID 每次返回不同的workID
+type stubLease struct {
+	stubConn
+	acquired int
+}
+
+func (c *stubLease) GetWorkID(_ context.Context) (int, error) {
+	c.workID++
+	return c.workID, nil
+}
+
+func (c *stubLease) Acquire(_ context.Context) (int, error) {
+	c.acquired++
+	return c.stubConn.workID, nil
+}
+
+func (c *stubLease) ID() (int, bool) {
+	return c.stubConn.workID, c.acquired > 0
+}
+
+func (c *stubLease) Renew(_ context.Context) error {
+	return nil
+}
+
+func TestGenerator_GenID(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   workid.LeaseState
+		wantErr error
+	}{
+		{
+			name:  "test_01",
+			state: workid.LeaseHeld,
+		},
+		{
+			name:  "test_02",
+			state: workid.LeaseAtRisk,
+		},
+		{
+			name:    "test_03",
+			state:   workid.LeaseLost,
+			wantErr: workid.ErrLeaseLost,
+		},
+		{
+			name:    "test_04",
+			state:   workid.LeaseNone,
+			wantErr: workid.ErrLeaseLost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				g := NewSnowflakeGenerator(&stubConn{workID: 1, state: tt.state})
+				id, err := g.GenID()
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GenID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if (id == "") != (tt.wantErr != nil) {
+					t.Errorf("GenID() id = %v", id)
+				}
+				intID, err := g.GenIntID()
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GenIntID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if (intID == 0) != (tt.wantErr != nil) {
+					t.Errorf("GenIntID() id = %v", intID)
+				}
+			},
+		)
+	}
+}
+
+func TestGenerator_OnWorkIDChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		workID   int
+		wantNode int64
+		wantErr  error
+	}{
+		{
+			name:     "test_01",
+			workID:   2,
+			wantNode: 2,
+		},
+		{
+			// 超出范围的workID无法生成ID
+			name:    "test_02",
+			workID:  1024,
+			wantErr: workid.ErrLeaseLost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				conn := &notifierConn{stubConn: stubConn{workID: 1, state: workid.LeaseHeld}}
+				g := NewSnowflakeGenerator(conn)
+				if id, err := g.GenIntID(); err != nil || id>>12&0x3ff != 1 {
+					t.Fatalf("GenIntID() = %v, %v", id, err)
+				}
+				conn.onChange(tt.workID)
+				id, err := g.GenIntID()
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GenIntID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && id>>12&0x3ff != tt.wantNode {
+					t.Errorf("GenIntID() node = %v, want %v", id>>12&0x3ff, tt.wantNode)
+				}
+			},
+		)
+	}
+}
+
+func TestNewSnowflakeGenerator_lease(t *testing.T) {
+	lease := &stubLease{stubConn: stubConn{workID: 3, state: workid.LeaseHeld}}
+	for i := 0; i < 2; i++ {
+		g := NewSnowflakeGenerator(lease)
+		id, err := g.GenIntID()
+		if err != nil || id>>12&0x3ff != 3 {
+			t.Fatalf("GenIntID() = %v, %v, want node 3", id, err)
+		}
+	}
+	if lease.acquired != 2 {
+		t.Errorf("Acquire() called %v times, want 2", lease.acquired)
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		conn    *stubConn
+		wantErr error
+	}{
+		{
+			name: "test_01",
+			conn: &stubConn{workID: 1, state: workid.LeaseHeld},
+		},
+		{
+			name:    "test_02",
+			conn:    &stubConn{err: workid.ErrNoWorkIDAvailable},
+			wantErr: workid.ErrNoWorkIDAvailable,
+		},
+		{
+			name:    "test_03",
+			conn:    &stubConn{workID: 1024, state: workid.LeaseHeld},
+			wantErr: ErrInvalidNodeID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if _, err := NewGenerator(tt.conn); !errors.Is(err, tt.wantErr) {
+					t.Errorf("NewGenerator() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				// 创建失败时不panic，生成ID返回创建时的错误
+				if _, err := NewSnowflakeGenerator(tt.conn).GenID(); !errors.Is(err, tt.wantErr) {
+					t.Errorf("GenID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+// observerConn 记录已生成ID最大时间戳的连接
+type observerConn struct {
+	stubConn
+	observed int64
+}
+
+func (c *observerConn) ObserveTimestamp(ms int64) {
+	c.observed = ms
+}
+
+func TestNewGenerator_epoch(t *testing.T) {
+	tests := []struct {
+		name  string
+		epoch []int64
+		conn  *observerConn
+		g     Generator
+	}{
+		{
+			name: "test_01",
+			conn: &observerConn{stubConn: stubConn{workID: 1, state: workid.LeaseHeld}},
+		},
+		{
+			name:  "test_02",
+			epoch: []int64{defaultEpoch - time.Hour.Milliseconds()},
+			conn:  &observerConn{stubConn: stubConn{workID: 2, state: workid.LeaseHeld}},
+		},
+	}
+	// 先创建所有生成器，不同epoch的生成器互不影响，ID中的时间戳按各自的epoch计算
+	for i := range tests {
+		g, err := NewGenerator(tests[i].conn, tests[i].epoch...)
+		if err != nil {
+			t.Fatalf("NewGenerator() error = %v", err)
+		}
+		tests[i].g = g
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				start := time.Now().UnixMilli()
+				if _, err := tt.g.GenIntID(); err != nil {
+					t.Fatalf("GenIntID() error = %v", err)
+				}
+				if diff := tt.conn.observed - start; diff < -time.Second.Milliseconds() || diff > time.Second.Milliseconds() {
+					t.Errorf("ObserveTimestamp() = %v, want about %v", tt.conn.observed, start)
+				}
+			},
+		)
+	}
+}
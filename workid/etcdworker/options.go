@@ -0,0 +1,70 @@
+package etcdworker
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidOption 配置错误
+var ErrInvalidOption = errors.New("etcdworker配置错误")
+
+// Option NewEtcdWorker 可选配置
+type Option func(w *etcdWorker)
+
+// WithPrefix 设置key前缀，默认 workid，key格式为 /<prefix>/<app>/<mod>/<n>
+func WithPrefix(prefix string) Option {
+	return func(w *etcdWorker) {
+		w.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithMaxWorkID 设置workID上限，workID取值为[0, max)，默认1024。不能超过雪花算法节点位数允许的范围
+func WithMaxWorkID(max int) Option {
+	return func(w *etcdWorker) {
+		w.maxWorkID = max
+	}
+}
+
+// WithTTL 设置etcd租约的过期时间，按秒向上取整，默认30s
+func WithTTL(ttl time.Duration) Option {
+	return func(w *etcdWorker) {
+		w.ttl = ttl
+	}
+}
+
+// WithHeartbeat 设置续约间隔，必须小于过期时间，默认为过期时间的1/3
+func WithHeartbeat(heartbeat time.Duration) Option {
+	return func(w *etcdWorker) {
+		w.heartbeat = heartbeat
+	}
+}
+
+// WithLogger 设置日志，默认使用 slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *etcdWorker) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// validate 校验配置
+func (w *etcdWorker) validate() error {
+	switch {
+	case w.client == nil:
+		return errors.Wrap(ErrInvalidOption, "etcd client is nil")
+	case w.prefix == "":
+		return errors.Wrap(ErrInvalidOption, "key prefix is empty")
+	case w.maxWorkID < 1 || w.maxWorkID-1 > snowflake.MaxNodeID():
+		return errors.Wrapf(ErrInvalidOption, "max workid %d out of range [1, %d]", w.maxWorkID, snowflake.MaxNodeID()+1)
+	case w.ttl < time.Second:
+		return errors.Wrapf(ErrInvalidOption, "ttl %s must be at least 1s", w.ttl)
+	case w.heartbeat <= 0 || w.heartbeat >= w.ttl:
+		return errors.Wrapf(ErrInvalidOption, "heartbeat %s must be positive and less than ttl %s", w.heartbeat, w.ttl)
+	}
+	return nil
+}
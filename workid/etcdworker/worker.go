@@ -0,0 +1,470 @@
+// Package etcdworker 基于etcd租约的workID分配：通过事务占用 /<prefix>/<app>/<mod>/<n> 并绑定租约，
+// 定时续约，租约过期或key被删除时判定为丢失。
+// 独立的go module，etcd依赖不进入 github.com/gosharedlib/idgenerator/v2 的依赖图
+package etcdworker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/lease"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	defaultPrefix  = "workid"         // 默认key前缀
+	maxWorkID      = 1024             // 机器码上限
+	defaultModName = "default_mod"    // 默认模块名
+	defaultTTL     = time.Second * 30 // 默认租约过期时间
+)
+
+// etcdWorker workID生成器配置
+type etcdWorker struct {
+	appName   string
+	modName   string
+	client    *clientv3.Client
+	prefix    string        // key前缀
+	maxWorkID int           // workID上限
+	ttl       time.Duration // 租约过期时间
+	heartbeat time.Duration // 续约间隔
+	logger    *slog.Logger
+	err       error // 配置错误，获取workID时返回
+}
+
+// NewEtcdWorker 获取workID配置，配置错误时获取workID返回 ErrInvalidOption
+func NewEtcdWorker(appName string, client *clientv3.Client, opts ...Option) workid.Worker {
+	w := &etcdWorker{
+		appName:   appName,
+		modName:   defaultModName,
+		client:    client,
+		prefix:    defaultPrefix,
+		maxWorkID: maxWorkID,
+		ttl:       defaultTTL,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.heartbeat == 0 {
+		w.heartbeat = w.ttl / 3
+	}
+	w.err = w.validate()
+	return w
+}
+
+// Get 获取一个租约，调用 Acquire 后才占用workID
+func (w *etcdWorker) Get(_ context.Context) workid.Lease {
+	return &etcdConn{
+		worker:    w,
+		keyPrefix: w.keyPrefix(),
+		owner:     newOwner(),
+		timerOnce: new(sync.Once),
+	}
+}
+
+// SetAppName 设置应用名
+func (w *etcdWorker) SetAppName(appName string) {
+	if appName == "" {
+		return
+	}
+	w.appName = appName
+}
+
+// SetModName 设置模块名。如果一个服务里面多个业务需要各自的workId，则必须单独设置，否则不需要设置。默认值： default_mod
+func (w *etcdWorker) SetModName(modName string) {
+	if modName == "" {
+		return
+	}
+	w.modName = modName
+}
+
+// keyPrefix workID key前缀 /<prefix>/<app>/<mod>/
+func (w *etcdWorker) keyPrefix() string {
+	return "/" + w.prefix + "/" + w.appName + "/" + w.modName + "/"
+}
+
+// List 列出当前应用模块所有有效的租约，按workID排序
+func (w *etcdWorker) List(ctx context.Context) ([]workid.LeaseInfo, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	prefix := w.keyPrefix()
+	resp, err := w.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	leases := make([]workid.LeaseInfo, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		n, err := strconv.Atoi(strings.TrimPrefix(string(kv.Key), prefix))
+		if err != nil {
+			continue
+		}
+		info := workid.LeaseInfo{WorkID: n}
+		var v value
+		if err := json.Unmarshal(kv.Value, &v); err == nil {
+			info.Owner, info.Hostname, info.PID, info.StartedAt, info.Version = v.Owner, v.Hostname, v.PID, v.StartedAt, v.Version
+		} else {
+			info.Owner = string(kv.Value)
+		}
+		if kv.Lease != 0 {
+			ttl, err := w.client.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if ttl.TTL > 0 {
+				info.TTL = time.Duration(ttl.TTL) * time.Second
+				// etcd只记录剩余时间，最近一次续约时间按授予时间与剩余时间推算
+				info.LastHeartbeat = time.Now().Add(info.TTL - time.Duration(ttl.GrantedTTL)*time.Second).Truncate(time.Second)
+			}
+		}
+		leases = append(leases, info)
+	}
+	sort.Slice(
+		leases, func(i, j int) bool {
+			return leases[i].WorkID < leases[j].WorkID
+		},
+	)
+	return leases, nil
+}
+
+// value workID key的值
+type value struct {
+	Owner     string    `json:"owner"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Version   string    `json:"version"`
+}
+
+// etcdConn workID连接
+type etcdConn struct {
+	id        int // 当前占用的workID，通过 current 读取
+	worker    *etcdWorker
+	keyPrefix string
+	owner     string           // 持有者标识
+	value     string           // key的值
+	leaseID   clientv3.LeaseID // etcd租约，通过 current 读取
+	timerOnce *sync.Once
+	acquireMu sync.Mutex    // 串行占用，并发 Acquire 时只占用一个workID
+	lease     lease.Tracker // 租约状态
+	mu        sync.Mutex    // 保护 id、leaseID、closed、stop、done
+	closed    bool          // 已释放
+	stop      chan struct{} // 关闭后心跳协程退出
+	done      chan struct{} // 心跳协程退出后关闭
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *etcdConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 占用workID：申请租约后依次尝试以事务创建空闲的key并绑定租约。
+// 已占用时返回持有的workID，不会重复占用，租约已丢失时同时返回 workid.ErrLeaseLost，实现 workid.Lease
+func (c *etcdConn) Acquire(ctx context.Context) (int, error) {
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.isClosed() {
+		return 0, workid.ErrConnClosed
+	}
+	w := c.worker
+	if w.err != nil {
+		return 0, w.err
+	}
+	if workID, ok, err := c.lease.Acquired(); ok {
+		return workID, err
+	}
+	start := time.Now()
+	grant, err := w.client.Grant(ctx, int64((w.ttl+time.Second-1)/time.Second))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	workID, err := c.claim(ctx, grant.ID, start)
+	if err != nil {
+		// 未占用成功，撤销租约，不等待过期
+		if _, e := w.client.Revoke(context.WithoutCancel(ctx), grant.ID); e != nil {
+			w.logger.WarnContext(ctx, "revoke etcd lease", slog.Any("err", e))
+		}
+		return 0, err
+	}
+	c.mu.Lock()
+	c.id, c.leaseID = workID, grant.ID
+	c.mu.Unlock()
+	c.lease.Held(workID, start, time.Duration(grant.TTL)*time.Second)
+	c.startTimer(ctx)
+	return workID, nil
+}
+
+// claim 查找并占用空闲的workID
+func (c *etcdConn) claim(ctx context.Context, leaseID clientv3.LeaseID, start time.Time) (int, error) {
+	w := c.worker
+	resp, err := w.client.Get(ctx, c.keyPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	used := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		used[string(kv.Key)] = true
+	}
+	data, _ := json.Marshal(
+		value{Owner: c.owner, Hostname: hostname(), PID: os.Getpid(), StartedAt: start, Version: workid.Version},
+	)
+	c.value = string(data)
+	for n := 0; n < w.maxWorkID; n++ {
+		key := c.keyOf(n)
+		if used[key] {
+			continue
+		}
+		txn, err := w.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, c.value, clientv3.WithLease(leaseID))).
+			Commit()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		if txn.Succeeded {
+			return n, nil
+		}
+	}
+	return 0, errors.WithStack(workid.ErrNoWorkIDAvailable)
+}
+
+// ID 当前持有的workID，未占用、租约已丢失或已释放时返回false，实现 workid.Lease
+func (c *etcdConn) ID() (int, bool) {
+	return c.lease.ID()
+}
+
+// Renew 立即续约一次，不影响定时心跳，实现 workid.Lease
+func (c *etcdConn) Renew(ctx context.Context) error {
+	if c.isClosed() {
+		return workid.ErrConnClosed
+	}
+	if c.worker.err != nil {
+		return c.worker.err
+	}
+	if err := c.lease.Renewable(); err != nil {
+		return err
+	}
+	return c.renew(ctx)
+}
+
+// heartbeat 心跳
+func (c *etcdConn) heartbeat(ctx context.Context) {
+	_ = c.renew(ctx)
+}
+
+// renew 续约并确认key仍属于当前持有者，etcd租约已过期或key已丢失时返回 workid.ErrLeaseLost
+func (c *etcdConn) renew(ctx context.Context) error {
+	w := c.worker
+	ctx, cancel := context.WithTimeout(ctx, w.heartbeat)
+	defer cancel()
+	start := time.Now()
+	workID, leaseID := c.current()
+	resp, err := w.client.KeepAliveOnce(ctx, leaseID)
+	if err == nil {
+		err = c.check(ctx)
+	}
+	switch {
+	case errors.Is(err, rpctypes.ErrLeaseNotFound) || errors.Is(err, errKeyLost):
+		c.lease.Lose()
+		w.logger.ErrorContext(ctx, "heartbeat: etcd lease expired or workid key lost", slog.Int("workID", workID), slog.Any("err", err))
+		return workid.NewLeaseError("renew", workID, workid.ErrLeaseLost)
+	case err != nil:
+		c.lease.Fail()
+		w.logger.WarnContext(ctx, "heartbeat", slog.Int("workID", workID), slog.Any("state", c.lease.Current()), slog.Any("err", err))
+		return errors.WithStack(err)
+	default:
+		c.lease.Held(workID, start, time.Duration(resp.TTL)*time.Second)
+		return nil
+	}
+}
+
+// errKeyLost key已被删除或不属于当前持有者
+var errKeyLost = errors.New("workid key not exists or owned by others")
+
+// check 确认key仍属于当前持有者，key可能被运维工具删除
+func (c *etcdConn) check(ctx context.Context) error {
+	workID, leaseID := c.current()
+	resp, err := c.worker.client.Get(ctx, c.keyOf(workID))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(resp.Kvs) == 0 || string(resp.Kvs[0].Value) != c.value || clientv3.LeaseID(resp.Kvs[0].Lease) != leaseID {
+		return errors.WithStack(errKeyLost)
+	}
+	return nil
+}
+
+// startTimer 启动定时器，心跳不受调用方ctx取消的影响，通过 Release 停止
+func (c *etcdConn) startTimer(ctx context.Context) {
+	c.timerOnce.Do(
+		func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			c.stop, c.done = make(chan struct{}), make(chan struct{})
+			go lease.KeepAlive(context.WithoutCancel(ctx), c.worker.heartbeat, c.stop, c.done, c.heartbeat, &c.lease, c.worker.logger)
+		},
+	)
+}
+
+// CleanWorkID 停止心跳并删除workID，仅删除当前持有者的key，key已被删除或被其它实例占用时返回 workid.ErrLeaseNotOwned。
+// 同时撤销etcd租约，租约回到未持有状态，之后可以通过 Acquire 重新占用
+func (c *etcdConn) CleanWorkID(ctx context.Context) error {
+	w := c.worker
+	if w.err != nil {
+		return w.err
+	}
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.stopHeartbeat(ctx) {
+		// 重新占用时再启动心跳
+		c.timerOnce = new(sync.Once)
+	}
+	c.lease.Reset()
+	workID, leaseID := c.current()
+	key := c.keyOf(workID)
+	txn, err := w.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", c.value)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := c.revoke(ctx, leaseID); err != nil {
+		return err
+	}
+	if !txn.Succeeded {
+		return workid.NewLeaseError("clean", workID, workid.ErrLeaseNotOwned)
+	}
+	return nil
+}
+
+// Release 释放workID：停止心跳并撤销租约，绑定租约的key随之删除，之后再获取workID返回 workid.ErrConnClosed
+func (c *etcdConn) Release(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.stopHeartbeat(ctx)
+	c.lease.Release()
+	if c.worker.err != nil {
+		return nil
+	}
+	// 撤销只影响绑定当前租约的key，租约已丢失时也不会删除其它实例的workID
+	ctx, cancel := lease.CleanupContext(ctx)
+	defer cancel()
+	_, leaseID := c.current()
+	return c.revoke(ctx, leaseID)
+}
+
+// revoke 撤销etcd租约，绑定租约的key随之删除。之后不再持有该租约，租约已不存在时不是错误
+func (c *etcdConn) revoke(ctx context.Context, leaseID clientv3.LeaseID) error {
+	if leaseID == 0 {
+		return nil
+	}
+	_, err := c.worker.client.Revoke(ctx, leaseID)
+	if err != nil && !errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return errors.WithStack(err)
+	}
+	c.mu.Lock()
+	if c.leaseID == leaseID {
+		c.leaseID = 0
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// stopHeartbeat 停止心跳协程并等待退出，ctx结束时不再等待，返回心跳是否启动过
+func (c *etcdConn) stopHeartbeat(ctx context.Context) bool {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.worker.logger.WarnContext(ctx, "wait for heartbeat to stop", slog.Any("err", ctx.Err()))
+	}
+	return true
+}
+
+// current 当前占用的workID与etcd租约
+func (c *etcdConn) current() (int, clientv3.LeaseID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id, c.leaseID
+}
+
+func (c *etcdConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// LeaseState 获取租约状态，超过TTL未续约成功即为丢失
+func (c *etcdConn) LeaseState() workid.LeaseState {
+	return c.lease.Current()
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *etcdConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	c.lease.Listen(fn)
+}
+
+// Health 租约健康状态，持有中或有风险时从etcd读取租约的剩余过期时间，租约已过期或被撤销时为0
+func (c *etcdConn) Health(ctx context.Context) (workid.Health, error) {
+	health := c.lease.Health()
+	if health.State != workid.LeaseHeld && health.State != workid.LeaseAtRisk {
+		return health, nil
+	}
+	_, leaseID := c.current()
+	resp, err := c.worker.client.TimeToLive(ctx, leaseID)
+	if err != nil {
+		return health, errors.WithStack(err)
+	}
+	health.TTL = max(time.Duration(resp.TTL)*time.Second, 0)
+	return health, nil
+}
+
+// keyOf workID对应的key
+func (c *etcdConn) keyOf(workID int) string {
+	return c.keyPrefix + strconv.Itoa(workID)
+}
+
+// newOwner 生成持有者标识：主机名:进程号:随机数
+func newOwner() string {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	return hostname() + ":" + strconv.Itoa(os.Getpid()) + ":" + hex.EncodeToString(nonce)
+}
+
+// hostname 主机名，获取失败时为 unknown
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
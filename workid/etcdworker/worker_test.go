@@ -0,0 +1,312 @@
+package etcdworker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// newEtcd 启动进程内的etcd服务
+func newEtcd(t *testing.T) *clientv3.Client {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	peer, client := freeURL(t), freeURL(t)
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peer}, []url.URL{peer}
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{client}, []url.URL{client}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("StartEtcd() error = %v", err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(time.Second * 10):
+		t.Fatalf("etcd not ready")
+	}
+	cli, err := clientv3.New(clientv3.Config{Endpoints: []string{client.String()}, DialTimeout: time.Second * 5})
+	if err != nil {
+		t.Fatalf("clientv3.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = cli.Close() })
+	return cli
+}
+
+// freeURL 本机空闲端口
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func TestEtcdConn_GetWorkID(t *testing.T) {
+	cli := newEtcd(t)
+	worker := NewEtcdWorker("qw-scrm", cli, WithMaxWorkID(2))
+	var conns []*etcdConn
+	for i := 0; i < 2; i++ {
+		c := worker.Get(context.TODO()).(*etcdConn)
+		c.timerOnce.Do(func() {})
+		got, err := c.GetWorkID(context.TODO())
+		if err != nil || got != i {
+			t.Fatalf("GetWorkID() = %v, %v, want %v", got, err, i)
+		}
+		conns = append(conns, c)
+	}
+	if got := conns[0].keyOf(0); got != "/workid/qw-scrm/default_mod/0" {
+		t.Errorf("keyOf() = %v", got)
+	}
+	// 重复占用返回持有的workID，不会申请新的租约
+	if got, err := conns[1].Acquire(context.TODO()); got != 1 || err != nil {
+		t.Errorf("Acquire() = %v, %v, want 1", got, err)
+	}
+	if err := conns[1].Renew(context.TODO()); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+
+	// 没有空闲的workID时撤销申请的租约
+	c := worker.Get(context.TODO()).(*etcdConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+	leases, err := cli.Leases(context.TODO())
+	if err != nil || len(leases.Leases) != 2 {
+		t.Errorf("Leases() = %v, %v, want 2 leases", leases, err)
+	}
+
+	if err := conns[0].Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := conns[0].GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	// 释放后的workID可以被重新占用
+	c = worker.Get(context.TODO()).(*etcdConn)
+	c.timerOnce.Do(func() {})
+	g := snowflake.NewSnowflakeGenerator(c)
+	if _, err := g.GenIntID(); err != nil || c.id != 0 {
+		t.Errorf("GenIntID() error = %v, workID = %v", err, c.id)
+	}
+}
+
+func TestEtcdConn_heartbeat(t *testing.T) {
+	cli := newEtcd(t)
+	tests := []struct {
+		name  string
+		setup func(c *etcdConn)
+		want  workid.LeaseState
+	}{
+		{
+			name: "test_01",
+			want: workid.LeaseHeld,
+		},
+		{
+			// 租约过期
+			name: "test_02",
+			setup: func(c *etcdConn) {
+				_, _ = cli.Revoke(context.TODO(), c.leaseID)
+			},
+			want: workid.LeaseLost,
+		},
+		{
+			// key被运维工具删除
+			name: "test_03",
+			setup: func(c *etcdConn) {
+				_, _ = cli.Delete(context.TODO(), c.keyOf(c.id))
+			},
+			want: workid.LeaseLost,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				worker := NewEtcdWorker("qw-scrm", cli, WithTTL(time.Second*5))
+				worker.SetModName(fmt.Sprintf("heartbeat_%d", i))
+				c := worker.Get(context.TODO()).(*etcdConn)
+				var changes []workid.LeaseState
+				c.OnLeaseStateChange(
+					func(_ int, state workid.LeaseState) {
+						changes = append(changes, state)
+					},
+				)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if tt.setup != nil {
+					tt.setup(c)
+				}
+				c.heartbeat(context.TODO())
+				if got := c.LeaseState(); got != tt.want {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.want)
+				}
+				if got := changes[len(changes)-1]; got != tt.want {
+					t.Errorf("OnLeaseStateChange() got = %v, want %v", got, tt.want)
+				}
+				if err := c.Release(context.TODO()); err != nil {
+					t.Errorf("Release() error = %v", err)
+				}
+			},
+		)
+	}
+}
+
+func TestEtcdConn_heartbeatUnavailable(t *testing.T) {
+	cli := newEtcd(t)
+	other, err := clientv3.New(clientv3.Config{Endpoints: cli.Endpoints(), DialTimeout: time.Second * 5})
+	if err != nil {
+		t.Fatalf("clientv3.New() error = %v", err)
+	}
+	c := NewEtcdWorker("qw-scrm", other, WithTTL(time.Second*5)).Get(context.TODO()).(*etcdConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	if got, err := c.Health(context.TODO()); err != nil || got.State != workid.LeaseHeld || got.TTL < time.Second*3 || got.TTL > time.Second*5 {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+	// 连接不可用时未超过TTL为有风险
+	_ = other.Close()
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseAtRisk {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseAtRisk)
+	}
+	// 读取失败时返回本地估算的剩余有效时间
+	if got, err := c.Health(context.TODO()); err == nil || got.ConsecutiveFailures != 1 || got.TTL <= 0 {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+}
+
+func TestEtcdConn_CleanWorkID(t *testing.T) {
+	cli := newEtcd(t)
+	worker := NewEtcdWorker("qw-scrm", cli, WithMaxWorkID(1), WithTTL(time.Second*5), WithHeartbeat(time.Millisecond*10))
+	c := worker.Get(context.TODO()).(*etcdConn)
+	g, err := snowflake.NewGenerator(c)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	// 清理后停止心跳，不再生成ID
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if _, err := g.GenIntID(); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("GenIntID() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if err := c.CleanWorkID(context.TODO()); !errors.Is(err, workid.ErrLeaseNotOwned) {
+		t.Errorf("CleanWorkID() error = %v, want %v", err, workid.ErrLeaseNotOwned)
+	}
+
+	// 其它实例占用同一个workID，清理过的连接不会续约或重新占用
+	other := worker.Get(context.TODO()).(*etcdConn)
+	if got, err := other.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if got := other.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("other LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+	if _, err := c.Acquire(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	// 释放后重新占用并恢复心跳
+	if err := other.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+	}
+	c.mu.Lock()
+	running := c.stop != nil
+	c.mu.Unlock()
+	if !running {
+		t.Errorf("heartbeat not restarted")
+	}
+	if _, err := g.GenIntID(); err != nil {
+		t.Errorf("GenIntID() error = %v", err)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+
+	// 未初始化的连接返回配置错误
+	bad := NewEtcdWorker("qw-scrm", nil).Get(context.TODO())
+	if err := bad.CleanWorkID(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("CleanWorkID() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestEtcdWorker_List(t *testing.T) {
+	cli := newEtcd(t)
+	worker := NewEtcdWorker("qw-scrm", cli, WithTTL(time.Second*10))
+	var conns []*etcdConn
+	for i := 0; i < 3; i++ {
+		c := worker.Get(context.TODO()).(*etcdConn)
+		c.timerOnce.Do(func() {})
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+		conns = append(conns, c)
+	}
+	_ = conns[1].Release(context.TODO())
+	leases, err := worker.List(context.TODO())
+	if err != nil || len(leases) != 2 {
+		t.Fatalf("List() = %+v, %v", leases, err)
+	}
+	host, _ := os.Hostname()
+	for i, want := range []int{0, 2} {
+		lease := leases[i]
+		if lease.WorkID != want || lease.Hostname != host || lease.PID != os.Getpid() || lease.Version != workid.Version ||
+			lease.TTL <= 0 || lease.TTL > time.Second*10 || lease.StartedAt.IsZero() {
+			t.Errorf("List() lease = %+v", lease)
+		}
+	}
+}
+
+func TestNewEtcdWorker_options(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "test_01", opts: []Option{WithPrefix("/")}},
+		{name: "test_02", opts: []Option{WithMaxWorkID(0)}},
+		{name: "test_03", opts: []Option{WithMaxWorkID(maxWorkID + 1)}},
+		{name: "test_04", opts: []Option{WithTTL(time.Millisecond * 500)}},
+		{name: "test_05", opts: []Option{WithTTL(time.Second * 5), WithHeartbeat(time.Second * 5)}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := NewEtcdWorker("qw-scrm", &clientv3.Client{}, tt.opts...).Get(context.TODO())
+				if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+					t.Errorf("GetWorkID() error = %v, want %v", err, ErrInvalidOption)
+				}
+			},
+		)
+	}
+	if _, err := NewEtcdWorker("qw-scrm", nil).List(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("List() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package fileworker
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported 当前平台不支持flock
+var ErrUnsupported = errors.New("fileworker: flock is not supported on this platform")
+
+func tryLock(_ *os.File, _ bool) (bool, error) {
+	return false, errors.WithStack(ErrUnsupported)
+}
+
+func unlock(_ *os.File) error {
+	return errors.WithStack(ErrUnsupported)
+}
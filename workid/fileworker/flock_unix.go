@@ -0,0 +1,36 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package fileworker
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// tryLock 非阻塞地加锁，已被其它文件描述符锁定时返回false。进程退出时内核自动释放锁
+func tryLock(f *os.File, exclusive bool) (bool, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, syscall.EWOULDBLOCK):
+			return false, nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		default:
+			return false, errors.WithStack(err)
+		}
+	}
+}
+
+// unlock 解锁，关闭文件时也会自动解锁
+func unlock(f *os.File) error {
+	return errors.WithStack(syscall.Flock(int(f.Fd()), syscall.LOCK_UN))
+}
@@ -0,0 +1,51 @@
+package fileworker
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidOption 配置错误
+var ErrInvalidOption = errors.New("fileworker配置错误")
+
+// Option NewFileWorker 可选配置
+type Option func(w *fileWorker)
+
+// WithRange 设置workID范围[start, end)，默认[0, 1024)。多台主机共用雪花算法时为每台主机分配不相交的范围
+func WithRange(start, end int) Option {
+	return func(w *fileWorker) {
+		w.start, w.end = start, end
+	}
+}
+
+// WithCheckInterval 设置检查锁文件是否被删除或替换的间隔，默认10s
+func WithCheckInterval(interval time.Duration) Option {
+	return func(w *fileWorker) {
+		w.interval = interval
+	}
+}
+
+// WithLogger 设置日志，默认使用 slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *fileWorker) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// validate 校验配置
+func (w *fileWorker) validate() error {
+	switch {
+	case w.dir == "":
+		return errors.Wrap(ErrInvalidOption, "lock dir is empty")
+	case w.start < 0 || w.start >= w.end || w.end-1 > snowflake.MaxNodeID():
+		return errors.Wrapf(ErrInvalidOption, "range [%d, %d) out of [0, %d]", w.start, w.end, snowflake.MaxNodeID()+1)
+	case w.interval <= 0:
+		return errors.Wrapf(ErrInvalidOption, "check interval %s must be positive", w.interval)
+	}
+	return nil
+}
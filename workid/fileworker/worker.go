@@ -0,0 +1,389 @@
+// Package fileworker 基于文件锁的workID分配，适用于同一台主机上的多个进程：
+// 每个workID对应目录下的一个锁文件，持有flock排它锁即占用该workID，进程崩溃退出时内核自动释放锁
+package fileworker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/lease"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxWorkID            = 1024                  // 机器码上限
+	defaultModName       = "default_mod"         // 默认模块名
+	defaultCheckInterval = time.Second * 10      // 默认检查锁文件的间隔
+	never                = time.Hour * 24 * 3650 // 文件锁不会过期，租约有效期取足够长的时间
+)
+
+// fileWorker workID生成器配置
+type fileWorker struct {
+	appName  string
+	modName  string
+	dir      string        // 锁文件目录
+	start    int           // workID范围起点(含)
+	end      int           // workID范围终点(不含)
+	interval time.Duration // 检查锁文件的间隔
+	logger   *slog.Logger
+	err      error // 配置错误，获取workID时返回
+}
+
+// NewFileWorker 获取workID配置，锁文件为 <dir>/<app>.<mod>.<n>.lock，目录不存在时自动创建。
+// 锁文件只对同一台主机上的进程有效，不能放在NFS等网络文件系统上。配置错误时获取workID返回 ErrInvalidOption
+func NewFileWorker(appName, dir string, opts ...Option) workid.Worker {
+	w := &fileWorker{
+		appName:  appName,
+		modName:  defaultModName,
+		dir:      dir,
+		end:      maxWorkID,
+		interval: defaultCheckInterval,
+		logger:   slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.err = w.validate()
+	return w
+}
+
+// Get 获取一个租约，调用 Acquire 后才占用workID
+func (w *fileWorker) Get(_ context.Context) workid.Lease {
+	return &fileConn{
+		worker:    w,
+		prefix:    w.prefix(),
+		timerOnce: new(sync.Once),
+	}
+}
+
+// SetAppName 设置应用名
+func (w *fileWorker) SetAppName(appName string) {
+	if appName == "" {
+		return
+	}
+	w.appName = appName
+}
+
+// SetModName 设置模块名。如果一个服务里面多个业务需要各自的workId，则必须单独设置，否则不需要设置。默认值： default_mod
+func (w *fileWorker) SetModName(modName string) {
+	if modName == "" {
+		return
+	}
+	w.modName = modName
+}
+
+// prefix 锁文件路径前缀 <dir>/<app>.<mod>.
+func (w *fileWorker) prefix() string {
+	return filepath.Join(w.dir, w.appName+"."+w.modName+".")
+}
+
+// List 列出范围内被锁定的workID，按workID排序。锁文件没有过期时间，TTL与最近续约时间为零值
+func (w *fileWorker) List(_ context.Context) ([]workid.LeaseInfo, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	prefix := w.prefix()
+	var leases []workid.LeaseInfo
+	for n := w.start; n < w.end; n++ {
+		f, err := os.Open(lockPath(prefix, n))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// 能加共享锁说明没有进程持有排它锁
+		free, err := tryLock(f, false)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if !free {
+			info := workid.LeaseInfo{WorkID: n}
+			var m lockMeta
+			if data, err := io.ReadAll(f); err == nil && json.Unmarshal(data, &m) == nil {
+				info.Owner, info.Hostname, info.PID, info.StartedAt, info.Version = m.Owner, m.Hostname, m.PID, m.StartedAt, m.Version
+			}
+			leases = append(leases, info)
+		}
+		_ = f.Close()
+	}
+	return leases, nil
+}
+
+// lockMeta 锁文件内容，只用于查看
+type lockMeta struct {
+	Owner     string    `json:"owner"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Version   string    `json:"version"`
+}
+
+// lockPath workID对应的锁文件
+func lockPath(prefix string, workID int) string {
+	return prefix + strconv.Itoa(workID) + ".lock"
+}
+
+// fileConn workID连接
+type fileConn struct {
+	id        int
+	worker    *fileWorker
+	prefix    string
+	file      *os.File // 持有锁的文件，关闭即释放
+	timerOnce *sync.Once
+	acquireMu sync.Mutex    // 串行占用，并发 Acquire 时只锁定一个workID
+	lease     lease.Tracker // 租约状态
+	mu        sync.Mutex    // 保护 file、closed、stop、done
+	closed    bool          // 已释放
+	stop      chan struct{} // 关闭后检查协程退出
+	done      chan struct{} // 检查协程退出后关闭
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *fileConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 占用workID：依次对范围内的锁文件加非阻塞排它锁，第一个加锁成功的即为workID。
+// 已占用时返回持有的workID，不会重复加锁，租约已丢失时同时返回 workid.ErrLeaseLost，实现 workid.Lease
+func (c *fileConn) Acquire(ctx context.Context) (int, error) {
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.isClosed() {
+		return 0, workid.ErrConnClosed
+	}
+	w := c.worker
+	if w.err != nil {
+		return 0, w.err
+	}
+	if workID, ok, err := c.lease.Acquired(); ok {
+		return workID, err
+	}
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	start := time.Now()
+	for n := w.start; n < w.end; n++ {
+		f, err := c.lock(n)
+		if err != nil {
+			return 0, err
+		}
+		if f == nil {
+			continue
+		}
+		c.mu.Lock()
+		c.id, c.file = n, f
+		c.mu.Unlock()
+		c.writeMeta(f, start)
+		c.lease.Held(n, start, never)
+		c.startTimer(ctx)
+		return n, nil
+	}
+	return 0, errors.WithStack(workid.ErrNoWorkIDAvailable)
+}
+
+// lock 对workID的锁文件加排它锁，已被其它进程锁定时返回nil
+func (c *fileConn) lock(workID int) (*os.File, error) {
+	path := lockPath(c.prefix, workID)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ok, err := tryLock(f, true)
+	if err != nil || !ok {
+		_ = f.Close()
+		return nil, err
+	}
+	// 打开后文件可能被删除并重新创建，锁住的已不是该路径上的文件，其它进程仍能锁住新文件
+	if !c.sameFile(f, path) {
+		_ = f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
+
+// sameFile 路径上的文件是否仍是加锁的文件
+func (c *fileConn) sameFile(f *os.File, path string) bool {
+	locked, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(locked, current)
+}
+
+// writeMeta 写入持有者信息，只用于查看，失败不影响使用
+func (c *fileConn) writeMeta(f *os.File, start time.Time) {
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(
+		lockMeta{
+			Owner: host + ":" + strconv.Itoa(os.Getpid()), Hostname: host, PID: os.Getpid(), StartedAt: start, Version: workid.Version,
+		},
+	)
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt(data, 0)
+		if err == nil {
+			return
+		}
+	}
+	c.worker.logger.Warn("write lock file meta", slog.String("file", f.Name()))
+}
+
+// ID 当前持有的workID，未占用、租约已丢失或已释放时返回false，实现 workid.Lease
+func (c *fileConn) ID() (int, bool) {
+	return c.lease.ID()
+}
+
+// Renew 立即检查一次锁文件，锁文件没有过期时间，检查通过即为续约成功，实现 workid.Lease
+func (c *fileConn) Renew(ctx context.Context) error {
+	if c.isClosed() {
+		return workid.ErrConnClosed
+	}
+	if c.worker.err != nil {
+		return c.worker.err
+	}
+	if err := c.lease.Renewable(); err != nil {
+		return err
+	}
+	return c.verify(ctx)
+}
+
+// check 定时检查
+func (c *fileConn) check(ctx context.Context) {
+	_ = c.verify(ctx)
+}
+
+// verify 检查锁文件是否被删除或替换，被替换后其它进程可以锁住新文件，判定为丢失并返回 workid.ErrLeaseLost
+func (c *fileConn) verify(ctx context.Context) error {
+	c.mu.Lock()
+	f := c.file
+	c.mu.Unlock()
+	if f == nil {
+		return nil
+	}
+	if !c.sameFile(f, lockPath(c.prefix, c.id)) {
+		c.lease.Lose()
+		c.worker.logger.ErrorContext(ctx, "check: lock file removed or replaced", slog.Int("workID", c.id), slog.String("file", f.Name()))
+		return workid.NewLeaseError("renew", c.id, workid.ErrLeaseLost)
+	}
+	c.lease.Held(c.id, time.Now(), never)
+	return nil
+}
+
+// startTimer 启动定时检查，不受调用方ctx取消的影响，通过 Release 停止
+func (c *fileConn) startTimer(ctx context.Context) {
+	c.timerOnce.Do(
+		func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			c.stop, c.done = make(chan struct{}), make(chan struct{})
+			go lease.KeepAlive(context.WithoutCancel(ctx), c.worker.interval, c.stop, c.done, c.check, &c.lease, c.worker.logger)
+		},
+	)
+}
+
+// CleanWorkID 停止检查并解锁，workID可以被其它进程占用。租约回到未持有状态，之后可以通过 Acquire 重新占用
+func (c *fileConn) CleanWorkID(ctx context.Context) error {
+	if c.worker.err != nil {
+		return c.worker.err
+	}
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.stopTimer(ctx) {
+		// 重新占用时再启动检查
+		c.timerOnce = new(sync.Once)
+	}
+	err := c.unlock()
+	c.lease.Reset()
+	return err
+}
+
+// unlock 解锁并关闭锁文件。锁文件不删除，删除后可能与正在加锁的进程竞争
+func (c *fileConn) unlock() error {
+	c.mu.Lock()
+	f := c.file
+	c.file = nil
+	c.mu.Unlock()
+	if f == nil {
+		return nil
+	}
+	_ = f.Truncate(0)
+	err := unlock(f)
+	if e := f.Close(); err == nil {
+		err = errors.WithStack(e)
+	}
+	return err
+}
+
+// Release 释放workID：停止检查并解锁，之后再获取workID返回 workid.ErrConnClosed
+func (c *fileConn) Release(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	// 解锁不依赖ctx，ctx结束时不再等待检查协程退出，仍然解锁
+	c.stopTimer(ctx)
+	c.lease.Release()
+	return c.unlock()
+}
+
+// stopTimer 停止定时检查并等待检查协程退出，ctx结束时不再等待，返回检查是否启动过
+func (c *fileConn) stopTimer(ctx context.Context) bool {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+func (c *fileConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// LeaseState 获取租约状态，持有锁期间一直为持有，锁文件被删除或替换后为丢失
+func (c *fileConn) LeaseState() workid.LeaseState {
+	return c.lease.Current()
+}
+
+// Health 租约健康状态，持有锁期间不会过期，TTL为-1，最近一次续约时间为最近一次检查通过的时间
+func (c *fileConn) Health(_ context.Context) (workid.Health, error) {
+	health := c.lease.Health()
+	if health.State == workid.LeaseHeld {
+		health.TTL = -1
+	}
+	return health, nil
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *fileConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	c.lease.Listen(fn)
+}
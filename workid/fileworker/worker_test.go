@@ -0,0 +1,300 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package fileworker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+)
+
+// getConn 获取不启动检查协程的连接
+func getConn(worker workid.Worker) *fileConn {
+	c := worker.Get(context.TODO()).(*fileConn)
+	c.timerOnce.Do(func() {})
+	return c
+}
+
+func TestFileConn_GetWorkID(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "locks")
+	worker := NewFileWorker("qw-scrm", dir, WithRange(10, 12))
+	var conns []*fileConn
+	for i := 0; i < 2; i++ {
+		c := getConn(worker)
+		got, err := c.GetWorkID(context.TODO())
+		if err != nil || got != 10+i {
+			t.Fatalf("GetWorkID() = %v, %v, want %v", got, err, 10+i)
+		}
+		conns = append(conns, c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "qw-scrm.default_mod.10.lock")); err != nil {
+		t.Errorf("lock file error = %v", err)
+	}
+	if _, err := getConn(worker).GetWorkID(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	if err := conns[0].Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := conns[0].GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	// 释放后的workID可以被重新占用
+	c := getConn(worker)
+	g := snowflake.NewSnowflakeGenerator(c)
+	if _, err := g.GenIntID(); err != nil || c.id != 10 {
+		t.Errorf("GenIntID() error = %v, workID = %v", err, c.id)
+	}
+
+	// CleanWorkID 后其它连接可以占用，当前连接的生成器不能再生成ID
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if _, err := g.GenIntID(); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("GenIntID() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if got, err := getConn(worker).GetWorkID(context.TODO()); err != nil || got != 10 {
+		t.Errorf("GetWorkID() after clean = %v, %v, want 10", got, err)
+	}
+}
+
+func TestFileConn_Acquire(t *testing.T) {
+	worker := NewFileWorker("qw-scrm", t.TempDir(), WithRange(0, 2))
+	c := getConn(worker)
+	for i := 0; i < 2; i++ {
+		if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+			t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+		}
+	}
+	if leases, err := worker.List(context.TODO()); err != nil || len(leases) != 1 {
+		t.Errorf("List() = %+v, %v, want 1 lease", leases, err)
+	}
+	if got, ok := c.ID(); got != 0 || !ok {
+		t.Errorf("ID() = %v, %v, want 0, true", got, ok)
+	}
+	if err := c.Renew(context.TODO()); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	// 锁文件被删除后续约判定为丢失
+	if err := os.Remove(lockPath(c.prefix, 0)); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := c.Renew(context.TODO()); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestFileConn_check(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(path string)
+		want  workid.LeaseState
+	}{
+		{
+			name: "test_01",
+			want: workid.LeaseHeld,
+		},
+		{
+			name: "test_02",
+			setup: func(path string) {
+				_ = os.Remove(path)
+			},
+			want: workid.LeaseLost,
+		},
+		{
+			// 锁文件被替换，其它进程可以锁住新文件
+			name: "test_03",
+			setup: func(path string) {
+				_ = os.Remove(path)
+				_ = os.WriteFile(path, nil, 0o644)
+			},
+			want: workid.LeaseLost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := getConn(NewFileWorker("qw-scrm", t.TempDir()))
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if tt.setup != nil {
+					tt.setup(lockPath(c.prefix, c.id))
+				}
+				c.check(context.TODO())
+				if got := c.LeaseState(); got != tt.want {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.want)
+				}
+				// 持有锁期间不会过期
+				if got, err := c.Health(context.TODO()); err != nil || got.State != tt.want || (got.TTL == -1) != (tt.want == workid.LeaseHeld) {
+					t.Errorf("Health() = %+v, %v", got, err)
+				}
+				_ = c.Release(context.TODO())
+			},
+		)
+	}
+}
+
+func TestFileConn_CleanWorkID(t *testing.T) {
+	tests := []struct {
+		name  string
+		timer bool // 启动检查协程
+		lost  bool // 清理前租约已丢失
+	}{
+		{
+			name: "test_01",
+		},
+		{
+			name: "test_02",
+			lost: true,
+		},
+		{
+			name:  "test_03",
+			timer: true,
+			lost:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				worker := NewFileWorker("qw-scrm", t.TempDir(), WithRange(0, 1), WithCheckInterval(time.Millisecond*10))
+				c := worker.Get(context.TODO()).(*fileConn)
+				if !tt.timer {
+					c.timerOnce.Do(func() {})
+				}
+				defer c.Release(context.TODO())
+				if _, err := c.Acquire(context.TODO()); err != nil {
+					t.Fatalf("Acquire() error = %v", err)
+				}
+				if tt.lost {
+					_ = os.Remove(lockPath(c.prefix, 0))
+					if !tt.timer {
+						_ = c.Renew(context.TODO())
+					}
+					waitState(t, c, workid.LeaseLost)
+				}
+
+				if err := c.CleanWorkID(context.TODO()); err != nil {
+					t.Fatalf("CleanWorkID() error = %v", err)
+				}
+				if got := c.LeaseState(); got != workid.LeaseNone {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+				}
+				// 清理后可以重新占用
+				if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+					t.Fatalf("Acquire() after clean = %v, %v, want 0", got, err)
+				}
+				if got := c.LeaseState(); got != workid.LeaseHeld {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+				}
+				if tt.timer {
+					// 重新占用后检查协程重新启动
+					_ = os.Remove(lockPath(c.prefix, 0))
+					waitState(t, c, workid.LeaseLost)
+				}
+			},
+		)
+	}
+}
+
+// waitState 等待租约变为指定状态
+func waitState(t *testing.T, c *fileConn, want workid.LeaseState) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); c.LeaseState() != want; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("LeaseState() = %v, want %v", c.LeaseState(), want)
+		}
+	}
+}
+
+// TestHelperProcess 子进程占用workID后等待被杀死
+func TestHelperProcess(t *testing.T) {
+	dir := os.Getenv("FILEWORKER_HELPER_DIR")
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+	c := NewFileWorker("qw-scrm", dir).Get(context.TODO())
+	workID, err := c.GetWorkID(context.TODO())
+	if err != nil {
+		fmt.Println("error", err)
+		os.Exit(1)
+	}
+	fmt.Println(workID)
+	time.Sleep(time.Minute)
+}
+
+func TestFileWorker_crash(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "FILEWORKER_HELPER_DIR="+dir)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe() error = %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "0\n" {
+		_ = cmd.Process.Kill()
+		t.Fatalf("helper output = %q, %v", line, err)
+	}
+
+	worker := NewFileWorker("qw-scrm", dir)
+	leases, err := worker.List(context.TODO())
+	if err != nil || len(leases) != 1 || leases[0].WorkID != 0 || leases[0].PID != cmd.Process.Pid {
+		t.Errorf("List() = %+v, %v", leases, err)
+	}
+	c := getConn(worker)
+	if got, err := c.GetWorkID(context.TODO()); err != nil || got != 1 {
+		t.Errorf("GetWorkID() = %v, %v, want 1", got, err)
+	}
+
+	// 进程崩溃后锁自动释放
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	if got, err := getConn(worker).GetWorkID(context.TODO()); err != nil || got != 0 {
+		t.Errorf("GetWorkID() after crash = %v, %v, want 0", got, err)
+	}
+	leases, err = worker.List(context.TODO())
+	if err != nil || len(leases) != 2 || leases[0].PID != os.Getpid() || leases[1].WorkID != 1 {
+		t.Errorf("List() = %+v, %v", leases, err)
+	}
+}
+
+func TestNewFileWorker_options(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+		opts []Option
+	}{
+		{name: "test_01"},
+		{name: "test_02", dir: "locks", opts: []Option{WithRange(5, 5)}},
+		{name: "test_03", dir: "locks", opts: []Option{WithRange(-1, 5)}},
+		{name: "test_04", dir: "locks", opts: []Option{WithRange(0, snowflake.MaxNodeID()+2)}},
+		{name: "test_05", dir: "locks", opts: []Option{WithCheckInterval(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := NewFileWorker("qw-scrm", tt.dir, tt.opts...).Get(context.TODO())
+				if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+					t.Errorf("GetWorkID() error = %v, want %v", err, ErrInvalidOption)
+				}
+			},
+		)
+	}
+}
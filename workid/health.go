@@ -0,0 +1,33 @@
+package workid
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// healthResponse 就绪探针的响应体
+type healthResponse struct {
+	Health
+	Error string `json:"error,omitempty"` // 读取剩余过期时间的错误，不影响就绪判断
+}
+
+// ReadinessHandler 就绪探针，租约持有中时返回200，有风险、已丢失或未持有时返回503，响应体为JSON格式的 Health。
+// 注册为Kubernetes的readinessProbe后，租约有风险的实例不再接收流量，续约恢复后自动恢复
+func ReadinessHandler(conn Conn) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			health, err := conn.Health(r.Context())
+			resp := healthResponse{Health: health}
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			status := http.StatusOK
+			if health.State != LeaseHeld {
+				status = http.StatusServiceUnavailable
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(resp)
+		},
+	)
+}
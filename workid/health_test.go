@@ -0,0 +1,101 @@
+package workid
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// healthConn 固定健康状态的连接
+type healthConn struct {
+	Conn
+	health Health
+	err    error
+}
+
+func (c *healthConn) Health(_ context.Context) (Health, error) {
+	return c.health, c.err
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		health     Health
+		err        error
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "test_01",
+			health:     Health{WorkID: 3, State: LeaseHeld, TTL: time.Second * 20, LastHeartbeat: time.Now()},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "test_02",
+			health:     Health{WorkID: 3, State: LeaseAtRisk, TTL: time.Second * 5, ConsecutiveFailures: 2},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "test_03",
+			health:     Health{WorkID: 3, State: LeaseLost},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "test_04",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			// 读取剩余过期时间失败不影响就绪判断
+			name:       "test_05",
+			health:     Health{WorkID: 3, State: LeaseHeld, TTL: time.Second * 20},
+			err:        errors.New("i/o timeout"),
+			wantStatus: http.StatusOK,
+			wantError:  "i/o timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				handler := ReadinessHandler(&healthConn{health: tt.health, err: tt.err})
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+				if rec.Code != tt.wantStatus {
+					t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+				}
+				var got healthResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("Unmarshal() error = %v, body = %s", err, rec.Body)
+				}
+				if got.WorkID != tt.health.WorkID || got.State != tt.health.State || got.TTL != tt.health.TTL ||
+					got.ConsecutiveFailures != tt.health.ConsecutiveFailures || !got.LastHeartbeat.Equal(tt.health.LastHeartbeat) {
+					t.Errorf("body = %+v, want %+v", got.Health, tt.health)
+				}
+				if got.Error != tt.wantError {
+					t.Errorf("error = %v, want %v", got.Error, tt.wantError)
+				}
+			},
+		)
+	}
+}
+
+func TestLeaseState_MarshalText(t *testing.T) {
+	for _, state := range []LeaseState{LeaseNone, LeaseHeld, LeaseAtRisk, LeaseLost} {
+		text, err := state.MarshalText()
+		if err != nil || string(text) != state.String() {
+			t.Errorf("MarshalText() = %s, %v", text, err)
+		}
+		var got LeaseState
+		if err := got.UnmarshalText(text); err != nil || got != state {
+			t.Errorf("UnmarshalText() = %v, %v, want %v", got, err, state)
+		}
+	}
+	var got LeaseState
+	if err := got.UnmarshalText([]byte("unknown")); err == nil {
+		t.Errorf("UnmarshalText() error = nil")
+	}
+}
@@ -0,0 +1,228 @@
+// Package lease 租约状态跟踪与定时续约，供各workID实现共用，自定义的 workid.Conn 实现也可以使用
+package lease
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/pkg/errors"
+)
+
+// Tracker 租约状态跟踪。到期时间按本地时钟计算，即使心跳协程因GC或调度停顿没有执行，超过TTL后也会被判定为丢失
+type Tracker struct {
+	mu        sync.Mutex
+	workID    int
+	state     workid.LeaseState
+	released  bool      // 已主动释放
+	deadline  time.Time // 租约到期时间
+	renewedAt time.Time // 最近一次续约成功的时间
+	failures  int       // 连续续约失败的次数
+	listeners []workid.LeaseListener
+}
+
+// Held 获取或续约成功，start为发起请求前的时间，保证计算出的到期时间不晚于存储中的实际到期时间
+func (l *Tracker) Held(workID int, start time.Time, ttl time.Duration) {
+	l.mu.Lock()
+	if l.state == workid.LeaseLost || l.released {
+		l.mu.Unlock()
+		return
+	}
+	l.workID = workID
+	l.deadline = start.Add(ttl)
+	l.renewedAt = time.Now()
+	l.failures = 0
+	l.transit(workid.LeaseHeld)
+}
+
+// Reacquire 租约丢失后重新占用成功，回到持有状态，workID可能与之前不同。已主动释放时不变更
+func (l *Tracker) Reacquire(workID int, start time.Time, ttl time.Duration) {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return
+	}
+	l.workID = workID
+	l.deadline = start.Add(ttl)
+	l.renewedAt = time.Now()
+	l.failures = 0
+	l.notify(workid.LeaseHeld)
+}
+
+// Fail 续约失败，未超过TTL时为有风险，否则为丢失
+func (l *Tracker) Fail() {
+	l.mu.Lock()
+	l.failures++
+	if time.Now().Before(l.deadline) {
+		l.transit(workid.LeaseAtRisk)
+		return
+	}
+	l.transit(workid.LeaseLost)
+}
+
+// Lose 租约丢失
+func (l *Tracker) Lose() {
+	l.mu.Lock()
+	l.transit(workid.LeaseLost)
+}
+
+// Release 主动释放，回到未持有状态，之后不再接受其它状态变更
+func (l *Tracker) Release() {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return
+	}
+	l.released = true
+	l.notify(workid.LeaseNone)
+}
+
+// Reset 主动归还workID，回到未持有状态，之后可以重新占用。与 Release 不同，不会拒绝之后的状态变更，已主动释放时不变更
+func (l *Tracker) Reset() {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return
+	}
+	l.deadline, l.failures = time.Time{}, 0
+	l.notify(workid.LeaseNone)
+}
+
+// Current 当前租约状态
+func (l *Tracker) Current() workid.LeaseState {
+	l.mu.Lock()
+	if (l.state == workid.LeaseHeld || l.state == workid.LeaseAtRisk) && !time.Now().Before(l.deadline) {
+		l.transit(workid.LeaseLost)
+		return workid.LeaseLost
+	}
+	state := l.state
+	l.mu.Unlock()
+	return state
+}
+
+// Health 租约健康状态，剩余过期时间按本地时钟估算
+func (l *Tracker) Health() workid.Health {
+	state := l.Current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	health := workid.Health{
+		WorkID:              l.workID,
+		State:               state,
+		LastHeartbeat:       l.renewedAt,
+		ConsecutiveFailures: l.failures,
+	}
+	if state == workid.LeaseHeld || state == workid.LeaseAtRisk {
+		health.TTL = max(time.Until(l.deadline), 0)
+	}
+	return health
+}
+
+// Acquired 已占用过workID时返回最近持有的workID，租约已丢失时同时返回 workid.ErrLeaseLost。
+// Lease.Acquire 重复调用时据此直接返回，不再占用新的workID
+func (l *Tracker) Acquired() (workID int, ok bool, err error) {
+	state := l.Current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state == workid.LeaseNone {
+		return 0, false, nil
+	}
+	if state == workid.LeaseLost {
+		err = workid.NewLeaseError("acquire", l.workID, workid.ErrLeaseLost)
+	}
+	return l.workID, true, err
+}
+
+// ID 持有中或有风险时返回workID，实现 Lease.ID
+func (l *Tracker) ID() (int, bool) {
+	state := l.Current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.workID, state == workid.LeaseHeld || state == workid.LeaseAtRisk
+}
+
+// Renewable 续约前检查，未占用时返回 workid.ErrNotAcquired，租约已丢失时返回 workid.ErrLeaseLost
+func (l *Tracker) Renewable() error {
+	_, ok, err := l.Acquired()
+	if !ok {
+		return errors.WithStack(workid.ErrNotAcquired)
+	}
+	return err
+}
+
+// Listen 注册状态变更回调
+func (l *Tracker) Listen(fn workid.LeaseListener) {
+	if fn == nil {
+		return
+	}
+	l.mu.Lock()
+	l.listeners = append(l.listeners, fn)
+	l.mu.Unlock()
+}
+
+// transit 变更状态，调用前必须持有锁。丢失后只能通过 Reacquire 恢复，释放后不再变更
+func (l *Tracker) transit(state workid.LeaseState) {
+	if l.state == workid.LeaseLost || l.released {
+		l.mu.Unlock()
+		return
+	}
+	l.notify(state)
+}
+
+// notify 变更状态并在释放锁后通知回调，调用前必须持有锁
+func (l *Tracker) notify(state workid.LeaseState) {
+	if l.state == state {
+		l.mu.Unlock()
+		return
+	}
+	l.state = state
+	workID := l.workID
+	listeners := append([]workid.LeaseListener(nil), l.listeners...)
+	l.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(workID, state)
+	}
+}
+
+// ReleaseTimeout 调用方ctx已结束时，释放workID的清理操作(删除key、撤销租约)的超时时间
+const ReleaseTimeout = time.Second * 3
+
+// CleanupContext 释放workID的清理操作使用的ctx。等待心跳协程退出时调用方ctx已结束，改用不受其取消影响、超时为 ReleaseTimeout 的ctx，
+// 清理操作仍会执行，key不会一直保留到过期
+func CleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(context.WithoutCancel(ctx), ReleaseTimeout)
+}
+
+// KeepAlive 按心跳时间定时续约，stop关闭或租约丢失时退出并关闭done
+func KeepAlive(
+	ctx context.Context, interval time.Duration, stop <-chan struct{}, done chan<- struct{},
+	heartbeat func(ctx context.Context), l *Tracker, logger *slog.Logger,
+) {
+	defer close(done)
+	defer func() {
+		if r := recover(); r != nil {
+			logger.ErrorContext(ctx, "startTimer panic", slog.Any("panic", r))
+		}
+	}()
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		heartbeat(ctx)
+		if l.Current() == workid.LeaseLost {
+			// 租约已丢失，workID可能已被其它实例占用，不能再续约
+			return
+		}
+		timer.Reset(interval)
+	}
+}
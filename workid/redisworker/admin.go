@@ -0,0 +1,108 @@
+package redisworker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// reservedOwner 预留workID的持有者前缀，后接预留说明
+const reservedOwner = "reserved:"
+
+// ErrWorkIDOutOfRange workID超出范围
+var ErrWorkIDOutOfRange = errors.New("workid超出范围")
+
+// Admin workID运维管理，用于查看占用情况、强制释放或预留workID。与 NewRedisWorker 使用相同的配置才能操作相同的key
+type Admin struct {
+	worker *redisWorker
+}
+
+// Occupancy workID占用情况
+type Occupancy struct {
+	Total    int `json:"total"`    // workID上限
+	Held     int `json:"held"`     // 被实例持有
+	Reserved int `json:"reserved"` // 被预留
+	Free     int `json:"free"`     // 空闲
+}
+
+// NewAdmin 新建运维管理
+func NewAdmin(appName string, pool redis.Pool, opts ...Option) *Admin {
+	return &Admin{worker: NewRedisWorker(appName, pool, opts...).(*redisWorker)}
+}
+
+// SetModName 设置模块名
+func (a *Admin) SetModName(modName string) {
+	a.worker.SetModName(modName)
+}
+
+// List 列出所有被占用的workID，包括预留的workID
+func (a *Admin) List(ctx context.Context) ([]workid.LeaseInfo, error) {
+	return a.worker.List(ctx)
+}
+
+// Occupancy 统计workID占用情况
+func (a *Admin) Occupancy(ctx context.Context) (Occupancy, error) {
+	leases, err := a.List(ctx)
+	if err != nil {
+		return Occupancy{}, err
+	}
+	o := Occupancy{Total: a.worker.maxWorkID}
+	for _, lease := range leases {
+		if IsReserved(lease) {
+			o.Reserved++
+		} else {
+			o.Held++
+		}
+	}
+	o.Free = o.Total - o.Held - o.Reserved
+	return o, nil
+}
+
+// ForceRelease 强制释放workID，不校验持有者，通过脚本同时删除key与元数据，返回是否删除了key。
+// 原持有者若仍在运行，下一次续约时发现key已不属于自己，租约状态变为 workid.LeaseLost
+func (a *Admin) ForceRelease(ctx context.Context, workID int) (bool, error) {
+	c, err := a.conn(ctx, workID)
+	if err != nil {
+		return false, err
+	}
+	return c.eval(ctx, OpRelease, forceReleaseScript, []string{c.getKey(), c.metaKey(c.getKey())})
+}
+
+// Reserve 预留空闲的workID，预留的workID不会被实例占用，直到 Unreserve。note为预留说明，返回workID是否空闲
+func (a *Admin) Reserve(ctx context.Context, workID int, note string) (bool, error) {
+	c, err := a.conn(ctx, workID)
+	if err != nil {
+		return false, err
+	}
+	return c.eval(ctx, OpClaim, reserveScript, []string{c.getKey()}, reservedOwner+note)
+}
+
+// Unreserve 取消预留，workID被实例持有时不做处理，返回是否取消了预留
+func (a *Admin) Unreserve(ctx context.Context, workID int) (bool, error) {
+	c, err := a.conn(ctx, workID)
+	if err != nil {
+		return false, err
+	}
+	return c.eval(ctx, OpRelease, unreserveScript, []string{c.getKey()}, reservedOwner)
+}
+
+// conn 操作指定workID的连接
+func (a *Admin) conn(ctx context.Context, workID int) (*redisConn, error) {
+	if a.worker.err != nil {
+		return nil, a.worker.err
+	}
+	if workID < 0 || workID >= a.worker.maxWorkID {
+		return nil, errors.Wrapf(ErrWorkIDOutOfRange, "workid %d not in [0, %d)", workID, a.worker.maxWorkID)
+	}
+	c := a.worker.Get(ctx).(*redisConn)
+	c.id = workID
+	return c, nil
+}
+
+// IsReserved 是否为 Admin.Reserve 预留的workID
+func IsReserved(lease workid.LeaseInfo) bool {
+	return strings.HasPrefix(lease.Owner, reservedOwner)
+}
@@ -0,0 +1,75 @@
+package redisworker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestAdmin(t *testing.T) {
+	pool := redistest.NewPool()
+	fault := redistest.NewFaultPool(pool)
+	admin := NewAdmin("qw-scrm", fault, WithMaxWorkID(4))
+	worker := NewRedisWorker("qw-scrm", pool, WithMaxWorkID(4))
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+
+	if ok, err := admin.Reserve(context.TODO(), 1, "migration"); !ok || err != nil {
+		t.Fatalf("Reserve() = %v, %v", ok, err)
+	}
+	if ok, _ := admin.Reserve(context.TODO(), 0, ""); ok {
+		t.Errorf("Reserve() held workid = %v", ok)
+	}
+	if ok, _ := admin.Unreserve(context.TODO(), 0); ok {
+		t.Errorf("Unreserve() held workid = %v", ok)
+	}
+	if pool.TTL(c.keyOf(1)) != -1 {
+		t.Errorf("Reserve() TTL = %v, want no expiration", pool.TTL(c.keyOf(1)))
+	}
+	// 预留的workID不会被占用
+	next := worker.Get(context.TODO()).(*redisConn)
+	next.timerOnce.Do(func() {})
+	if id, err := next.GetWorkID(context.TODO()); err != nil || id != 2 {
+		t.Errorf("GetWorkID() = %v, %v, want 2", id, err)
+	}
+
+	got, err := admin.Occupancy(context.TODO())
+	if want := (Occupancy{Total: 4, Held: 2, Reserved: 1, Free: 1}); err != nil || got != want {
+		t.Errorf("Occupancy() = %+v, %v, want %+v", got, err, want)
+	}
+	leases, _ := admin.List(context.TODO())
+	if len(leases) != 3 || !IsReserved(leases[1]) || IsReserved(leases[0]) {
+		t.Errorf("List() = %+v", leases)
+	}
+
+	// 强制释放后原持有者续约失败
+	if ok, err := admin.ForceRelease(context.TODO(), 0); !ok || err != nil {
+		t.Fatalf("ForceRelease() = %v, %v", ok, err)
+	}
+	if _, ok := pool.Value(c.metaKey(c.getKey())); ok {
+		t.Errorf("ForceRelease() meta key not deleted")
+	}
+	// key与元数据在同一个脚本中删除
+	if got := fault.Calls(redistest.OpDel); got != 0 {
+		t.Errorf("ForceRelease() Del calls = %v, want 0", got)
+	}
+	if ok, err := admin.ForceRelease(context.TODO(), 0); ok || err != nil {
+		t.Errorf("ForceRelease() free workid = %v, %v", ok, err)
+	}
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseLost {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseLost)
+	}
+	if ok, err := admin.Unreserve(context.TODO(), 1); !ok || err != nil {
+		t.Errorf("Unreserve() = %v, %v", ok, err)
+	}
+	if _, err := admin.ForceRelease(context.TODO(), 4); !errors.Is(err, ErrWorkIDOutOfRange) {
+		t.Errorf("ForceRelease() error = %v, want %v", err, ErrWorkIDOutOfRange)
+	}
+}
@@ -0,0 +1,71 @@
+package redisworker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestConn_cluster(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantKey   string
+		wantSetNX bool
+		wantList  bool
+	}{
+		{
+			name:     "test_01",
+			opts:     []Option{WithHashTag()},
+			wantKey:  "workid:{qw-scrm:default_mod}:1",
+			wantList: true,
+		},
+		{
+			// 未使用 hash tag 时脚本占用失败，批量查出空闲的workID后逐个尝试占用，续约、释放与列出租约不受影响
+			name:      "test_02",
+			wantKey:   "workid:qw-scrm:default_mod:1",
+			wantSetNX: true,
+			wantList:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				cluster := redistest.NewPool(redistest.WithCluster())
+				pool := redistest.NewFaultPool(cluster)
+				worker := NewRedisWorker("qw-scrm", pool, tt.opts...)
+				c := worker.Get(context.TODO()).(*redisConn)
+				cluster.Set(c.keyOf(0), "other", 0)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if got := c.getKey(); got != tt.wantKey {
+					t.Errorf("getKey() = %v, want %v", got, tt.wantKey)
+				}
+				if got := pool.Calls(redistest.OpSetNX) > 0; got != tt.wantSetNX {
+					t.Errorf("SetNX called = %v, want %v", got, tt.wantSetNX)
+				}
+				if redistest.KeySlot(c.getKey()) != redistest.KeySlot(c.metaKey(c.getKey())) {
+					t.Errorf("metaKey() %v not in the same slot as %v", c.metaKey(c.getKey()), c.getKey())
+				}
+				c.heartbeat(context.TODO())
+				if got := c.LeaseState(); got != workid.LeaseHeld {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+				}
+				leases, err := worker.List(context.TODO())
+				if (err == nil) != tt.wantList || tt.wantList && len(leases) != 2 {
+					t.Errorf("List() = %v, %v, wantList %v", leases, err, tt.wantList)
+				}
+				if err := c.Release(context.TODO()); err != nil {
+					t.Errorf("Release() error = %v", err)
+				}
+				if _, ok := cluster.Value(c.getKey()); ok {
+					t.Errorf("Release() key %v not deleted", c.getKey())
+				}
+			},
+		)
+	}
+}
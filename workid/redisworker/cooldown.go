@@ -0,0 +1,93 @@
+package redisworker
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	lastKeySuffix   = ":last"         // 最后时间戳key后缀
+	lastKeyTTL      = time.Hour       // 最后时间戳保留时间，远大于各实例之间可能的时钟偏差
+	defaultCooldown = time.Second * 5 // 默认最长等待时间
+	getScript       = `return redis.call('GET', KEYS[1])`
+)
+
+// lastKey workID key对应的最后时间戳key，记录持有者已生成ID的最大时间戳(Unix毫秒)。
+// 释放或过期后保留，下一个持有者据此等待本地时钟超过该时间戳。与元数据key一样位于同一个slot
+func (c *redisConn) lastKey(key string) string {
+	if c.hashTag {
+		return key + lastKeySuffix
+	}
+	return "{" + key + "}" + lastKeySuffix
+}
+
+// ObserveTimestamp 记录已生成ID的时间戳(Unix毫秒)，续约与释放时写入redis，实现 workid.TimestampObserver
+func (c *redisConn) ObserveTimestamp(ms int64) {
+	for {
+		last := c.lastTS.Load()
+		if ms <= last || c.lastTS.CompareAndSwap(last, ms) {
+			return
+		}
+	}
+}
+
+// previousTimestamp 上一个持有者已生成ID的最大时间戳，没有记录时为0
+func (c *redisConn) previousTimestamp(ctx context.Context, workID int) (int64, error) {
+	return c.getInt(ctx, c.lastKey(c.keyOf(workID)))
+}
+
+// getInt 读取整数值，key不存在时为0
+func (c *redisConn) getInt(ctx context.Context, key string) (int64, error) {
+	var result interface{}
+	err := c.do(
+		ctx, OpClaim, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			result, err = conn.Eval(ctx, getScript, []string{key})
+			return err
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	s, err := toString(result)
+	if err != nil || s == "" {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, errors.WithStack(err)
+}
+
+// cooldown 等待本地时钟超过上一个持有者的最后时间戳，需要等待的时间超过 WithReuseCooldown 设置的上限或过期时间的一半时返回false，调用方应跳过该workID。
+// 读取失败时不等待，只记录日志
+func (c *redisConn) cooldown(ctx context.Context, workID int, previous func() (int64, error)) (bool, error) {
+	if c.maxCooldown == 0 {
+		return true, nil
+	}
+	last, err := previous()
+	if err != nil {
+		c.log().WarnContext(ctx, "read workid last timestamp", slog.Int("workID", workID), slog.Any("err", err))
+		return true, nil
+	}
+	wait := time.Until(time.UnixMilli(last + 1))
+	if wait <= 0 {
+		return true, nil
+	}
+	// 等待期间key不续约，最多等待过期时间的一半
+	if limit := min(c.maxCooldown, c.ttl()/2); wait > limit {
+		c.log().WarnContext(ctx, "skip workid: previous holder's clock is ahead", slog.Int("workID", workID), slog.Duration("wait", wait))
+		return false, nil
+	}
+	c.log().InfoContext(ctx, "wait for previous holder's last timestamp", slog.Int("workID", workID), slog.Duration("wait", wait))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		return false, errors.WithStack(ctx.Err())
+	}
+}
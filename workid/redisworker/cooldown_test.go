@@ -0,0 +1,140 @@
+package redisworker
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestConn_reuseCooldown(t *testing.T) {
+	const lastKey = "{workid:qw-scrm:default_mod:0}:last"
+	tests := []struct {
+		name     string
+		last     time.Duration // 上一个持有者的最后时间戳相对当前时间
+		opts     []Option
+		want     int
+		wantWait time.Duration
+	}{
+		{
+			name: "test_01",
+			want: 0,
+		},
+		{
+			// 上一个持有者的时钟稍快，等待本地时钟超过后使用
+			name:     "test_02",
+			last:     time.Millisecond * 300,
+			want:     0,
+			wantWait: time.Millisecond * 300,
+		},
+		{
+			// 需要等待太久，跳过该workID
+			name: "test_03",
+			last: time.Hour,
+			want: 1,
+		},
+		{
+			name: "test_04",
+			last: time.Hour,
+			opts: []Option{WithReuseCooldown(0)},
+			want: 0,
+		},
+		{
+			// 等待时间超过过期时间的一半
+			name: "test_05",
+			last: time.Second * 3,
+			opts: []Option{WithHeartbeat(time.Second), WithTTL(time.Second * 4)},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				last := strconv.FormatInt(time.Now().Add(tt.last).UnixMilli(), 10)
+				if tt.last > 0 {
+					pool.Set(lastKey, last, time.Hour)
+				}
+				c := NewRedisWorker("qw-scrm", pool, tt.opts...).Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				start := time.Now()
+				got, err := c.GetWorkID(context.TODO())
+				if err != nil || got != tt.want {
+					t.Fatalf("GetWorkID() = %v, %v, want %v", got, err, tt.want)
+				}
+				if elapsed := time.Since(start); elapsed < tt.wantWait || elapsed > tt.wantWait+time.Second {
+					t.Errorf("GetWorkID() elapsed = %v, want %v", elapsed, tt.wantWait)
+				}
+				if tt.want != 0 {
+					// 跳过的workID已释放，最后时间戳不变
+					if _, ok := pool.Value("workid:qw-scrm:default_mod:0"); ok {
+						t.Errorf("GetWorkID() skipped workid not released")
+					}
+					if v, _ := pool.Value(lastKey); v != last {
+						t.Errorf("last timestamp = %v, want %v", v, last)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestConn_ObserveTimestamp(t *testing.T) {
+	pool := redistest.NewPool()
+	worker := NewRedisWorker("qw-scrm", pool)
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	g := snowflake.NewSnowflakeGenerator(c)
+	id, err := g.GenIntID()
+	if err != nil {
+		t.Fatalf("GenIntID() error = %v", err)
+	}
+	lastKey := c.lastKey(c.getKey())
+	if _, ok := pool.Value(lastKey); ok {
+		t.Errorf("last timestamp written before heartbeat")
+	}
+
+	// 续约时写入已生成ID的最大时间戳
+	c.heartbeat(context.TODO())
+	want := strconv.FormatInt(snowflakeTime(id), 10)
+	if v, _ := pool.Value(lastKey); v != want {
+		t.Errorf("heartbeat last timestamp = %v, want %v", v, want)
+	}
+	// 时间戳只增不减
+	c.ObserveTimestamp(1)
+	c.heartbeat(context.TODO())
+	if v, _ := pool.Value(lastKey); v != want {
+		t.Errorf("heartbeat last timestamp = %v, want %v", v, want)
+	}
+
+	// 释放时写入，释放后保留
+	future := time.Now().Add(time.Millisecond * 200).UnixMilli()
+	c.ObserveTimestamp(future)
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if v, _ := pool.Value(lastKey); v != strconv.FormatInt(future, 10) {
+		t.Errorf("release last timestamp = %v, want %v", v, future)
+	}
+	if ttl := pool.TTL(lastKey); ttl <= 0 || ttl > lastKeyTTL {
+		t.Errorf("last timestamp TTL = %v", ttl)
+	}
+
+	// 新的持有者等待本地时钟超过最后时间戳
+	next := worker.Get(context.TODO()).(*redisConn)
+	next.timerOnce.Do(func() {})
+	if got, err := next.GetWorkID(context.TODO()); err != nil || got != 0 {
+		t.Fatalf("GetWorkID() = %v, %v, want 0", got, err)
+	}
+	if now := time.Now().UnixMilli(); now <= future {
+		t.Errorf("GetWorkID() returned at %v, before last timestamp %v", now, future)
+	}
+}
+
+// snowflakeTime 雪花算法ID中的时间戳(Unix毫秒)
+func snowflakeTime(id int64) int64 {
+	return id>>22 + 1648656000000
+}
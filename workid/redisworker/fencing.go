@@ -0,0 +1,146 @@
+package redisworker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// epochKeySuffix 纪元key后缀，纪元key不过期，workID释放或过期后保留
+const epochKeySuffix = ":epoch"
+
+// epochKey workID key对应的纪元key，记录该workID被占用的次数。与元数据key一样位于同一个slot
+func (c *redisConn) epochKey(key string) string {
+	if c.hashTag {
+		return key + epochKeySuffix
+	}
+	return "{" + key + "}" + epochKeySuffix
+}
+
+// incrEpoch 递增workID的纪元，新的纪元不小于min。key已不属于当前持有者时返回 workid.ErrLeaseLost
+func (c *redisConn) incrEpoch(ctx context.Context, workID int, min int64) (int64, error) {
+	key := c.keyOf(workID)
+	var result interface{}
+	err := c.do(
+		ctx, OpClaim, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			result, err = conn.Eval(ctx, epochScript, []string{key, c.epochKey(key)}, c.owner, min)
+			return err
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	epoch, err := toInt64(result)
+	if err != nil {
+		return 0, err
+	}
+	if epoch == 0 {
+		return 0, workid.NewLeaseError("increase epoch", workID, workid.ErrLeaseLost)
+	}
+	return epoch, nil
+}
+
+// currentEpoch workID当前的纪元，没有被占用过时为0
+func (c *redisConn) currentEpoch(ctx context.Context, workID int) (int64, error) {
+	return c.getInt(ctx, c.epochKey(c.keyOf(workID)))
+}
+
+// GetToken 获取workID并返回租约凭证，已占用时返回当前的租约凭证，实现 workid.Fencer
+func (c *redisConn) GetToken(ctx context.Context) (workid.Token, error) {
+	if _, err := c.GetWorkID(ctx); err != nil {
+		return workid.Token{}, err
+	}
+	return c.Token(), nil
+}
+
+// Token 当前租约凭证，未持有或已释放时为零值，实现 workid.Fencer
+func (c *redisConn) Token() workid.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *redisConn) setToken(token workid.Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// incrEpoch 在所有节点递增纪元。先读取多数派中的最大纪元M，各节点递增后不小于M+1，超过半数节点成功时返回M+1。
+// 成功的多数派上纪元都不小于M+1，下一次占用读取的多数派至少有一个公共节点，返回的纪元一定更大
+func (c *quorumConn) incrEpoch(ctx context.Context, workID int) (int64, error) {
+	current, err := c.maxOf(
+		func(node *redisConn) (int64, error) {
+			return node.currentEpoch(ctx, workID)
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	granted, _, err := c.each(
+		func(node *redisConn) (bool, error) {
+			_, err := node.incrEpoch(ctx, workID, current+1)
+			if errors.Is(err, workid.ErrLeaseLost) {
+				return false, nil
+			}
+			return err == nil, err
+		},
+	)
+	if granted >= c.quorum {
+		return current + 1, nil
+	}
+	if err == nil {
+		err = workid.NewLeaseError("increase epoch", workID, workid.ErrLeaseLost)
+	}
+	return 0, err
+}
+
+// GetToken 获取workID并返回租约凭证，已占用时返回当前的租约凭证，实现 workid.Fencer
+func (c *quorumConn) GetToken(ctx context.Context) (workid.Token, error) {
+	if _, err := c.GetWorkID(ctx); err != nil {
+		return workid.Token{}, err
+	}
+	return c.Token(), nil
+}
+
+// Token 当前租约凭证，未持有或已释放时为零值，实现 workid.Fencer
+func (c *quorumConn) Token() workid.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *quorumConn) setToken(token workid.Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// maxOf 在所有节点执行fn，超过半数节点成功时返回其中的最大值
+func (c *quorumConn) maxOf(fn func(node *redisConn) (int64, error)) (int64, error) {
+	var (
+		mu     sync.Mutex
+		result int64
+	)
+	granted, _, err := c.each(
+		func(node *redisConn) (bool, error) {
+			n, err := fn(node)
+			if err != nil {
+				return false, err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if n > result {
+				result = n
+			}
+			return true, nil
+		},
+	)
+	if granted >= c.quorum {
+		return result, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,191 @@
+package redisworker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestConn_GetToken(t *testing.T) {
+	const epochKey = "{workid:qw-scrm:default_mod:0}:epoch"
+	tests := []struct {
+		name  string
+		epoch string // 已记录的纪元
+		opts  []Option
+		want  int64
+	}{
+		{
+			name: "test_01",
+			want: 1,
+		},
+		{
+			name:  "test_02",
+			epoch: "41",
+			want:  42,
+		},
+		{
+			// 使用 hash tag 时纪元key不同
+			name:  "test_03",
+			epoch: "41",
+			opts:  []Option{WithHashTag()},
+			want:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				if tt.epoch != "" {
+					pool.Set(epochKey, tt.epoch, 0)
+				}
+				worker := NewRedisWorker("qw-scrm", pool, tt.opts...)
+				c := worker.Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				token, err := c.GetToken(context.TODO())
+				if err != nil {
+					t.Fatalf("GetToken() error = %v", err)
+				}
+				if token.WorkID != 0 || token.Epoch != tt.want || token.Owner != c.owner || token.AcquiredAt.IsZero() {
+					t.Errorf("GetToken() = %+v, want epoch %v", token, tt.want)
+				}
+				if got := c.Token(); got != token {
+					t.Errorf("Token() = %+v, want %+v", got, token)
+				}
+
+				// 释放后凭证清空，纪元保留，下一个持有者的纪元更大
+				if err := c.Release(context.TODO()); err != nil {
+					t.Fatalf("Release() error = %v", err)
+				}
+				if got := c.Token(); got != (workid.Token{}) {
+					t.Errorf("Token() after release = %+v", got)
+				}
+				key := c.epochKey(c.keyOf(0))
+				if ttl := pool.TTL(key); ttl != -1 {
+					t.Errorf("epoch TTL = %v, want no expiration", ttl)
+				}
+				next := worker.Get(context.TODO()).(*redisConn)
+				next.timerOnce.Do(func() {})
+				if token, err := next.GetToken(context.TODO()); err != nil || token.WorkID != 0 || token.Epoch != tt.want+1 {
+					t.Errorf("GetToken() = %+v, %v, want epoch %v", token, err, tt.want+1)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_incrEpoch(t *testing.T) {
+	pool := redistest.NewPool()
+	c := NewRedisWorker("qw-scrm", pool).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	// 纪元不小于指定的最小值
+	if got, err := c.incrEpoch(context.TODO(), 0, 10); err != nil || got != 10 {
+		t.Errorf("incrEpoch() = %v, %v, want 10", got, err)
+	}
+	if got, err := c.incrEpoch(context.TODO(), 0, 0); err != nil || got != 11 {
+		t.Errorf("incrEpoch() = %v, %v, want 11", got, err)
+	}
+	// key已被其它实例占用时不递增
+	pool.Set(c.getKey(), "other", 0)
+	if _, err := c.incrEpoch(context.TODO(), 0, 0); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("incrEpoch() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if got, err := c.currentEpoch(context.TODO(), 0); err != nil || got != 11 {
+		t.Errorf("currentEpoch() = %v, %v, want 11", got, err)
+	}
+}
+
+func TestConn_GetTokenScriptingDisabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			// 默认无法递增纪元时占用失败
+			name:    "test_01",
+			wantErr: true,
+		},
+		{
+			// 允许不递增纪元时仍能获取workID，纪元为0
+			name: "test_02",
+			opts: []Option{WithUnfencedFallback()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool(redistest.WithScriptingDisabled())
+				c := NewRedisWorker("qw-scrm", pool, tt.opts...).Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				token, err := c.GetToken(context.TODO())
+				if (err != nil) != tt.wantErr || token.Epoch != 0 {
+					t.Errorf("GetToken() = %+v, %v, wantErr %v", token, err, tt.wantErr)
+				}
+				if got := c.LeaseState(); tt.wantErr && got != workid.LeaseNone {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_GetTokenReadOnly(t *testing.T) {
+	// 故障切换期间无法递增纪元时占用失败并释放workID，不会以更小的纪元使用workID
+	mem := redistest.NewPool()
+	pool := redistest.NewFaultPool(mem)
+	c := NewRedisWorker("qw-scrm", pool, WithUnfencedFallback()).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	pool.Inject(
+		redistest.OpEval, redistest.Fault{
+			Err: errors.New("READONLY You can't write against a read only replica."),
+			Match: func(call redistest.Call) bool {
+				return call.Script == epochScript
+			},
+		},
+	)
+	if _, err := c.GetToken(context.TODO()); err == nil {
+		t.Fatalf("GetToken() error = nil, want READONLY")
+	}
+	if _, ok := mem.Value(c.keyOf(0)); ok {
+		t.Errorf("key %v not released", c.keyOf(0))
+	}
+}
+
+func TestQuorumConn_GetToken(t *testing.T) {
+	const epochKey = "{workid:qw-scrm:default_mod:0}:epoch"
+	nodes, faults, pools := newQuorumPools(3)
+	// 只有少数节点记录了更大的纪元，新的纪元仍大于它
+	nodes[2].Set(epochKey, "10", 0)
+	worker := NewQuorumWorker("qw-scrm", pools)
+	c := worker.Get(context.TODO()).(*quorumConn)
+	c.timerOnce.Do(func() {})
+	token, err := c.GetToken(context.TODO())
+	if err != nil || token.WorkID != 0 || token.Epoch != 11 {
+		t.Fatalf("GetToken() = %+v, %v, want epoch 11", token, err)
+	}
+	for i, node := range nodes {
+		if v, _ := node.Value(epochKey); v != "11" {
+			t.Errorf("node %d epoch = %v, want 11", i, v)
+		}
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	// 一个节点不可用时，多数派中的最大纪元仍是最新的值
+	faults[0].Inject(redistest.OpEval, redistest.Fault{Err: redistest.ErrInjected})
+	next := worker.Get(context.TODO()).(*quorumConn)
+	next.timerOnce.Do(func() {})
+	if token, err := next.GetToken(context.TODO()); err != nil || token.Epoch != 12 {
+		t.Errorf("GetToken() = %+v, %v, want epoch 12", token, err)
+	}
+	if v, _ := nodes[0].Value(epochKey); v != "11" {
+		t.Errorf("unavailable node epoch = %v, want 11", v)
+	}
+}
@@ -0,0 +1,98 @@
+package redisworker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// Health 租约健康状态，持有中或有风险时从redis读取key的剩余过期时间，读取只尝试一次，不计入熔断
+func (c *redisConn) Health(ctx context.Context) (workid.Health, error) {
+	health := c.lease.Health()
+	if health.State != workid.LeaseHeld && health.State != workid.LeaseAtRisk {
+		return health, nil
+	}
+	ttl, err := c.pttl(ctx, c.getKey())
+	if err != nil {
+		return health, err
+	}
+	health.TTL = ttl
+	return health, nil
+}
+
+// pttl 当前持有者的key的剩余过期时间，key不存在或已被其它实例占用时为0
+func (c *redisConn) pttl(ctx context.Context, key string) (time.Duration, error) {
+	var replies []redis.Reply
+	err := c.probe(
+		ctx, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			replies, err = conn.Pipeline(ctx, []redis.Cmd{{"GET", key}, {"PTTL", key}})
+			return err
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if len(replies) != 2 {
+		return 0, errors.Errorf("pttl: got %d replies, want 2", len(replies))
+	}
+	if owner, _ := toString(replies[0].Value); owner != c.owner {
+		return 0, nil
+	}
+	ms, err := toInt64(replies[1].Value)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case ms == int64(redis.PTTLNoKey):
+		return 0, nil
+	case ms < 0:
+		return time.Duration(ms), nil
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
+// probe 执行一次只读的探测请求，超时时间与续约相同。不重试，不受熔断限制也不计入熔断，探测失败不会影响续约
+func (c *redisConn) probe(ctx context.Context, fn func(ctx context.Context, conn redis.ContextConn) error) error {
+	return errors.WithStack(c.attempt(ctx, c.timeout, fn))
+}
+
+// Health 租约健康状态，剩余过期时间取超过半数节点仍然有效的时间，即各节点剩余过期时间中第quorum大的值。
+// 可用节点不足多数派时返回按本地时钟估算的值与错误
+func (c *quorumConn) Health(ctx context.Context) (workid.Health, error) {
+	health := c.lease.Health()
+	if health.State != workid.LeaseHeld && health.State != workid.LeaseAtRisk {
+		return health, nil
+	}
+	var (
+		mu   sync.Mutex
+		ttls []time.Duration
+	)
+	granted, _, err := c.each(
+		func(node *redisConn) (bool, error) {
+			ttl, err := node.pttl(ctx, node.getKey())
+			if err != nil {
+				return false, err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ttls = append(ttls, ttl)
+			return true, nil
+		},
+	)
+	if granted < c.quorum {
+		return health, err
+	}
+	sort.Slice(
+		ttls, func(i, j int) bool {
+			return ttls[i] > ttls[j]
+		},
+	)
+	health.TTL = ttls[c.quorum-1]
+	return health, nil
+}
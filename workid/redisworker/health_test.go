@@ -0,0 +1,112 @@
+package redisworker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestConn_Health(t *testing.T) {
+	backend := redistest.NewPool()
+	pool := redistest.NewFaultPool(backend)
+	c := NewRedisWorker("qw-scrm", pool, WithHeartbeat(time.Second*10), WithCircuitBreaker(3, time.Minute)).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if got, err := c.Health(context.TODO()); err != nil || got.State != workid.LeaseNone || got.TTL != 0 {
+		t.Errorf("Health() before GetWorkID = %+v, %v", got, err)
+	}
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	got, err := c.Health(context.TODO())
+	if err != nil || got.WorkID != 0 || got.State != workid.LeaseHeld || got.LastHeartbeat.IsZero() || got.ConsecutiveFailures != 0 {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+	if got.TTL <= c.ttl()-time.Second || got.TTL > c.ttl() {
+		t.Errorf("Health() TTL = %v, want %v", got.TTL, c.ttl())
+	}
+
+	// 连续续约失败的次数，续约成功后清零
+	isRenew := func(call redistest.Call) bool {
+		return call.Script == renewScript
+	}
+	pool.Inject(redistest.OpEval, redistest.Fault{Err: redistest.ErrInjected, Times: 2, Match: isRenew})
+	lastHeartbeat := got.LastHeartbeat
+	for i := 1; i <= 2; i++ {
+		c.heartbeat(context.TODO())
+		got, _ = c.Health(context.TODO())
+		if got.State != workid.LeaseAtRisk || got.ConsecutiveFailures != i || !got.LastHeartbeat.Equal(lastHeartbeat) {
+			t.Errorf("Health() after %d failures = %+v", i, got)
+		}
+	}
+	c.heartbeat(context.TODO())
+	if got, _ = c.Health(context.TODO()); got.State != workid.LeaseHeld || got.ConsecutiveFailures != 0 || !got.LastHeartbeat.After(lastHeartbeat) {
+		t.Errorf("Health() after renew = %+v", got)
+	}
+
+	// 读取失败时返回本地估算的剩余有效时间
+	pool.FailNext(redistest.OpPipeline, 1, redistest.ErrInjected)
+	got, err = c.Health(context.TODO())
+	if !errors.Is(err, redistest.ErrInjected) || got.State != workid.LeaseHeld || got.TTL <= 0 || got.TTL > c.ttl() {
+		t.Errorf("Health() = %+v, %v, want %v", got, err, redistest.ErrInjected)
+	}
+	// 探测失败不计入熔断，熔断期间仍然可以探测
+	pool.Inject(redistest.OpPipeline, redistest.Fault{Err: redistest.ErrInjected, Times: c.breaker.threshold})
+	for i := 0; i < c.breaker.threshold; i++ {
+		_, _ = c.Health(context.TODO())
+	}
+	if got := c.breaker.failures; got != 0 {
+		t.Errorf("failures = %v, want 0", got)
+	}
+	for i := 0; i < c.breaker.threshold; i++ {
+		c.breaker.record(redistest.ErrInjected)
+	}
+	if got, err = c.Health(context.TODO()); err != nil || got.TTL <= 0 {
+		t.Errorf("Health() with circuit open = %+v, %v", got, err)
+	}
+	c.breaker.record(nil)
+	// key被其它实例占用时剩余过期时间为0，不返回其它实例的过期时间
+	key := c.getKey()
+	backend.Set(key, "other", c.ttl())
+	if got, err = c.Health(context.TODO()); err != nil || got.TTL != 0 {
+		t.Errorf("Health() owned by others = %+v, %v", got, err)
+	}
+	backend.Set(key, c.owner, c.ttl())
+	// key被删除后剩余过期时间为0
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if got, err = c.Health(context.TODO()); err != nil || got.TTL != 0 {
+		t.Errorf("Health() after clean = %+v, %v", got, err)
+	}
+}
+
+func TestQuorumConn_Health(t *testing.T) {
+	nodes, faults, pools := newQuorumPools(3)
+	c := NewQuorumWorker("qw-scrm", pools, WithHeartbeat(time.Second*10)).Get(context.TODO()).(*quorumConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	ttl := c.nodes[0].ttl()
+	// 一个节点上的key已丢失，剩余过期时间取多数派仍然有效的时间
+	nodes[0].Del(c.nodes[0].getKey())
+	got, err := c.Health(context.TODO())
+	if err != nil || got.State != workid.LeaseHeld || got.TTL <= ttl-time.Second || got.TTL > ttl {
+		t.Errorf("Health() = %+v, %v, want TTL %v", got, err, ttl)
+	}
+	nodes[1].Set(c.nodes[1].getKey(), c.nodes[1].owner, time.Second)
+	if got, err = c.Health(context.TODO()); err != nil || got.TTL > time.Second {
+		t.Errorf("Health() = %+v, %v, want TTL <= 1s", got, err)
+	}
+
+	// 可用节点不足多数派
+	faults[1].Inject(redistest.OpPipeline, redistest.Fault{Err: redistest.ErrInjected})
+	faults[2].Inject(redistest.OpPipeline, redistest.Fault{Err: redistest.ErrInjected})
+	if got, err = c.Health(context.TODO()); !errors.Is(err, redistest.ErrInjected) || got.TTL <= 0 {
+		t.Errorf("Health() = %+v, %v, want %v", got, err, redistest.ErrInjected)
+	}
+}
@@ -0,0 +1,162 @@
+package redisworker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// metaKeySuffix 元数据key后缀，元数据与workID key同时过期、同时删除
+const metaKeySuffix = ":meta"
+
+// metaKey workID key对应的元数据key。未使用 hash tag 时以workID key作为 hash tag，保证两个key位于redis集群的同一个slot
+func (c *redisConn) metaKey(key string) string {
+	if c.hashTag {
+		return key + metaKeySuffix
+	}
+	return "{" + key + "}" + metaKeySuffix
+}
+
+// leaseMeta 租约元数据，续约时更新
+type leaseMeta struct {
+	Owner         string    `json:"owner"`
+	Hostname      string    `json:"hostname"`
+	PID           int       `json:"pid"`
+	StartedAt     time.Time `json:"startedAt"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	Version       string    `json:"version"`
+}
+
+// meta 当前持有者的元数据
+func (c *redisConn) meta() string {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+	data, _ := json.Marshal(
+		leaseMeta{
+			Owner:         c.owner,
+			Hostname:      hostname(),
+			PID:           os.Getpid(),
+			StartedAt:     started,
+			LastHeartbeat: time.Now(),
+			Version:       workid.Version,
+		},
+	)
+	return string(data)
+}
+
+// List 列出当前应用模块所有有效的租约
+func (c *redisWorker) List(ctx context.Context) ([]workid.LeaseInfo, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.Get(ctx).(*redisConn).list(ctx)
+}
+
+// list 通过脚本一次读取所有被占用的workID及其元数据。redis禁用脚本或集群未使用 hash tag 时通过批量命令读取
+func (c *redisConn) list(ctx context.Context) ([]workid.LeaseInfo, error) {
+	metaPrefix, metaSuffix := c.keyPrefix(), metaKeySuffix
+	if !c.hashTag {
+		metaPrefix, metaSuffix = "{"+metaPrefix, "}"+metaKeySuffix
+	}
+	var result interface{}
+	err := c.do(
+		ctx, OpClaim, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			result, err = conn.Eval(ctx, listScript, []string{c.keyOf(0)}, c.keyPrefix(), c.max(), metaPrefix, metaSuffix)
+			return err
+		},
+	)
+	if isPermanentError(err) {
+		return c.listByPipeline(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	values, ok := result.([]interface{})
+	if !ok && result != nil {
+		return nil, errors.Errorf("unexpected script result %T(%v)", result, result)
+	}
+	leases := make([]workid.LeaseInfo, 0, len(values)/4)
+	for i := 0; i+3 < len(values); i += 4 {
+		lease, err := c.parseLease(ctx, values[i : i+4])
+		if err != nil {
+			return nil, err
+		}
+		if lease.Owner != "" {
+			leases = append(leases, lease)
+		}
+	}
+	return leases, nil
+}
+
+// listByPipeline 通过批量命令读取所有workID key、剩余过期时间及元数据。各key分别读取，结果不是同一时刻的快照
+func (c *redisConn) listByPipeline(ctx context.Context) ([]workid.LeaseInfo, error) {
+	cmds := make([]redis.Cmd, 0, c.max()*3)
+	for i := 0; i < c.max(); i++ {
+		key := c.keyOf(i)
+		cmds = append(cmds, redis.Cmd{"GET", key}, redis.Cmd{"PTTL", key}, redis.Cmd{"GET", c.metaKey(key)})
+	}
+	replies, err := c.pipeline(ctx, OpClaim, cmds)
+	if err != nil {
+		return nil, err
+	}
+	var leases []workid.LeaseInfo
+	for i := 0; i < c.max(); i++ {
+		r := replies[i*3 : i*3+3]
+		if r[0].Value == nil {
+			continue
+		}
+		lease, err := c.parseLease(ctx, []interface{}{int64(i), r[0].Value, r[1].Value, r[2].Value})
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+// parseLease 解析 listScript 返回的一条租约，元数据的持有者与key不一致时(上一个持有者残留)忽略元数据
+func (c *redisConn) parseLease(ctx context.Context, values []interface{}) (lease workid.LeaseInfo, err error) {
+	workID, err := toInt64(values[0])
+	if err != nil {
+		return lease, err
+	}
+	owner, err := toString(values[1])
+	if err != nil {
+		return lease, err
+	}
+	ttl, err := toInt64(values[2])
+	if err != nil {
+		return lease, err
+	}
+	data, err := toString(values[3])
+	if err != nil {
+		return lease, err
+	}
+	lease = workid.LeaseInfo{WorkID: int(workID), Owner: owner, TTL: time.Duration(ttl) * time.Millisecond}
+	if ttl < 0 {
+		lease.TTL = 0
+	}
+	var meta leaseMeta
+	if data == "" {
+		return lease, nil
+	}
+	if err := json.Unmarshal([]byte(data), &meta); err != nil {
+		c.log().WarnContext(ctx, "parse workid lease meta", slog.Int("workID", lease.WorkID), slog.Any("err", err))
+		return lease, nil
+	}
+	if meta.Owner == owner {
+		lease.Hostname = meta.Hostname
+		lease.PID = meta.PID
+		lease.StartedAt = meta.StartedAt
+		lease.LastHeartbeat = meta.LastHeartbeat
+		lease.Version = meta.Version
+	}
+	return lease, nil
+}
@@ -0,0 +1,115 @@
+package redisworker
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestWorker_List(t *testing.T) {
+	clock := redistest.NewFakeClock(time.Unix(0, 0))
+	pool := redistest.NewPool(redistest.WithClock(clock))
+	worker := NewRedisWorker("qw-scrm", pool, WithHeartbeat(time.Second*5))
+	conns := make([]*redisConn, 3)
+	for i := range conns {
+		conns[i] = worker.Get(context.TODO()).(*redisConn)
+		conns[i].timerOnce.Do(func() {})
+		if _, err := conns[i].GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+	}
+	// 其它模块与没有元数据的key
+	other := NewRedisWorker("qw-scrm", pool)
+	other.SetModName("other")
+	c := other.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	pool.Set(conns[0].keyOf(5), "legacy", time.Second*10)
+	// 已释放的workID不再列出
+	if err := conns[1].Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	clock.Advance(time.Second * 3)
+
+	leases, err := worker.List(context.TODO())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var got []int
+	for _, lease := range leases {
+		got = append(got, lease.WorkID)
+	}
+	if want := []int{0, 2, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("List() workIDs = %v, want %v", got, want)
+	}
+	host, _ := os.Hostname()
+	lease := leases[0]
+	if lease.Owner != conns[0].owner || lease.Hostname != host || lease.PID != os.Getpid() ||
+		lease.Version != workid.Version || lease.StartedAt.IsZero() || lease.LastHeartbeat.Before(lease.StartedAt) {
+		t.Errorf("List() lease = %+v", lease)
+	}
+	if lease.TTL != time.Second*8 {
+		t.Errorf("List() TTL = %v, want %v", lease.TTL, time.Second*8)
+	}
+	if want := (workid.LeaseInfo{WorkID: 5, Owner: "legacy", TTL: time.Second * 7}); leases[2] != want {
+		t.Errorf("List() lease = %+v, want %+v", leases[2], want)
+	}
+	if _, ok := pool.Value(conns[1].metaKey(conns[1].getKey())); ok {
+		t.Errorf("Release() meta key not deleted")
+	}
+}
+
+func TestWorker_ListScriptingDisabled(t *testing.T) {
+	pool := redistest.NewPool(redistest.WithScriptingDisabled())
+	worker := NewRedisWorker("qw-scrm", pool, WithUnfencedFallback())
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	pool.Set(c.keyOf(3), "legacy", time.Minute)
+
+	// 禁用脚本时通过批量命令读取
+	leases, err := worker.List(context.TODO())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(leases) != 2 || leases[0].WorkID != 0 || leases[0].Owner != c.owner || leases[1].WorkID != 3 || leases[1].Owner != "legacy" {
+		t.Errorf("List() = %+v", leases)
+	}
+}
+
+func TestConn_listByPipeline(t *testing.T) {
+	clock := redistest.NewFakeClock(time.Unix(0, 0))
+	pool := redistest.NewPool(redistest.WithClock(clock))
+	worker := NewRedisWorker("qw-scrm", pool)
+	for i := 0; i < 3; i++ {
+		c := worker.Get(context.TODO()).(*redisConn)
+		c.timerOnce.Do(func() {})
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+	}
+	pool.Set("workid:qw-scrm:default_mod:7", "legacy", 0)
+	clock.Advance(time.Second)
+
+	c := worker.Get(context.TODO()).(*redisConn)
+	want, err := c.list(context.TODO())
+	if err != nil {
+		t.Fatalf("list() error = %v", err)
+	}
+	got, err := c.listByPipeline(context.TODO())
+	if err != nil {
+		t.Fatalf("listByPipeline() error = %v", err)
+	}
+	if len(got) != 4 || !reflect.DeepEqual(got, want) {
+		t.Errorf("listByPipeline() = %+v, want %+v", got, want)
+	}
+}
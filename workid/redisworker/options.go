@@ -0,0 +1,152 @@
+package redisworker
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidOption 配置错误
+var ErrInvalidOption = errors.New("redisworker配置错误")
+
+// Option NewRedisWorker 可选配置
+type Option func(w *redisWorker)
+
+// ClaimStrategy workID查找策略，决定从哪个workID开始查找空闲的workID
+type ClaimStrategy int
+
+const (
+	ClaimFirst  ClaimStrategy = iota // 从0开始，占用最小的空闲workID
+	ClaimRandom                      // 从随机位置开始，减少多个实例同时启动时的冲突
+	ClaimHashed                      // 从主机名哈希得到的位置开始，同一主机重启后大概率得到相同的workID
+)
+
+// WithClaimStrategy 设置workID查找策略，默认 ClaimFirst
+func WithClaimStrategy(strategy ClaimStrategy) Option {
+	return func(w *redisWorker) {
+		w.strategy = strategy
+	}
+}
+
+// WithStickyIdentity 优先使用由稳定标识推导出的workID，重启后尽量保持workID不变。
+// 标识以"-数字"结尾时(如StatefulSet的pod名 app-3)使用该序号，否则使用标识的哈希值；为空时不生效。
+// 推导出的workID只在空闲时使用，被其它实例(包括同一进程的其它租约)持有时查找其它workID
+func WithStickyIdentity(identity string) Option {
+	return func(w *redisWorker) {
+		w.identity = identity
+	}
+}
+
+// WithStateFile 将获取到的workID与持有者标识保存到本地文件，重启后优先使用文件中的workID，优先级高于 WithStickyIdentity 推导出的workID。
+// 该workID空闲或仍被文件中记录的上一次运行的持有者占用时直接接管，被其它实例或当前进程的其它租约占用时查找其它workID
+func WithStateFile(path string) Option {
+	return func(w *redisWorker) {
+		w.stateFile = path
+	}
+}
+
+// WithRetryPolicy 设置重试策略，ops为空时对占用、续约、释放都生效。默认不重试
+func WithRetryPolicy(policy RetryPolicy, ops ...Operation) Option {
+	return func(w *redisWorker) {
+		if len(ops) == 0 {
+			ops = []Operation{OpClaim, OpRenew, OpRelease}
+		}
+		for _, op := range ops {
+			if op >= OpClaim && op <= OpRelease {
+				w.retry[op] = policy
+			}
+		}
+	}
+}
+
+// WithCircuitBreaker 设置熔断器，redis连续失败threshold次后熔断，cooldown内的请求直接返回 ErrCircuitOpen，避免redis不可用时启动阶段逐个尝试所有workID。默认不熔断
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(w *redisWorker) {
+		if threshold < 1 {
+			threshold = 1
+		}
+		w.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	}
+}
+
+// WithKeyPrefix 设置key前缀，默认 workid:。多个环境共用一个redis时使用不同的前缀避免冲突
+func WithKeyPrefix(prefix string) Option {
+	return func(w *redisWorker) {
+		w.keyPrefix = prefix
+	}
+}
+
+// WithMaxWorkID 设置workID上限，workID取值为[0, max)，默认1024。不能超过雪花算法节点位数允许的范围
+func WithMaxWorkID(max int) Option {
+	return func(w *redisWorker) {
+		w.maxWorkID = max
+	}
+}
+
+// WithHeartbeat 设置心跳时间，默认30s
+func WithHeartbeat(heartbeat time.Duration) Option {
+	return func(w *redisWorker) {
+		w.Heartbeat = heartbeat
+	}
+}
+
+// WithTTL 设置key过期时间，必须大于心跳时间，默认为两倍心跳时间再加1秒
+func WithTTL(ttl time.Duration) Option {
+	return func(w *redisWorker) {
+		w.ttl = ttl
+	}
+}
+
+// WithHashTag key使用 hash tag，格式为 workid:{app:mod}:n，同一应用模块的key位于redis集群的同一个slot，
+// 使用redis集群时必须设置，否则只能逐个尝试占用workID，且不能使用 List。
+// 会改变key的格式，同一应用模块的所有实例必须同时启用，否则同一个workID会被不同格式的key重复占用
+func WithHashTag() Option {
+	return func(w *redisWorker) {
+		w.hashTag = true
+	}
+}
+
+// WithReuseCooldown 设置等待上一个持有者最后时间戳的最长时间，默认5s，为0时不等待。
+// 持有者续约与释放时记录已生成ID的最大时间戳，新的持有者占用workID后等待本地时钟超过该时间戳再返回，
+// 避免实例之间的时钟偏差导致重复ID；需要等待的时间超过maxWait时跳过该workID
+func WithReuseCooldown(maxWait time.Duration) Option {
+	return func(w *redisWorker) {
+		w.cooldown = maxWait
+	}
+}
+
+// WithUnfencedFallback redis禁用脚本(返回 NOSCRIPT 或 ERR unknown command)时仍允许使用workID，租约凭证的纪元为0。
+// 纪元不再递增，依赖纪元拒绝旧持有者写入的存储不能使用。默认无法递增纪元时占用失败并释放workID
+func WithUnfencedFallback() Option {
+	return func(w *redisWorker) {
+		w.unfenced = true
+	}
+}
+
+// WithLogger 设置日志，默认使用 slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *redisWorker) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// validate 校验配置
+func (c *redisWorker) validate() error {
+	switch {
+	case c.keyPrefix == "":
+		return errors.Wrap(ErrInvalidOption, "key prefix is empty")
+	case c.maxWorkID < 1 || c.maxWorkID-1 > snowflake.MaxNodeID():
+		return errors.Wrapf(ErrInvalidOption, "max workid %d out of range [1, %d]", c.maxWorkID, snowflake.MaxNodeID()+1)
+	case c.Heartbeat <= 0:
+		return errors.Wrapf(ErrInvalidOption, "heartbeat %s must be positive", c.Heartbeat)
+	case c.ttl != 0 && c.ttl <= c.Heartbeat:
+		return errors.Wrapf(ErrInvalidOption, "ttl %s must be greater than heartbeat %s", c.ttl, c.Heartbeat)
+	case c.cooldown < 0:
+		return errors.Wrapf(ErrInvalidOption, "reuse cooldown %s must not be negative", c.cooldown)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package redisworker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestNewRedisWorker_options(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantErr    error
+		wantPrefix string
+		wantTTL    time.Duration
+	}{
+		{
+			name:       "test_01",
+			wantPrefix: "workid:qw-scrm:default_mod:",
+			wantTTL:    defaultTTL*2 + time.Second,
+		},
+		{
+			name:       "test_02",
+			opts:       []Option{WithKeyPrefix("staging:workid:"), WithHeartbeat(time.Second * 5), WithTTL(time.Second * 8)},
+			wantPrefix: "staging:workid:qw-scrm:default_mod:",
+			wantTTL:    time.Second * 8,
+		},
+		{
+			name:       "test_03",
+			opts:       []Option{WithHeartbeat(time.Second * 5)},
+			wantPrefix: "workid:qw-scrm:default_mod:",
+			wantTTL:    time.Second * 11,
+		},
+		{
+			name:    "test_04",
+			opts:    []Option{WithKeyPrefix("")},
+			wantErr: ErrInvalidOption,
+		},
+		{
+			name:    "test_05",
+			opts:    []Option{WithMaxWorkID(0)},
+			wantErr: ErrInvalidOption,
+		},
+		{
+			name:    "test_06",
+			opts:    []Option{WithMaxWorkID(maxWorkID + 1)},
+			wantErr: ErrInvalidOption,
+		},
+		{
+			name:    "test_07",
+			opts:    []Option{WithHeartbeat(0)},
+			wantErr: ErrInvalidOption,
+		},
+		{
+			name:    "test_08",
+			opts:    []Option{WithHeartbeat(time.Second * 5), WithTTL(time.Second * 5)},
+			wantErr: ErrInvalidOption,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool(redistest.WithClock(redistest.NewFakeClock(time.Unix(0, 0))))
+				c := NewRedisWorker("qw-scrm", pool, tt.opts...).Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				_, err := c.GetWorkID(context.TODO())
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetWorkID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					if keys := pool.Keys(); len(keys) != 0 {
+						t.Errorf("GetWorkID() invalid option claimed keys %v", keys)
+					}
+					return
+				}
+				if got := c.getKey(); !strings.HasPrefix(got, tt.wantPrefix) {
+					t.Errorf("getKey() = %v, want prefix %v", got, tt.wantPrefix)
+				}
+				if got := pool.TTL(c.getKey()); got != tt.wantTTL {
+					t.Errorf("TTL() = %v, want %v", got, tt.wantTTL)
+				}
+			},
+		)
+	}
+}
+
+func TestWithMaxWorkID(t *testing.T) {
+	pool := redistest.NewPool()
+	worker := NewRedisWorker("qw-scrm", pool, WithMaxWorkID(2))
+	for i := 0; i < 2; i++ {
+		c := worker.Get(context.TODO()).(*redisConn)
+		c.timerOnce.Do(func() {})
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+	}
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err == nil {
+		t.Errorf("GetWorkID() got workid beyond max, keys %v", pool.Keys())
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	backend := redistest.NewPool()
+	pool := redistest.NewFaultPool(backend)
+	worker := NewRedisWorker("qw-scrm", pool, WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	pool.FailNext(redistest.OpEval, 1, nil)
+	c.heartbeat(context.TODO())
+	if !strings.Contains(buf.String(), "heartbeat") {
+		t.Errorf("logger output = %q, want heartbeat warning", buf.String())
+	}
+	// 解析元数据失败的警告同样使用设置的日志
+	backend.Set(c.metaKey(c.getKey()), "{", c.ttl())
+	if _, err := worker.List(context.TODO()); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "parse workid lease meta") {
+		t.Errorf("logger output = %q, want meta warning", buf.String())
+	}
+}
@@ -0,0 +1,50 @@
+package redisworker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// localOwners 当前进程正在使用的持有者标识，接管workID时跳过，同一进程的多个租约不会互相接管。
+// 租约释放或清理后删除，重新占用时再记录，不随创建的租约无限增长
+var localOwners sync.Map
+
+// newOwner 生成持有者标识：稳定标识(默认为主机名):进程号:随机数。续约和释放时比对该值，避免操作已被其它实例占用的workID
+func newOwner(identity string) string {
+	if identity == "" {
+		identity = hostname()
+	}
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	owner := identity + ":" + strconv.Itoa(os.Getpid()) + ":" + hex.EncodeToString(nonce)
+	rememberOwner(owner)
+	return owner
+}
+
+// rememberOwner 记录当前进程正在使用的持有者标识
+func rememberOwner(owner string) {
+	localOwners.Store(owner, struct{}{})
+}
+
+// forgetOwner 删除不再使用的持有者标识
+func forgetOwner(owner string) {
+	localOwners.Delete(owner)
+}
+
+// isLocalOwner 持有者标识是否由当前进程生成
+func isLocalOwner(owner string) bool {
+	_, ok := localOwners.Load(owner)
+	return ok
+}
+
+// hostname 主机名，获取失败时为 unknown
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
@@ -0,0 +1,497 @@
+package redisworker
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/lease"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	clockDriftFactor = 0.01                 // 时钟漂移系数，与Redlock一致
+	clockDriftMin    = time.Millisecond * 2 // 最小时钟漂移
+)
+
+// quorumWorker 多个相互独立的redis节点上按多数派占用workID，参考Redlock
+type quorumWorker struct {
+	workers []*redisWorker // 每个节点一个配置
+	err     error          // 配置错误，获取workID时返回
+}
+
+// NewQuorumWorker 获取多节点workID配置。pools为相互独立的redis节点(不是同一个集群的主从)，建议使用3或5个节点，
+// 超过半数节点占用成功且有效时间大于0时才算占用成功，续约同样需要超过半数节点成功。
+// 单个redis主从切换时可能丢失未同步的key，导致两个实例持有同一个workID，多数派可以避免这种情况。
+// opts对所有节点生效，不支持 WithStateFile 的接管
+func NewQuorumWorker(appName string, pools []redis.Pool, opts ...Option) workid.Worker {
+	w := &quorumWorker{}
+	for _, pool := range pools {
+		w.workers = append(w.workers, NewRedisWorker(appName, pool, opts...).(*redisWorker))
+	}
+	w.err = w.validate(pools)
+	return w
+}
+
+// validate 检查每个节点的配置，所有节点的key与租约配置必须相同
+func (w *quorumWorker) validate(pools []redis.Pool) error {
+	if len(pools) == 0 {
+		return errors.Wrap(ErrInvalidOption, "no redis pool")
+	}
+	for i, worker := range w.workers {
+		switch {
+		case pools[i] == nil:
+			return errors.Wrapf(ErrInvalidOption, "redis pool of node %d is nil", i)
+		case worker.err != nil:
+			return errors.WithMessagef(worker.err, "node %d", i)
+		case !sameLease(w.workers[0], worker):
+			return errors.Wrapf(ErrInvalidOption, "options of node %d differ from node 0", i)
+		}
+	}
+	return nil
+}
+
+// sameLease 两个节点的key与租约配置是否相同
+func sameLease(a, b *redisWorker) bool {
+	return a.AppName == b.AppName && a.ModName == b.ModName && a.Heartbeat == b.Heartbeat &&
+		a.keyPrefix == b.keyPrefix && a.maxWorkID == b.maxWorkID && a.ttl == b.ttl && a.hashTag == b.hashTag &&
+		a.strategy == b.strategy && a.identity == b.identity && a.stateFile == b.stateFile &&
+		a.cooldown == b.cooldown && a.unfenced == b.unfenced
+}
+
+// Get 获取一个租约，调用 Acquire 后才占用workID
+func (w *quorumWorker) Get(ctx context.Context) workid.Lease {
+	c := &quorumConn{err: w.err, timerOnce: new(sync.Once)}
+	if w.err != nil {
+		return c
+	}
+	owner := newOwner(w.workers[0].identity)
+	for _, worker := range w.workers {
+		node := worker.Get(ctx).(*redisConn)
+		// 所有节点使用相同的持有者标识，续约和释放时才能比对
+		forgetOwner(node.owner)
+		node.owner = owner
+		c.nodes = append(c.nodes, node)
+	}
+	c.quorum = len(c.nodes)/2 + 1
+	return c
+}
+
+// SetAppName 设置模块名，对所有节点生效
+func (w *quorumWorker) SetAppName(appName string) {
+	for _, worker := range w.workers {
+		worker.SetAppName(appName)
+	}
+}
+
+// SetModName 设置模块名，对所有节点生效
+func (w *quorumWorker) SetModName(modName string) {
+	for _, worker := range w.workers {
+		worker.SetModName(modName)
+	}
+}
+
+// List 列出超过半数节点上有效的租约，剩余过期时间取各节点的最小值
+func (w *quorumWorker) List(ctx context.Context) ([]workid.LeaseInfo, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	type holder struct {
+		workID int
+		owner  string
+	}
+	var (
+		index  = map[holder]int{} // 在leases中的下标
+		votes  []int
+		leases []workid.LeaseInfo
+		failed int
+		err    error
+	)
+	for _, worker := range w.workers {
+		nodeLeases, e := worker.List(ctx)
+		if e != nil {
+			failed++
+			err = e
+			continue
+		}
+		for _, lease := range nodeLeases {
+			h := holder{workID: lease.WorkID, owner: lease.Owner}
+			i, ok := index[h]
+			if !ok {
+				index[h] = len(leases)
+				leases, votes = append(leases, lease), append(votes, 0)
+				i = len(leases) - 1
+			}
+			votes[i]++
+			if lease.TTL < leases[i].TTL {
+				leases[i].TTL = lease.TTL
+			}
+		}
+	}
+	quorum := len(w.workers)/2 + 1
+	if len(w.workers)-failed < quorum {
+		return nil, err
+	}
+	result := make([]workid.LeaseInfo, 0, len(leases))
+	for i, lease := range leases {
+		if votes[i] >= quorum {
+			result = append(result, lease)
+		}
+	}
+	sort.Slice(
+		result, func(i, j int) bool {
+			return result[i].WorkID < result[j].WorkID
+		},
+	)
+	return result, nil
+}
+
+// quorumConn 多节点workID连接
+type quorumConn struct {
+	id        int          // 当前占用的workID，通过 currentID 读取
+	nodes     []*redisConn // 每个节点一个连接
+	quorum    int          // 多数派节点数
+	err       error        // 配置错误
+	timerOnce *sync.Once
+	acquireMu sync.Mutex    // 串行占用，并发 Acquire 时只占用一个workID
+	lease     lease.Tracker // 租约状态
+	mu        sync.Mutex    // 保护 id、closed、token、stop、done
+	closed    bool          // 已释放
+	token     workid.Token  // 租约凭证
+	stop      chan struct{} // 关闭后心跳协程退出
+	done      chan struct{} // 心跳协程退出后关闭
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *quorumConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 占用workID，超过半数节点占用成功且扣除耗时与时钟漂移后仍在有效期内才算成功。
+// 已占用时返回持有的workID，不会重复占用，租约已丢失时同时返回 workid.ErrLeaseLost，实现 workid.Lease
+func (c *quorumConn) Acquire(ctx context.Context) (int, error) {
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.isClosed() {
+		return 0, workid.ErrConnClosed
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	if workID, ok, err := c.lease.Acquired(); ok {
+		return workID, err
+	}
+	// 清理后重新占用时再次记录
+	rememberOwner(c.nodes[0].owner)
+	workID, start, err := c.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	epoch, err := c.incrEpoch(ctx, workID)
+	if c.nodes[0].unfenced && isScriptingUnavailable(err) {
+		c.nodes[0].log().WarnContext(ctx, "increase workid epoch, fallback to unfenced lease", slog.Int("workID", workID), slog.Any("err", err))
+		epoch, err = 0, nil
+	}
+	if err != nil {
+		_, _ = c.release(ctx, workID)
+		return 0, err
+	}
+	c.mu.Lock()
+	c.id = workID
+	c.mu.Unlock()
+	c.setToken(workid.Token{WorkID: workID, Epoch: epoch, Owner: c.nodes[0].owner, AcquiredAt: start})
+	for _, node := range c.nodes {
+		node.setID(workID, start)
+	}
+	c.lease.Held(workID, start, c.validity())
+	// 写入元数据，只用于查看，失败不影响使用；成功时同时续约，占用后可能等待过上一个持有者的最后时间戳
+	renewStart := time.Now()
+	granted, _, _ := c.each(
+		func(node *redisConn) (bool, error) {
+			return node.expire(ctx, node.getKey(), node.ttl())
+		},
+	)
+	if granted >= c.quorum && time.Since(renewStart) < c.validity() {
+		c.lease.Held(workID, renewStart, c.validity())
+	}
+	c.nodes[0].saveState(ctx, workID)
+	c.startTimer(ctx)
+	return workID, nil
+}
+
+// claim 依次尝试占用workID，优先使用本地状态文件中的workID
+func (c *quorumConn) claim(ctx context.Context) (workID int, start time.Time, err error) {
+	first := c.nodes[0]
+	max, offset := first.max(), first.claimOffset()
+	candidates := make([]int, 0, max+1)
+	if preferred, _, ok := first.preferredWorkID(); ok {
+		candidates = append(candidates, preferred)
+	}
+	for i := 0; i < max; i++ {
+		candidates = append(candidates, (offset+i)%max)
+	}
+
+	for _, workID := range candidates {
+		start = time.Now()
+		granted, denied, err := c.each(
+			func(node *redisConn) (bool, error) {
+				return node.add(ctx, node.keyOf(workID), node.owner)
+			},
+		)
+		if granted >= c.quorum && time.Since(start) < c.validity() {
+			ok, err := c.nodes[0].cooldown(
+				ctx, workID, func() (int64, error) {
+					return c.previousTimestamp(ctx, workID)
+				},
+			)
+			if ok {
+				return workID, start, nil
+			}
+			if err != nil {
+				_, _ = c.release(ctx, workID)
+				return 0, start, err
+			}
+		}
+		// 未达到多数派、已超过有效期或需要等待太久，释放已占用的节点
+		_, _ = c.release(ctx, workID)
+		if granted+denied < c.quorum {
+			// 可用节点不足多数派，继续尝试其它workID也不会成功
+			return 0, start, err
+		}
+		if ctx.Err() != nil {
+			return 0, start, errors.WithStack(ctx.Err())
+		}
+	}
+	return 0, start, errors.Wrap(workid.ErrNoWorkIDAvailable, "quorum not reached")
+}
+
+// previousTimestamp 上一个持有者的最后时间戳，取超过半数节点中的最大值。上一个持有者续约时写入了多数派，任意多数派中至少有一个节点是最新的值
+func (c *quorumConn) previousTimestamp(ctx context.Context, workID int) (int64, error) {
+	return c.maxOf(
+		func(node *redisConn) (int64, error) {
+			return node.previousTimestamp(ctx, workID)
+		},
+	)
+}
+
+// validity 租约有效时间：TTL扣除时钟漂移，调用方以发起请求前的时间为起点，即扣除了请求耗时
+func (c *quorumConn) validity() time.Duration {
+	ttl := c.nodes[0].ttl()
+	return ttl - time.Duration(float64(ttl)*clockDriftFactor) - clockDriftMin
+}
+
+// each 并发在所有节点执行，返回成功、明确失败的节点数与第一个错误
+func (c *quorumConn) each(fn func(node *redisConn) (bool, error)) (granted, denied int, err error) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, node := range c.nodes {
+		wg.Add(1)
+		go func(node *redisConn) {
+			defer wg.Done()
+			ok, e := fn(node)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case e != nil:
+				if err == nil {
+					err = e
+				}
+			case ok:
+				granted++
+			default:
+				denied++
+			}
+		}(node)
+	}
+	wg.Wait()
+	return granted, denied, err
+}
+
+// release 在所有节点删除当前持有者的key，返回删除成功的节点数
+func (c *quorumConn) release(ctx context.Context, workID int) (int, error) {
+	granted, denied, err := c.each(
+		func(node *redisConn) (bool, error) {
+			return node.releaseKey(ctx, node.keyOf(workID), node.lastTS.Load())
+		},
+	)
+	if granted+denied >= c.quorum {
+		err = nil
+	}
+	return granted, err
+}
+
+// ID 当前持有的workID，未占用、租约已丢失或已释放时返回false，实现 workid.Lease
+func (c *quorumConn) ID() (int, bool) {
+	return c.lease.ID()
+}
+
+// Renew 立即在所有节点续约一次，不影响定时心跳，实现 workid.Lease
+func (c *quorumConn) Renew(ctx context.Context) error {
+	if c.isClosed() {
+		return workid.ErrConnClosed
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if err := c.lease.Renewable(); err != nil {
+		return err
+	}
+	return c.renew(ctx)
+}
+
+// heartbeat 心跳
+func (c *quorumConn) heartbeat(ctx context.Context) {
+	_ = c.renew(ctx)
+}
+
+// renew 续约，超过半数节点续约成功为持有，超过半数节点明确不再持有为丢失，其它情况为有风险
+func (c *quorumConn) renew(ctx context.Context) error {
+	start := time.Now()
+	workID := c.currentID()
+	granted, denied, err := c.each(
+		func(node *redisConn) (bool, error) {
+			return node.expire(ctx, node.getKey(), node.ttl())
+		},
+	)
+	logger := c.nodes[0].log()
+	switch {
+	case granted >= c.quorum && time.Since(start) < c.validity():
+		c.lease.Held(workID, start, c.validity())
+		return nil
+	case denied > len(c.nodes)-c.quorum:
+		c.lease.Lose()
+		logger.ErrorContext(ctx, "heartbeat: workid key not exists or owned by others on majority", slog.Int("workID", workID), slog.Int("denied", denied))
+		return workid.NewLeaseError("renew", workID, workid.ErrLeaseLost)
+	default:
+		c.lease.Fail()
+		logger.WarnContext(
+			ctx, "heartbeat: quorum not reached", slog.Int("workID", workID), slog.Int("granted", granted),
+			slog.Any("state", c.lease.Current()), slog.Any("err", err),
+		)
+		if err == nil {
+			err = errors.Errorf("renew workid[%d]: quorum not reached, granted by %d nodes", workID, granted)
+		}
+		return err
+	}
+}
+
+// startTimer 启动定时器，心跳不受调用方ctx取消的影响，通过 Release 停止
+func (c *quorumConn) startTimer(ctx context.Context) {
+	c.timerOnce.Do(
+		func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			c.stop, c.done = make(chan struct{}), make(chan struct{})
+			go lease.KeepAlive(context.WithoutCancel(ctx), c.nodes[0].timeout, c.stop, c.done, c.heartbeat, &c.lease, c.nodes[0].log())
+		},
+	)
+}
+
+// CleanWorkID 停止心跳并在所有节点删除workID，超过半数节点上的key已不属于当前持有者时返回 workid.ErrLeaseNotOwned。
+// 租约回到未持有状态，之后可以通过 Acquire 重新占用
+func (c *quorumConn) CleanWorkID(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	defer forgetOwner(c.nodes[0].owner)
+	if c.stopHeartbeat(ctx) {
+		// 重新占用时再启动心跳
+		c.timerOnce = new(sync.Once)
+	}
+	c.lease.Reset()
+	c.setToken(workid.Token{})
+	workID := c.currentID()
+	granted, err := c.release(ctx, workID)
+	if err != nil {
+		return err
+	}
+	if granted < c.quorum {
+		return workid.NewLeaseError("clean", workID, workid.ErrLeaseNotOwned)
+	}
+	return nil
+}
+
+// Release 释放workID：停止心跳并在所有节点删除key，之后再获取workID返回 workid.ErrConnClosed
+func (c *quorumConn) Release(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	if len(c.nodes) > 0 {
+		defer forgetOwner(c.nodes[0].owner)
+	}
+
+	c.stopHeartbeat(ctx)
+	state := c.lease.Current()
+	c.lease.Release()
+	c.setToken(workid.Token{})
+	if state != workid.LeaseHeld && state != workid.LeaseAtRisk {
+		return nil
+	}
+	ctx, cancel := lease.CleanupContext(ctx)
+	defer cancel()
+	_, err := c.release(ctx, c.currentID())
+	return err
+}
+
+// stopHeartbeat 停止心跳协程并等待退出，ctx结束时不再等待，返回心跳是否启动过
+func (c *quorumConn) stopHeartbeat(ctx context.Context) bool {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.nodes[0].log().WarnContext(ctx, "wait for heartbeat to stop", slog.Any("err", ctx.Err()))
+	}
+	return true
+}
+
+// currentID 当前占用的workID
+func (c *quorumConn) currentID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+func (c *quorumConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// LeaseState 获取租约状态
+func (c *quorumConn) LeaseState() workid.LeaseState {
+	return c.lease.Current()
+}
+
+// ObserveTimestamp 记录已生成ID的时间戳，续约与释放时写入所有节点，实现 workid.TimestampObserver
+func (c *quorumConn) ObserveTimestamp(ms int64) {
+	for _, node := range c.nodes {
+		node.ObserveTimestamp(ms)
+	}
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *quorumConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	c.lease.Listen(fn)
+}
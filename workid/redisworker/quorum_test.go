@@ -0,0 +1,378 @@
+package redisworker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+// newQuorumPools 新建n个相互独立的内存节点
+func newQuorumPools(n int) ([]*redistest.Pool, []*redistest.FaultPool, []redis.Pool) {
+	var (
+		nodes  []*redistest.Pool
+		faults []*redistest.FaultPool
+		pools  []redis.Pool
+	)
+	for i := 0; i < n; i++ {
+		node := redistest.NewPool()
+		fault := redistest.NewFaultPool(node)
+		nodes, faults, pools = append(nodes, node), append(faults, fault), append(pools, fault)
+	}
+	return nodes, faults, pools
+}
+
+func TestNewQuorumWorker(t *testing.T) {
+	_, _, pools := newQuorumPools(3)
+	tests := []struct {
+		name    string
+		pools   []redis.Pool
+		opts    func() []Option
+		wantErr bool
+	}{
+		{
+			name:  "test_01",
+			pools: pools,
+		},
+		{
+			name:    "test_02",
+			wantErr: true,
+		},
+		{
+			// 任一节点的连接池为空
+			name:    "test_03",
+			pools:   []redis.Pool{pools[0], nil, pools[2]},
+			wantErr: true,
+		},
+		{
+			// 任一节点配置错误
+			name:  "test_04",
+			pools: pools,
+			opts: func() []Option {
+				n := 0
+				return []Option{
+					func(w *redisWorker) {
+						if n++; n == 3 {
+							w.keyPrefix = ""
+						}
+					},
+				}
+			},
+			wantErr: true,
+		},
+		{
+			// 节点之间的配置不同
+			name:  "test_05",
+			pools: pools,
+			opts: func() []Option {
+				n := 0
+				return []Option{
+					func(w *redisWorker) {
+						n++
+						w.ModName = "mod" + strconv.Itoa(n)
+					},
+				}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var opts []Option
+				if tt.opts != nil {
+					opts = tt.opts()
+				}
+				w := NewQuorumWorker("qw-scrm", tt.pools, opts...).(*quorumWorker)
+				if (w.err != nil) != tt.wantErr || tt.wantErr && !errors.Is(w.err, ErrInvalidOption) {
+					t.Errorf("NewQuorumWorker() error = %v, wantErr %v", w.err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestQuorumConn_GetWorkID(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(nodes []*redistest.Pool, faults []*redistest.FaultPool)
+		want    int
+		wantErr error
+	}{
+		{
+			name: "test_01",
+			want: 0,
+		},
+		{
+			// 一个节点不可用仍能达到多数派
+			name: "test_02",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool) {
+				faults[2].Inject(redistest.OpGet, redistest.Fault{Err: redistest.ErrInjected})
+			},
+			want: 0,
+		},
+		{
+			// 只在一个节点上被占用，仍可以在多数派上占用
+			name: "test_03",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool) {
+				nodes[0].Set("workid:qw-scrm:default_mod:0", "other", 0)
+			},
+			want: 0,
+		},
+		{
+			// 在多数派上被占用，使用下一个workID
+			name: "test_04",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool) {
+				nodes[0].Set("workid:qw-scrm:default_mod:0", "other", 0)
+				nodes[1].Set("workid:qw-scrm:default_mod:0", "other", 0)
+			},
+			want: 1,
+		},
+		{
+			name: "test_05",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool) {
+				faults[1].Inject(redistest.OpGet, redistest.Fault{Err: redistest.ErrInjected})
+				faults[2].Inject(redistest.OpGet, redistest.Fault{Err: redistest.ErrInjected})
+			},
+			wantErr: redistest.ErrInjected,
+		},
+		{
+			// 任一节点上记录的最后时间戳太靠后都跳过该workID
+			name: "test_06",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool) {
+				last := strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)
+				nodes[2].Set("{workid:qw-scrm:default_mod:0}:last", last, time.Hour)
+			},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				nodes, faults, pools := newQuorumPools(3)
+				if tt.setup != nil {
+					tt.setup(nodes, faults)
+				}
+				c := NewQuorumWorker("qw-scrm", pools).Get(context.TODO()).(*quorumConn)
+				c.timerOnce.Do(func() {})
+				got, err := c.GetWorkID(context.TODO())
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetWorkID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					for i, node := range nodes {
+						if _, ok := node.Value("workid:qw-scrm:default_mod:0"); ok {
+							t.Errorf("GetWorkID() node %d key not released", i)
+						}
+					}
+					return
+				}
+				if got != tt.want {
+					t.Errorf("GetWorkID() got = %v, want %v", got, tt.want)
+				}
+				var held int
+				for _, node := range nodes {
+					if v, _ := node.Value(c.nodes[0].getKey()); v == c.nodes[0].owner {
+						held++
+					}
+				}
+				if held < c.quorum {
+					t.Errorf("GetWorkID() held on %d nodes, want >= %d", held, c.quorum)
+				}
+				if got := c.LeaseState(); got != workid.LeaseHeld {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+				}
+			},
+		)
+	}
+}
+
+func TestQuorumConn_validity(t *testing.T) {
+	_, faults, pools := newQuorumPools(3)
+	// 占用耗时超过TTL，即使多数派占用成功也已失效
+	for _, fault := range faults {
+		fault.Inject(redistest.OpSetNX, redistest.Fault{Latency: time.Millisecond * 60})
+	}
+	worker := NewQuorumWorker("qw-scrm", pools, WithMaxWorkID(2), WithHeartbeat(time.Millisecond*10), WithTTL(time.Millisecond*50))
+	c := worker.Get(context.TODO()).(*quorumConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+	if want := time.Millisecond*50 - time.Microsecond*500 - clockDriftMin; c.validity() != want {
+		t.Errorf("validity() = %v, want %v", c.validity(), want)
+	}
+}
+
+func TestQuorumConn_heartbeat(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(nodes []*redistest.Pool, faults []*redistest.FaultPool, key string)
+		want  workid.LeaseState
+	}{
+		{
+			name: "test_01",
+			want: workid.LeaseHeld,
+		},
+		{
+			name: "test_02",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool, key string) {
+				nodes[0].Del(key)
+			},
+			want: workid.LeaseHeld,
+		},
+		{
+			name: "test_03",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool, key string) {
+				nodes[0].Del(key)
+				nodes[1].Set(key, "other", 0)
+			},
+			want: workid.LeaseLost,
+		},
+		{
+			name: "test_04",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool, key string) {
+				faults[0].FailNext(redistest.OpEval, 1, nil)
+				faults[1].FailNext(redistest.OpEval, 1, nil)
+			},
+			want: workid.LeaseAtRisk,
+		},
+		{
+			name: "test_05",
+			setup: func(nodes []*redistest.Pool, faults []*redistest.FaultPool, key string) {
+				nodes[0].Del(key)
+				faults[1].FailNext(redistest.OpEval, 1, nil)
+			},
+			want: workid.LeaseAtRisk,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				nodes, faults, pools := newQuorumPools(3)
+				c := NewQuorumWorker("qw-scrm", pools).Get(context.TODO()).(*quorumConn)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if tt.setup != nil {
+					tt.setup(nodes, faults, c.nodes[0].getKey())
+				}
+				c.heartbeat(context.TODO())
+				if got := c.LeaseState(); got != tt.want {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestQuorumWorker_ListRelease(t *testing.T) {
+	nodes, faults, pools := newQuorumPools(3)
+	worker := NewQuorumWorker("qw-scrm", pools)
+	c := worker.Get(context.TODO()).(*quorumConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	// 只在一个节点上存在的key不是有效租约
+	nodes[2].Set("workid:qw-scrm:default_mod:7", "other", 0)
+	faults[0].FailNext(redistest.OpGet, 1, nil)
+	leases, err := worker.List(context.TODO())
+	if err != nil || len(leases) != 1 || leases[0].WorkID != 0 || leases[0].Owner != c.nodes[0].owner {
+		t.Errorf("List() = %+v, %v", leases, err)
+	}
+
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	for i, node := range nodes {
+		if _, ok := node.Value(c.nodes[0].getKey()); ok {
+			t.Errorf("Release() node %d key not deleted", i)
+		}
+	}
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	if _, err := NewQuorumWorker("qw-scrm", nil).Get(context.TODO()).GetWorkID(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestQuorumConn_Acquire(t *testing.T) {
+	nodes, faults, pools := newQuorumPools(3)
+	worker := NewQuorumWorker("qw-scrm", pools)
+	lease := worker.Get(context.TODO())
+	lease.(*quorumConn).timerOnce.Do(func() {})
+	for i := 0; i < 2; i++ {
+		if got, err := lease.Acquire(context.TODO()); got != 0 || err != nil {
+			t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+		}
+	}
+	if leases, err := worker.List(context.TODO()); err != nil || len(leases) != 1 {
+		t.Errorf("List() = %+v, %v, want 1 lease", leases, err)
+	}
+	// 少数节点失败不影响续约
+	faults[0].FailNext(redistest.OpEval, 1, nil)
+	if err := lease.Renew(context.TODO()); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	// 多数节点的key被删除后续约判定为丢失
+	key := lease.(*quorumConn).nodes[0].getKey()
+	nodes[0].Del(key)
+	nodes[1].Del(key)
+	if err := lease.Renew(context.TODO()); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if _, ok := lease.ID(); ok {
+		t.Errorf("ID() ok after lease lost")
+	}
+	if err := lease.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestQuorumConn_CleanWorkID(t *testing.T) {
+	// 清理后停止心跳，其它实例占用同一个workID时不会冲突
+	nodes, _, pools := newQuorumPools(3)
+	c := NewQuorumWorker("qw-scrm", pools, WithMaxWorkID(1), WithHeartbeat(time.Millisecond*10)).Get(context.TODO()).(*quorumConn)
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+
+	other := NewQuorumWorker("qw-scrm", pools, WithMaxWorkID(1), WithHeartbeat(time.Millisecond*10)).Get(context.TODO()).(*quorumConn)
+	if got, err := other.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() other = %v, %v, want 0", got, err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	for i, node := range nodes {
+		if v, _ := node.Value(c.nodes[0].keyOf(0)); v != other.nodes[0].owner {
+			t.Errorf("node %d key = %v, want %v", i, v, other.nodes[0].owner)
+		}
+	}
+	if _, err := c.Acquire(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	// 其它实例释放后可以重新占用
+	if err := other.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() other error = %v", err)
+	}
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() after clean = %v, %v, want 0", got, err)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
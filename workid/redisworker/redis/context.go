@@ -0,0 +1,212 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrConnBroken 连接上有ctx结束后仍未完成的调用，该连接不能再使用
+var ErrConnBroken = errors.New("redis: conn has an abandoned call in flight")
+
+// NewContextPool 将 Pool 转换为 ContextPool，已实现 ContextPool 时原样返回。
+// 兼容的连接在调用前检查ctx，调用期间ctx取消或超时时不再等待结果直接返回，未完成的调用在后台继续执行。
+// 此后该连接返回 ErrConnBroken，Close 在未完成的调用结束后才归还连接，连接池不会把执行中的连接交给其它调用
+func NewContextPool(pool Pool) ContextPool {
+	if p, ok := pool.(ContextPool); ok {
+		return p
+	}
+	return &contextPool{pool}
+}
+
+// contextPool 兼容只实现 Pool 的连接池
+type contextPool struct {
+	Pool
+}
+
+func (p *contextPool) GetContext(ctx context.Context) (ContextConn, error) {
+	conn, err := p.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &contextConn{conn: conn}, nil
+}
+
+// contextConn 兼容只实现 Conn 的连接
+type contextConn struct {
+	conn     Conn
+	mu       sync.Mutex
+	inflight chan struct{} // 未完成的调用结束后关闭，为nil时没有未完成的调用
+}
+
+func (c *contextConn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return await(
+		ctx, c, func() (bool, error) {
+			return c.conn.SetNX(key, value, ttl)
+		},
+	)
+}
+
+func (c *contextConn) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return await(
+		ctx, c, func() (bool, error) {
+			return c.conn.Expire(key, ttl)
+		},
+	)
+}
+
+func (c *contextConn) Del(ctx context.Context, key string) (int64, error) {
+	return await(
+		ctx, c, func() (int64, error) {
+			return c.conn.Del(key)
+		},
+	)
+}
+
+func (c *contextConn) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	return await(
+		ctx, c, func() (time.Duration, error) {
+			return c.conn.PTTL(key)
+		},
+	)
+}
+
+func (c *contextConn) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return await(
+		ctx, c, func() (interface{}, error) {
+			return c.conn.Eval(script, keys, args...)
+		},
+	)
+}
+
+func (c *contextConn) Pipeline(ctx context.Context, cmds []Cmd) ([]Reply, error) {
+	return await(
+		ctx, c, func() ([]Reply, error) {
+			return c.conn.Pipeline(cmds)
+		},
+	)
+}
+
+// Close 关闭连接，有未完成的调用时在调用结束后关闭，不等待
+func (c *contextConn) Close() error {
+	c.mu.Lock()
+	inflight := c.inflight
+	c.mu.Unlock()
+	if inflight == nil {
+		return c.conn.Close()
+	}
+	go func() {
+		<-inflight
+		_ = c.conn.Close()
+	}()
+	return nil
+}
+
+// await 与 Await 相同，ctx结束时未完成的调用记录在连接上，之后的调用返回 ErrConnBroken
+func await[T any](ctx context.Context, c *contextConn, fn func() (T, error)) (T, error) {
+	var zero T
+	c.mu.Lock()
+	broken := c.inflight != nil
+	c.mu.Unlock()
+	if broken {
+		return zero, errors.WithStack(ErrConnBroken)
+	}
+	if ctx == nil || ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	var (
+		value T
+		err   error
+	)
+	done := make(chan struct{})
+	c.mu.Lock()
+	c.inflight = done
+	c.mu.Unlock()
+	go func() {
+		defer close(done)
+		value, err = fn()
+	}()
+	select {
+	case <-done:
+		c.mu.Lock()
+		c.inflight = nil
+		c.mu.Unlock()
+		return value, err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// BindContext 将 ContextConn 转换为 Conn，所有调用使用同一个ctx，用于适配器实现 Pool.Get
+func BindContext(ctx context.Context, conn ContextConn) Conn {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &boundConn{ctx: ctx, conn: conn}
+}
+
+// boundConn 使用固定ctx的连接
+type boundConn struct {
+	ctx  context.Context
+	conn ContextConn
+}
+
+func (c *boundConn) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	return c.conn.SetNX(c.ctx, key, value, ttl)
+}
+
+func (c *boundConn) Expire(key string, ttl time.Duration) (bool, error) {
+	return c.conn.Expire(c.ctx, key, ttl)
+}
+
+func (c *boundConn) Del(key string) (int64, error) {
+	return c.conn.Del(c.ctx, key)
+}
+
+func (c *boundConn) PTTL(key string) (time.Duration, error) {
+	return c.conn.PTTL(c.ctx, key)
+}
+
+func (c *boundConn) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.conn.Eval(c.ctx, script, keys, args...)
+}
+
+func (c *boundConn) Pipeline(cmds []Cmd) ([]Reply, error) {
+	return c.conn.Pipeline(c.ctx, cmds)
+}
+
+func (c *boundConn) Close() error {
+	return c.conn.Close()
+}
+
+// Await 执行不支持ctx的调用，ctx已结束时不执行，执行期间ctx取消或超时时不再等待，返回ctx的错误。
+// 用于客户端本身不支持按调用取消的情况，未完成的调用在后台继续执行直到客户端自身超时
+func Await[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	var zero T
+	if ctx == nil || ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,180 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingPool 只实现 Pool 的连接池，SetNX 阻塞到 release 关闭
+type blockingPool struct {
+	release chan struct{}
+}
+
+func (p *blockingPool) Get(_ context.Context) (Conn, error) {
+	return &blockingConn{release: p.release}, nil
+}
+
+type blockingConn struct {
+	Conn
+	release chan struct{}
+}
+
+func (c *blockingConn) SetNX(_, _ string, _ time.Duration) (bool, error) {
+	<-c.release
+	return true, nil
+}
+
+func (c *blockingConn) Close() error {
+	return nil
+}
+
+func TestNewContextPool(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		want    bool
+		wantErr error
+	}{
+		{
+			name: "test_01",
+			want: true,
+		},
+		{
+			// 调用期间ctx超时，不再等待结果
+			name:    "test_02",
+			timeout: time.Millisecond * 10,
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			// 调用前ctx已结束，不执行
+			name:    "test_03",
+			timeout: -1,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				release := make(chan struct{})
+				defer close(release)
+				pool := NewContextPool(&blockingPool{release: release})
+				if NewContextPool(pool) != pool {
+					t.Errorf("NewContextPool() wrapped a ContextPool again")
+				}
+				conn, err := pool.GetContext(context.TODO())
+				if err != nil {
+					t.Fatalf("GetContext() error = %v", err)
+				}
+				ctx := context.TODO()
+				if tt.timeout != 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				} else {
+					go func() {
+						release <- struct{}{}
+					}()
+				}
+				got, err := conn.SetNX(ctx, "k1", "v1", time.Second)
+				if got != tt.want || !errors.Is(err, tt.wantErr) {
+					t.Errorf("SetNX() = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+// closeConn SetNX 阻塞到 release 关闭，Close 时关闭 closed
+type closeConn struct {
+	blockingConn
+	closed chan struct{}
+}
+
+func (c *closeConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestContextConn_Close(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr error
+	}{
+		{
+			// 调用已完成，立即关闭
+			name: "test_01",
+		},
+		{
+			// ctx超时后调用仍在执行，调用结束后才关闭，期间连接不能再使用
+			name:    "test_02",
+			timeout: time.Millisecond * 10,
+			wantErr: ErrConnBroken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				release := make(chan struct{})
+				raw := &closeConn{blockingConn: blockingConn{release: release}, closed: make(chan struct{})}
+				conn := &contextConn{conn: raw}
+				ctx := context.TODO()
+				if tt.timeout != 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				} else {
+					close(release)
+				}
+				_, _ = conn.SetNX(ctx, "k1", "v1", time.Second)
+				if _, err := conn.SetNX(context.TODO(), "k1", "v1", time.Second); !errors.Is(err, tt.wantErr) {
+					t.Errorf("SetNX() error = %v, want %v", err, tt.wantErr)
+				}
+				if err := conn.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+				if tt.wantErr != nil {
+					select {
+					case <-raw.closed:
+						t.Fatalf("Close() closed the conn with a call in flight")
+					case <-time.After(time.Millisecond * 10):
+					}
+					close(release)
+				}
+				select {
+				case <-raw.closed:
+				case <-time.After(time.Second):
+					t.Errorf("Close() did not close the conn")
+				}
+			},
+		)
+	}
+}
+
+// recordConn 记录调用时ctx的连接
+type recordConn struct {
+	ContextConn
+	ctx context.Context
+}
+
+func (c *recordConn) Del(ctx context.Context, _ string) (int64, error) {
+	c.ctx = ctx
+	return 1, nil
+}
+
+func TestBindContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.TODO(), key{}, "v")
+	conn := &recordConn{}
+	if _, err := BindContext(ctx, conn).Del("k1"); err != nil {
+		t.Fatalf("Del() error = %v", err)
+	}
+	if conn.ctx != ctx {
+		t.Errorf("Del() ctx = %v, want %v", conn.ctx, ctx)
+	}
+	if _, err := BindContext(nil, conn).Del("k1"); err != nil || conn.ctx == nil {
+		t.Errorf("Del() ctx = %v, %v", conn.ctx, err)
+	}
+}
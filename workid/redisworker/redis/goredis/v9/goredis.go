@@ -4,48 +4,115 @@ import (
 	"context"
 	"time"
 
-	redisWorker "github.com/gosharedlib/idgenerator/workid/redisworker/redis"
+	redisWorker "github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 	"github.com/redis/go-redis/v9"
 )
 
 // pool 连接池信息
 type pool struct {
 	// redis连接
-	delegate *redis.Client
+	delegate redis.Cmdable
 }
 
-// Get 获取redis连接
+// Get 获取redis连接，连接的所有调用使用ctx
 func (p *pool) Get(ctx context.Context) (redisWorker.Conn, error) {
-	if ctx == nil {
-		ctx = context.Background()
-	}
-	return &conn{p.delegate, ctx}, nil
+	return redisWorker.BindContext(ctx, &conn{p.delegate}), nil
+}
+
+// GetContext 获取redis连接，连接的每次调用使用调用时的ctx
+func (p *pool) GetContext(_ context.Context) (redisWorker.ContextConn, error) {
+	return &conn{p.delegate}, nil
 }
 
-// NewPool 新建连接池
-func NewPool(delegate *redis.Client) redisWorker.Pool {
+// NewPool 新建连接池，支持 *redis.Client、*redis.ClusterClient、*redis.Ring 及 redis.UniversalClient。
+// 使用集群时需要配合 redisworker.WithHashTag，使同一应用模块的key位于同一个slot
+func NewPool(delegate redis.Cmdable) redisWorker.ContextPool {
 	return &pool{delegate: delegate}
 }
 
-// conn 标准连接实现
+// conn 标准连接实现。客户端未开启 ContextTimeoutEnabled 时读写不使用ctx的超时，通过 redisWorker.Await 在ctx结束时停止等待
 type conn struct {
-	delegate *redis.Client
-	ctx      context.Context
+	delegate redis.Cmdable
+}
+
+func (c *conn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	return redisWorker.Await(
+		ctx, func() (bool, error) {
+			result, err := c.delegate.SetNX(ctx, key, value, ttl).Result()
+			return result, noErrNil(err)
+		},
+	)
+}
+
+func (c *conn) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return redisWorker.Await(
+		ctx, func() (bool, error) {
+			result, err := c.delegate.Expire(ctx, key, ttl).Result()
+			return result, noErrNil(err)
+		},
+	)
 }
 
-func (c *conn) SetNX(key, value string, ttl time.Duration) (bool, error) {
-	result, err := c.delegate.SetNX(c.ctx, key, value, ttl).Result()
-	return result, noErrNil(err)
+func (c *conn) Del(ctx context.Context, key string) (int64, error) {
+	return redisWorker.Await(
+		ctx, func() (int64, error) {
+			result, err := c.delegate.Del(ctx, key).Result()
+			return result, noErrNil(err)
+		},
+	)
 }
 
-func (c *conn) Expire(key string, ttl time.Duration) (bool, error) {
-	result, err := c.delegate.Expire(c.ctx, key, ttl).Result()
-	return result, noErrNil(err)
+func (c *conn) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	return redisWorker.Await(
+		ctx, func() (time.Duration, error) {
+			result, err := c.delegate.PTTL(ctx, key).Result()
+			return result, noErrNil(err)
+		},
+	)
 }
 
-func (c *conn) Del(key string) (int64, error) {
-	result, err := c.delegate.Del(c.ctx, key).Result()
-	return result, noErrNil(err)
+// Eval 优先使用 EVALSHA，脚本未缓存时自动使用 EVAL
+func (c *conn) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return redisWorker.Await(
+		ctx, func() (interface{}, error) {
+			result, err := redis.NewScript(script).Run(ctx, c.delegate, keys, args...).Result()
+			return result, noErrNil(err)
+		},
+	)
+}
+
+// Pipeline 通过 Pipeliner 一次发送所有命令，集群客户端按key分发到各节点
+func (c *conn) Pipeline(ctx context.Context, cmds []redisWorker.Cmd) ([]redisWorker.Reply, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	return redisWorker.Await(
+		ctx, func() ([]redisWorker.Reply, error) {
+			pipe := c.delegate.Pipeline()
+			results := make([]*redis.Cmd, 0, len(cmds))
+			for _, cmd := range cmds {
+				results = append(results, pipe.Do(ctx, cmd...))
+			}
+			// Exec 的错误与第一条失败命令的错误一致，可能为 redis.Nil，以各命令的结果为准
+			_, _ = pipe.Exec(ctx)
+			return replies(results)
+		},
+	)
+}
+
+// replies 转换批量执行的结果，返回第一条失败命令的错误
+func replies(results []*redis.Cmd) ([]redisWorker.Reply, error) {
+	var err error
+	replies := make([]redisWorker.Reply, 0, len(results))
+	for _, result := range results {
+		value, e := result.Result()
+		e = noErrNil(e)
+		if err == nil {
+			err = e
+		}
+		replies = append(replies, redisWorker.Reply{Value: value, Err: e})
+	}
+	return replies, err
 }
 
 // Close close
@@ -4,7 +4,10 @@ import (
 	"context"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/gosharedlib/idgenerator/v2/internal/testredis"
+	redisWorker "github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 	goRedis "github.com/redis/go-redis/v9"
 )
 
@@ -38,6 +41,7 @@ func Test_conn_Close(t *testing.T) {
 }
 
 func Test_pool_Get(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type fields struct {
 		delegate *goRedis.Client
 	}
@@ -46,8 +50,8 @@ func Test_pool_Get(t *testing.T) {
 	}
 	goRedisOpt := &goRedis.Options{
 		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
+		Addr:     addr,
+		Password: password,
 		DB:       0,
 	}
 	client := goRedis.NewClient(goRedisOpt)
@@ -81,16 +85,20 @@ func Test_pool_Get(t *testing.T) {
 }
 
 func TestNewPool(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type args struct {
-		delegate *goRedis.Client
+		delegate goRedis.Cmdable
 	}
 	goRedisOpt := &goRedis.Options{
 		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
+		Addr:     addr,
+		Password: password,
 		DB:       0,
 	}
 	client := goRedis.NewClient(goRedisOpt)
+	cluster := goRedis.NewClusterClient(&goRedis.ClusterOptions{Addrs: []string{goRedisOpt.Addr}})
+	ring := goRedis.NewRing(&goRedis.RingOptions{Addrs: map[string]string{"shard1": goRedisOpt.Addr}})
+	universal := goRedis.NewUniversalClient(&goRedis.UniversalOptions{Addrs: []string{goRedisOpt.Addr}})
 	tests := []struct {
 		name    string
 		args    args
@@ -101,6 +109,21 @@ func TestNewPool(t *testing.T) {
 			args:    args{delegate: client},
 			wantErr: false,
 		},
+		{
+			name:    "test02",
+			args:    args{delegate: cluster},
+			wantErr: false,
+		},
+		{
+			name:    "test03",
+			args:    args{delegate: ring},
+			wantErr: false,
+		},
+		{
+			name:    "test04",
+			args:    args{delegate: universal},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
@@ -112,3 +135,411 @@ func TestNewPool(t *testing.T) {
 		)
 	}
 }
+
+func Test_noErrNil(t *testing.T) {
+	type args struct {
+		err error
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name:    "test_01",
+			args:    args{err: goRedis.Nil},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if err := noErrNil(tt.args.err); (err != nil) != tt.wantErr {
+					t.Errorf("noErrNil() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_SetNX(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		key   string
+		value string
+		ttl   time.Duration
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "test01",
+			fields: fields{delegate: client, ctx: ctx},
+			args: args{
+				key:   "test:goredis:nx",
+				value: "1",
+				ttl:   time.Second,
+			},
+			want:    true,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.SetNX(tt.fields.ctx, tt.args.key, tt.args.value, tt.args.ttl)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("SetNX() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("SetNX() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Expire(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		key string
+		ttl time.Duration
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "test01",
+			fields: fields{delegate: client, ctx: ctx},
+			args: args{
+				key: "test:goredis:expire",
+				ttl: time.Second,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.Expire(tt.fields.ctx, tt.args.key, tt.args.ttl)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Expire() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("Expire() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Del(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		key string
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	client.Set(ctx, "test_del_key1", "1", time.Second)
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:    "test01",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{key: "test_del_key"},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:    "test02",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{key: "test_del_key1"},
+			want:    1,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.Del(tt.fields.ctx, tt.args.key)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Del() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if got != tt.want {
+					t.Errorf("Del() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_PTTL(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		key string
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	client.Set(ctx, "test_pttl_key1", "1", 0)
+	client.Set(ctx, "test_pttl_key2", "1", time.Second*10)
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "test01",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{key: "test_pttl_key"},
+			want:    redisWorker.PTTLNoKey,
+			wantErr: false,
+		},
+		{
+			name:    "test02",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{key: "test_pttl_key1"},
+			want:    redisWorker.PTTLNoExpire,
+			wantErr: false,
+		},
+		{
+			name:    "test03",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{key: "test_pttl_key2"},
+			want:    time.Second * 10,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.PTTL(tt.fields.ctx, tt.args.key)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("PTTL() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				// 有过期时间时不超过设置的值
+				if got != tt.want && (tt.want < 0 || got <= 0 || got > tt.want) {
+					t.Errorf("PTTL() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Eval(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		script string
+		keys   []string
+		args   []interface{}
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	client.Set(ctx, "test_eval_key1", "1", time.Second)
+	script := "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end return 0"
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:    "test01",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{script: script, keys: []string{"test_eval_key1"}, args: []interface{}{"1", 1000}},
+			want:    int64(1),
+			wantErr: false,
+		},
+		{
+			name:    "test02",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{script: script, keys: []string{"test_eval_key1"}, args: []interface{}{"2", 1000}},
+			want:    int64(0),
+			wantErr: false,
+		},
+		{
+			name:    "test03",
+			fields:  fields{delegate: client, ctx: ctx},
+			args:    args{script: "return nil", keys: []string{"test_eval_key1"}},
+			want:    nil,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.Eval(tt.fields.ctx, tt.args.script, tt.args.keys, tt.args.args...)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Eval() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Pipeline(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate *goRedis.Client
+		ctx      context.Context
+	}
+	type args struct {
+		cmds []redisWorker.Cmd
+	}
+	ctx := context.TODO()
+	goRedisOpt := &goRedis.Options{
+		Network:  "tcp",
+		Addr:     addr,
+		Password: password,
+		DB:       0,
+	}
+	client := goRedis.NewClient(goRedisOpt)
+	client.Del(ctx, "test_pipeline_key1", "test_pipeline_key2")
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    []interface{}
+		wantErr bool
+	}{
+		{
+			name:   "test01",
+			fields: fields{delegate: client, ctx: ctx},
+			args: args{
+				cmds: []redisWorker.Cmd{
+					{"SET", "test_pipeline_key1", "a"},
+					{"GET", "test_pipeline_key1"},
+					{"GET", "test_pipeline_key0"},
+				},
+			},
+			want:    []interface{}{"OK", "a", nil},
+			wantErr: false,
+		},
+		{
+			// 单条命令失败不影响其它命令
+			name:   "test02",
+			fields: fields{delegate: client, ctx: ctx},
+			args: args{
+				cmds: []redisWorker.Cmd{
+					{"SET", "test_pipeline_key2", "1"},
+					{"INCR", "test_pipeline_key1"},
+					{"INCR", "test_pipeline_key2"},
+				},
+			},
+			want:    []interface{}{"OK", nil, int64(2)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				replies, err := c.Pipeline(tt.fields.ctx, tt.args.cmds)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Pipeline() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				got := make([]interface{}, 0, len(replies))
+				for _, reply := range replies {
+					got = append(got, reply.Value)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Pipeline() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
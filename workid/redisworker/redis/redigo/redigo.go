@@ -5,7 +5,7 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
-	redisWorker "github.com/gosharedlib/idgenerator/workid/redisworker/redis"
+	redisWorker "github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 )
 
 // pool 连接池信息
@@ -14,8 +14,17 @@ type pool struct {
 	delegate *redis.Pool
 }
 
-// Get 获取redis连接
+// Get 获取redis连接，连接的所有调用使用ctx
 func (p *pool) Get(ctx context.Context) (redisWorker.Conn, error) {
+	c, err := p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return redisWorker.BindContext(ctx, c), nil
+}
+
+// GetContext 获取redis连接，连接的每次调用使用调用时的ctx
+func (p *pool) GetContext(ctx context.Context) (redisWorker.ContextConn, error) {
 	if ctx != nil {
 		c, err := p.delegate.GetContext(ctx)
 		if err != nil {
@@ -27,7 +36,7 @@ func (p *pool) Get(ctx context.Context) (redisWorker.Conn, error) {
 }
 
 // NewPool 新建连接池
-func NewPool(delegate *redis.Pool) redisWorker.Pool {
+func NewPool(delegate *redis.Pool) redisWorker.ContextPool {
 	return &pool{delegate: delegate}
 }
 
@@ -36,21 +45,109 @@ type conn struct {
 	delegate redis.Conn
 }
 
-func (c *conn) SetNX(key, value string, ttl time.Duration) (bool, error) {
-	result, err := redis.String(c.delegate.Do("SET", key, value, "EX", int64(ttl/time.Second), "NX"))
+func (c *conn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	result, err := redis.String(c.do(ctx, "SET", key, value, "EX", int64(ttl/time.Second), "NX"))
 	return result == "OK", noErrNil(err)
 }
 
-func (c *conn) Expire(key string, ttl time.Duration) (bool, error) {
-	result, err := redis.Int(c.delegate.Do("EXPIRE", key, int64(ttl/time.Second)))
+func (c *conn) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	result, err := redis.Int(c.do(ctx, "EXPIRE", key, int64(ttl/time.Second)))
 	return result == 1, noErrNil(err)
 }
 
-func (c *conn) Del(key string) (int64, error) {
-	result, err := redis.Int64(c.delegate.Do("DEL", key))
+func (c *conn) Del(ctx context.Context, key string) (int64, error) {
+	result, err := redis.Int64(c.do(ctx, "DEL", key))
+	return result, noErrNil(err)
+}
+
+func (c *conn) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	result, err := redis.Int64(c.do(ctx, "PTTL", key))
+	if result < 0 {
+		return time.Duration(result), noErrNil(err)
+	}
+	return time.Duration(result) * time.Millisecond, noErrNil(err)
+}
+
+// Eval 优先使用 EVALSHA，脚本未缓存时自动使用 EVAL
+func (c *conn) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	keysAndArgs := make([]interface{}, 0, len(keys)+len(args))
+	for _, key := range keys {
+		keysAndArgs = append(keysAndArgs, key)
+	}
+	keysAndArgs = append(keysAndArgs, args...)
+	s := redis.NewScript(len(keys), script)
+	var (
+		result interface{}
+		err    error
+	)
+	if ctx != nil {
+		result, err = s.DoContext(ctx, c.delegate, keysAndArgs...)
+	} else {
+		result, err = s.Do(c.delegate, keysAndArgs...)
+	}
 	return result, noErrNil(err)
 }
 
+// Pipeline 通过 Send 缓存所有命令，Flush 一次发送后依次 Receive 结果
+func (c *conn) Pipeline(ctx context.Context, cmds []redisWorker.Cmd) ([]redisWorker.Reply, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	if ctx != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	for _, cmd := range cmds {
+		name, _ := cmd[0].(string)
+		if err := c.delegate.Send(name, cmd[1:]...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.delegate.Flush(); err != nil {
+		return nil, err
+	}
+	var err error
+	replies := make([]redisWorker.Reply, 0, len(cmds))
+	for range cmds {
+		value, e := c.receive(ctx)
+		if err == nil {
+			err = e
+		}
+		replies = append(replies, redisWorker.Reply{Value: reply(value), Err: e})
+	}
+	return replies, err
+}
+
+// do 执行命令，ctx的超时与取消对本次调用生效
+func (c *conn) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	if ctx == nil {
+		return c.delegate.Do(cmd, args...)
+	}
+	return redis.DoContext(c.delegate, ctx, cmd, args...)
+}
+
+// receive 读取一条回复，ctx的超时与取消对本次读取生效
+func (c *conn) receive(ctx context.Context) (interface{}, error) {
+	if ctx == nil {
+		return c.delegate.Receive()
+	}
+	return redis.ReceiveContext(c.delegate, ctx)
+}
+
+// reply 字符串结果由[]byte转换为string，与go-redis一致
+func reply(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = reply(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
 // Close close
 func (c *conn) Close() error {
 	err := c.delegate.Close()
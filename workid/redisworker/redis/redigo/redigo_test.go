@@ -7,9 +7,12 @@ import (
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/gosharedlib/idgenerator/v2/internal/testredis"
+	redisWorker "github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 )
 
 func Test_conn_Close(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type fields struct {
 		delegate redis.Conn
 	}
@@ -19,11 +22,11 @@ func Test_conn_Close(t *testing.T) {
 		IdleTimeout: time.Minute,
 		Dial: func() (redis.Conn, error) {
 			conn, err := redis.Dial(
-				"tcp", "192.168.0.128:6379",
+				"tcp", addr,
 				redis.DialConnectTimeout(time.Millisecond*200),
 				redis.DialReadTimeout(time.Millisecond*500),
 				redis.DialWriteTimeout(time.Millisecond*500),
-				redis.DialPassword("yourpassword"),
+				redis.DialPassword(password),
 				redis.DialDatabase(0),
 			)
 			if err != nil {
@@ -126,6 +129,7 @@ func Test_pool_Get(t *testing.T) {
 }
 
 func TestNewPool(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type args struct {
 		delegate *redis.Pool
 	}
@@ -135,11 +139,11 @@ func TestNewPool(t *testing.T) {
 		IdleTimeout: time.Minute,
 		Dial: func() (redis.Conn, error) {
 			conn, err := redis.Dial(
-				"tcp", "192.168.0.128:6379",
+				"tcp", addr,
 				redis.DialConnectTimeout(time.Millisecond*200),
 				redis.DialReadTimeout(time.Millisecond*500),
 				redis.DialWriteTimeout(time.Millisecond*500),
-				redis.DialPassword("yourpassword"),
+				redis.DialPassword(password),
 				redis.DialDatabase(0),
 			)
 			if err != nil {
@@ -173,15 +177,16 @@ func TestNewPool(t *testing.T) {
 }
 
 func Test_conn_SetNX(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type fields struct {
 		delegate redis.Conn
 	}
 	rediGoConn, _ := redis.Dial(
-		"tcp", "192.168.0.128:6379",
+		"tcp", addr,
 		redis.DialConnectTimeout(time.Millisecond*200),
 		redis.DialReadTimeout(time.Millisecond*500),
 		redis.DialWriteTimeout(time.Millisecond*500),
-		redis.DialPassword("yourpassword"),
+		redis.DialPassword(password),
 		redis.DialDatabase(0),
 	)
 
@@ -215,7 +220,7 @@ func Test_conn_SetNX(t *testing.T) {
 				c := &conn{
 					delegate: tt.fields.delegate,
 				}
-				got, err := c.SetNX(tt.args.key, tt.args.value, tt.args.ttl)
+				got, err := c.SetNX(context.TODO(), tt.args.key, tt.args.value, tt.args.ttl)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("SetNX() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -229,15 +234,16 @@ func Test_conn_SetNX(t *testing.T) {
 }
 
 func Test_conn_Expire(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type fields struct {
 		delegate redis.Conn
 	}
 	rediGoConn, _ := redis.Dial(
-		"tcp", "192.168.0.128:6379",
+		"tcp", addr,
 		redis.DialConnectTimeout(time.Millisecond*200),
 		redis.DialReadTimeout(time.Millisecond*500),
 		redis.DialWriteTimeout(time.Millisecond*500),
-		redis.DialPassword("yourpassword"),
+		redis.DialPassword(password),
 		redis.DialDatabase(0),
 	)
 	type args struct {
@@ -268,7 +274,7 @@ func Test_conn_Expire(t *testing.T) {
 				c := &conn{
 					delegate: tt.fields.delegate,
 				}
-				got, err := c.Expire(tt.args.key, tt.args.ttl)
+				got, err := c.Expire(context.TODO(), tt.args.key, tt.args.ttl)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("Expire() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -282,6 +288,7 @@ func Test_conn_Expire(t *testing.T) {
 }
 
 func Test_conn_Del(t *testing.T) {
+	addr, password := testredis.Server(t)
 	type fields struct {
 		delegate redis.Conn
 	}
@@ -289,11 +296,11 @@ func Test_conn_Del(t *testing.T) {
 		key string
 	}
 	rediGoConn, _ := redis.Dial(
-		"tcp", "192.168.0.128:6379",
+		"tcp", addr,
 		redis.DialConnectTimeout(time.Millisecond*200),
 		redis.DialReadTimeout(time.Millisecond*500),
 		redis.DialWriteTimeout(time.Millisecond*500),
-		redis.DialPassword("yourpassword"),
+		redis.DialPassword(password),
 		redis.DialDatabase(0),
 	)
 	_, _ = rediGoConn.Do("SET", "test_del_key1", "1", "EX", 1)
@@ -325,7 +332,7 @@ func Test_conn_Del(t *testing.T) {
 				c := &conn{
 					delegate: tt.fields.delegate,
 				}
-				got, err := c.Del(tt.args.key)
+				got, err := c.Del(context.TODO(), tt.args.key)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("Del() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -337,3 +344,213 @@ func Test_conn_Del(t *testing.T) {
 		)
 	}
 }
+
+func Test_conn_PTTL(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate redis.Conn
+	}
+	type args struct {
+		key string
+	}
+	rediGoConn, _ := redis.Dial(
+		"tcp", addr,
+		redis.DialConnectTimeout(time.Millisecond*200),
+		redis.DialReadTimeout(time.Millisecond*500),
+		redis.DialWriteTimeout(time.Millisecond*500),
+		redis.DialPassword(password),
+		redis.DialDatabase(0),
+	)
+	_, _ = rediGoConn.Do("SET", "test_pttl_key1", "1")
+	_, _ = rediGoConn.Do("SET", "test_pttl_key2", "1", "EX", 10)
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "test01",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{key: "test_pttl_key"},
+			want:    redisWorker.PTTLNoKey,
+			wantErr: false,
+		},
+		{
+			name:    "test02",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{key: "test_pttl_key1"},
+			want:    redisWorker.PTTLNoExpire,
+			wantErr: false,
+		},
+		{
+			name:    "test03",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{key: "test_pttl_key2"},
+			want:    time.Second * 10,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.PTTL(context.TODO(), tt.args.key)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("PTTL() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				// 有过期时间时不超过设置的值
+				if got != tt.want && (tt.want < 0 || got <= 0 || got > tt.want) {
+					t.Errorf("PTTL() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Eval(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate redis.Conn
+	}
+	type args struct {
+		script string
+		keys   []string
+		args   []interface{}
+	}
+	rediGoConn, _ := redis.Dial(
+		"tcp", addr,
+		redis.DialConnectTimeout(time.Millisecond*200),
+		redis.DialReadTimeout(time.Millisecond*500),
+		redis.DialWriteTimeout(time.Millisecond*500),
+		redis.DialPassword(password),
+		redis.DialDatabase(0),
+	)
+	_, _ = rediGoConn.Do("SET", "test_eval_key1", "1", "EX", 1)
+	script := "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end return 0"
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:    "test01",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{script: script, keys: []string{"test_eval_key1"}, args: []interface{}{"1", 1000}},
+			want:    int64(1),
+			wantErr: false,
+		},
+		{
+			name:    "test02",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{script: script, keys: []string{"test_eval_key1"}, args: []interface{}{"2", 1000}},
+			want:    int64(0),
+			wantErr: false,
+		},
+		{
+			name:    "test03",
+			fields:  fields{delegate: rediGoConn},
+			args:    args{script: "return nil", keys: []string{"test_eval_key1"}},
+			want:    nil,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				got, err := c.Eval(context.TODO(), tt.args.script, tt.args.keys, tt.args.args...)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Eval() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func Test_conn_Pipeline(t *testing.T) {
+	addr, password := testredis.Server(t)
+	type fields struct {
+		delegate redis.Conn
+	}
+	type args struct {
+		cmds []redisWorker.Cmd
+	}
+	rediGoConn, _ := redis.Dial(
+		"tcp", addr,
+		redis.DialConnectTimeout(time.Millisecond*200),
+		redis.DialReadTimeout(time.Millisecond*500),
+		redis.DialWriteTimeout(time.Millisecond*500),
+		redis.DialPassword(password),
+		redis.DialDatabase(0),
+	)
+	_, _ = rediGoConn.Do("DEL", "test_pipeline_key1", "test_pipeline_key2")
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    []interface{}
+		wantErr bool
+	}{
+		{
+			name:   "test01",
+			fields: fields{delegate: rediGoConn},
+			args: args{
+				cmds: []redisWorker.Cmd{
+					{"SET", "test_pipeline_key1", "a"},
+					{"GET", "test_pipeline_key1"},
+					{"GET", "test_pipeline_key0"},
+				},
+			},
+			want:    []interface{}{"OK", "a", nil},
+			wantErr: false,
+		},
+		{
+			// 单条命令失败不影响其它命令
+			name:   "test02",
+			fields: fields{delegate: rediGoConn},
+			args: args{
+				cmds: []redisWorker.Cmd{
+					{"SET", "test_pipeline_key2", "1"},
+					{"INCR", "test_pipeline_key1"},
+					{"INCR", "test_pipeline_key2"},
+				},
+			},
+			want:    []interface{}{"OK", nil, int64(2)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := &conn{
+					delegate: tt.fields.delegate,
+				}
+				replies, err := c.Pipeline(context.TODO(), tt.args.cmds)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Pipeline() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				got := make([]interface{}, 0, len(replies))
+				for _, reply := range replies {
+					got = append(got, reply.Value)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Pipeline() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
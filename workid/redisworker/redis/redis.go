@@ -5,6 +5,23 @@ import (
 	"time"
 )
 
+// PTTL 的特殊返回值，与redis一致
+const (
+	PTTLNoKey    time.Duration = -2 // key不存在
+	PTTLNoExpire time.Duration = -1 // key没有过期时间
+)
+
+// Cmd 一条redis命令，第一个元素为命令名，如 redis.Cmd{"GET", key}
+type Cmd []interface{}
+
+// Reply 批量执行时一条命令的结果
+type Reply struct {
+	// Value 结果，整数为int64，字符串为string，数组为[]interface{}，key不存在时为nil
+	Value interface{}
+	// Err 该命令的错误，key不存在不是错误
+	Err error
+}
+
 // Pool redis连接池
 type Pool interface {
 	// Get 获取连接方法
@@ -19,6 +36,39 @@ type Conn interface {
 	Expire(key string, ttl time.Duration) (bool, error)
 	// Del del
 	Del(key string) (int64, error)
+	// PTTL 剩余过期时间，key不存在时为 PTTLNoKey，没有过期时间时为 PTTLNoExpire
+	PTTL(key string) (time.Duration, error)
+	// Eval 执行lua脚本，keys与args分别对应脚本中的 KEYS、ARGV。整数结果为int64，脚本返回nil时结果为nil且没有错误
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+	// Pipeline 一次往返批量执行命令，返回与cmds一一对应的结果，返回的错误为第一条失败命令的错误。
+	// 集群中各命令按key分发到所在节点，命令之间不要求位于同一个slot，也不保证原子性
+	Pipeline(cmds []Cmd) ([]Reply, error)
+	// Close 关闭连接
+	Close() error
+}
+
+// ContextPool 支持按调用传入ctx的连接池，内置的适配器都实现了该接口。
+// 只实现 Pool 的连接池通过 NewContextPool 兼容
+type ContextPool interface {
+	Pool
+	// GetContext 获取连接，ctx只用于获取连接，连接的每个方法使用调用时传入的ctx
+	GetContext(ctx context.Context) (ContextConn, error)
+}
+
+// ContextConn 与 Conn 相同，每个方法的ctx对本次调用生效：ctx取消或超时时停止等待并返回ctx的错误
+type ContextConn interface {
+	// SetNX set
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Expire expire
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Del del
+	Del(ctx context.Context, key string) (int64, error)
+	// PTTL 剩余过期时间，key不存在时为 PTTLNoKey，没有过期时间时为 PTTLNoExpire
+	PTTL(ctx context.Context, key string) (time.Duration, error)
+	// Eval 执行lua脚本，与 Conn.Eval 相同
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+	// Pipeline 一次往返批量执行命令，与 Conn.Pipeline 相同
+	Pipeline(ctx context.Context, cmds []Cmd) ([]Reply, error)
 	// Close 关闭连接
 	Close() error
 }
@@ -0,0 +1,287 @@
+package redistest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// ErrInjected 注入的故障
+var ErrInjected = errors.New("redistest: injected fault")
+
+// Op 可注入故障的操作
+type Op string
+
+const (
+	OpGet      Op = "GET"      // Pool.Get 获取连接
+	OpSetNX    Op = "SETNX"    // Conn.SetNX
+	OpExpire   Op = "EXPIRE"   // Conn.Expire
+	OpDel      Op = "DEL"      // Conn.Del
+	OpPTTL     Op = "PTTL"     // Conn.PTTL
+	OpEval     Op = "EVAL"     // Conn.Eval，redisworker的占用、续约、释放都通过脚本完成
+	OpPipeline Op = "PIPELINE" // Conn.Pipeline，整批命令作为一次调用
+)
+
+// Call 一次调用，用于 Fault.Match 筛选
+type Call struct {
+	Op     Op
+	Keys   []string // 操作的key，OpGet 时为空，OpPipeline 时为各命令的第一个key
+	Script string   // 脚本内容，仅 OpEval
+}
+
+// Fault 故障配置
+type Fault struct {
+	Latency   time.Duration        // 调用前增加的延迟
+	Err       error                // 返回的错误，为空时不返回错误
+	Drop      bool                 // 丢弃调用：不转发给被装饰的连接池并返回零值，模拟请求未到达redis；对 OpGet 等同于返回 ErrInjected
+	LoseReply bool                 // 丢失响应：转发调用后仍返回Err，模拟请求已在redis执行但响应丢失或超时；对 OpGet 无效
+	Rate      float64              // 触发概率，取值(0,1)，0表示每次都触发
+	Times     int                  // 触发次数，0表示不限
+	Match     func(call Call) bool // 只对匹配的调用生效，为空时对所有调用生效
+}
+
+// FaultPool 故障注入连接池，装饰任意 redis.Pool，按配置为调用增加延迟、返回错误或丢弃调用，用于验证服务在redis缓慢或不稳定时的表现
+type FaultPool struct {
+	pool  redis.Pool
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	rules []*rule
+	calls map[Op]int
+}
+
+// rule 已注入的故障
+type rule struct {
+	op        Op
+	fault     Fault
+	remaining int // 剩余触发次数，-1表示不限
+}
+
+// NewFaultPool 新建故障注入连接池，未注入故障时所有调用直接转发给pool
+func NewFaultPool(pool redis.Pool) *FaultPool {
+	return &FaultPool{
+		pool:  pool,
+		rnd:   rand.New(rand.NewSource(1)),
+		calls: map[Op]int{},
+	}
+}
+
+// Seed 设置按概率触发故障时使用的随机数种子，默认为1，保证测试可重复
+func (p *FaultPool) Seed(seed int64) *FaultPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rnd = rand.New(rand.NewSource(seed))
+	return p
+}
+
+// Inject 注入故障，同一操作的多个故障按注入顺序叠加：延迟累加，返回第一个错误
+func (p *FaultPool) Inject(op Op, fault Fault) *FaultPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	remaining := fault.Times
+	if remaining <= 0 {
+		remaining = -1
+	}
+	p.rules = append(p.rules, &rule{op: op, fault: fault, remaining: remaining})
+	return p
+}
+
+// FailNext 接下来的n次调用返回err，err为空时返回 ErrInjected。如 FailNext(OpEval, 3, nil) 使之后的3次心跳失败
+func (p *FaultPool) FailNext(op Op, n int, err error) *FaultPool {
+	if err == nil {
+		err = ErrInjected
+	}
+	return p.Inject(op, Fault{Err: err, Times: n})
+}
+
+// DropNext 丢弃接下来的n次调用
+func (p *FaultPool) DropNext(op Op, n int) *FaultPool {
+	return p.Inject(op, Fault{Drop: true, Times: n})
+}
+
+// Reset 清除所有故障与调用计数
+func (p *FaultPool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = nil
+	p.calls = map[Op]int{}
+}
+
+// Calls 操作被调用的次数，包括注入了故障的调用
+func (p *FaultPool) Calls(op Op) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls[op]
+}
+
+// Get 获取连接，连接的所有调用使用ctx
+func (p *FaultPool) Get(ctx context.Context) (redis.Conn, error) {
+	conn, err := p.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return redis.BindContext(ctx, conn), nil
+}
+
+// GetContext 获取连接，注入的延迟在ctx结束时提前返回。被装饰的连接池只实现 redis.Pool 时通过 redis.NewContextPool 兼容
+func (p *FaultPool) GetContext(ctx context.Context) (redis.ContextConn, error) {
+	latency, drop, _, err := p.apply(Call{Op: OpGet})
+	if err := sleep(ctx, latency); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if drop {
+		return nil, ErrInjected
+	}
+	conn, err := redis.NewContextPool(p.pool).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{pool: p, conn: conn}, nil
+}
+
+// apply 计算调用需要注入的故障
+func (p *FaultPool) apply(call Call) (latency time.Duration, drop, lose bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls[call.Op]++
+
+	rules := p.rules[:0]
+	for _, r := range p.rules {
+		if r.op == call.Op && (r.fault.Match == nil || r.fault.Match(call)) &&
+			(r.fault.Rate <= 0 || p.rnd.Float64() < r.fault.Rate) {
+			latency += r.fault.Latency
+			drop = drop || r.fault.Drop
+			lose = lose || r.fault.LoseReply
+			if err == nil {
+				err = r.fault.Err
+			}
+			if r.remaining > 0 {
+				r.remaining--
+			}
+		}
+		if r.remaining != 0 {
+			rules = append(rules, r)
+		}
+	}
+	p.rules = rules
+	return latency, drop, lose, err
+}
+
+// do 注入故障后执行调用，丢弃时不执行，丢失响应时执行后返回注入的错误
+func (p *FaultPool) do(ctx context.Context, call Call, fn func() error) error {
+	latency, drop, lose, err := p.apply(call)
+	if err := sleep(ctx, latency); err != nil {
+		return err
+	}
+	if lose && !drop {
+		if e := fn(); e != nil {
+			return e
+		}
+		return err
+	}
+	if err != nil || drop {
+		return err
+	}
+	return fn()
+}
+
+// sleep 等待注入的延迟，ctx结束时提前返回ctx的错误
+func sleep(ctx context.Context, latency time.Duration) error {
+	if latency <= 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// faultConn 故障注入连接
+type faultConn struct {
+	pool *FaultPool
+	conn redis.ContextConn
+}
+
+func (c *faultConn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (success bool, err error) {
+	err = c.pool.do(
+		ctx, Call{Op: OpSetNX, Keys: []string{key}}, func() (err error) {
+			success, err = c.conn.SetNX(ctx, key, value, ttl)
+			return err
+		},
+	)
+	return success, err
+}
+
+func (c *faultConn) Expire(ctx context.Context, key string, ttl time.Duration) (success bool, err error) {
+	err = c.pool.do(
+		ctx, Call{Op: OpExpire, Keys: []string{key}}, func() (err error) {
+			success, err = c.conn.Expire(ctx, key, ttl)
+			return err
+		},
+	)
+	return success, err
+}
+
+func (c *faultConn) Del(ctx context.Context, key string) (n int64, err error) {
+	err = c.pool.do(
+		ctx, Call{Op: OpDel, Keys: []string{key}}, func() (err error) {
+			n, err = c.conn.Del(ctx, key)
+			return err
+		},
+	)
+	return n, err
+}
+
+func (c *faultConn) PTTL(ctx context.Context, key string) (ttl time.Duration, err error) {
+	err = c.pool.do(
+		ctx, Call{Op: OpPTTL, Keys: []string{key}}, func() (err error) {
+			ttl, err = c.conn.PTTL(ctx, key)
+			return err
+		},
+	)
+	return ttl, err
+}
+
+func (c *faultConn) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (result interface{}, err error) {
+	err = c.pool.do(
+		ctx, Call{Op: OpEval, Keys: keys, Script: script}, func() (err error) {
+			result, err = c.conn.Eval(ctx, script, keys, args...)
+			return err
+		},
+	)
+	return result, err
+}
+
+func (c *faultConn) Pipeline(ctx context.Context, cmds []redis.Cmd) (replies []redis.Reply, err error) {
+	keys := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		if len(cmd) > 1 {
+			keys = append(keys, argString(cmd[1]))
+		}
+	}
+	err = c.pool.do(
+		ctx, Call{Op: OpPipeline, Keys: keys}, func() (err error) {
+			replies, err = c.conn.Pipeline(ctx, cmds)
+			return err
+		},
+	)
+	return replies, err
+}
+
+// Close close
+func (c *faultConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,140 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFaultPool(t *testing.T) {
+	errTimeout := errors.New("i/o timeout")
+	tests := []struct {
+		name   string
+		inject func(p *FaultPool)
+		want   []error
+	}{
+		{
+			name: "test_01",
+			inject: func(p *FaultPool) {
+				p.FailNext(OpExpire, 2, errTimeout)
+			},
+			want: []error{errTimeout, errTimeout, nil, nil},
+		},
+		{
+			name: "test_02",
+			inject: func(p *FaultPool) {
+				p.FailNext(OpExpire, 1, nil).FailNext(OpSetNX, 1, nil)
+			},
+			want: []error{ErrInjected, nil, nil, nil},
+		},
+		{
+			name: "test_03",
+			inject: func(p *FaultPool) {
+				p.Inject(OpExpire, Fault{Err: errTimeout, Rate: 0.5})
+			},
+		},
+		{
+			name: "test_04",
+			inject: func(p *FaultPool) {
+				p.Inject(
+					OpExpire, Fault{
+						Err: errTimeout,
+						Match: func(call Call) bool {
+							return call.Keys[0] == "k2"
+						},
+					},
+				)
+			},
+			want: []error{nil, nil, nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				p := NewFaultPool(NewPool())
+				tt.inject(p)
+				c, err := p.Get(context.TODO())
+				if err != nil {
+					t.Fatalf("Get() error = %v", err)
+				}
+				_, _ = c.SetNX("k1", "v1", time.Minute)
+				var failed int
+				for i := 0; i < 100; i++ {
+					_, err := c.Expire("k1", time.Minute)
+					if i < len(tt.want) && !errors.Is(err, tt.want[i]) {
+						t.Errorf("Expire() #%d error = %v, want %v", i, err, tt.want[i])
+					}
+					if err != nil {
+						failed++
+					}
+				}
+				if tt.want == nil && (failed == 0 || failed == 100) {
+					t.Errorf("Expire() failed %d times with rate 0.5", failed)
+				}
+				if got := p.Calls(OpExpire); got != 100 {
+					t.Errorf("Calls() = %v, want 100", got)
+				}
+			},
+		)
+	}
+}
+
+func TestFaultPool_drop(t *testing.T) {
+	pool := NewPool()
+	p := NewFaultPool(pool).DropNext(OpEval, 1).DropNext(OpGet, 1)
+	if _, err := p.Get(context.TODO()); !errors.Is(err, ErrInjected) {
+		t.Errorf("Get() error = %v, want %v", err, ErrInjected)
+	}
+	c, _ := p.Get(context.TODO())
+	script := "return redis.call('SET', KEYS[1], ARGV[1])"
+	if got, err := c.Eval(script, []string{"k1"}, "v1"); got != nil || err != nil {
+		t.Errorf("Eval() dropped = %v, %v", got, err)
+	}
+	if _, ok := pool.Value("k1"); ok {
+		t.Errorf("Eval() dropped but applied")
+	}
+	if got, err := c.Eval(script, []string{"k1"}, "v1"); got != "OK" || err != nil {
+		t.Errorf("Eval() = %v, %v", got, err)
+	}
+}
+
+func TestFaultPool_latency(t *testing.T) {
+	p := NewFaultPool(NewPool()).Inject(OpGet, Fault{Latency: time.Second})
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	p.Reset()
+	p.Inject(
+		OpEval, Fault{
+			Latency: time.Millisecond * 20, Times: 1, Match: func(call Call) bool {
+				return strings.Contains(call.Script, "PEXPIRE")
+			},
+		},
+	)
+	c, _ := p.Get(context.TODO())
+	start := time.Now()
+	_, _ = c.Eval("return 1", nil)
+	_, _ = c.Eval("return redis.call('PEXPIRE', 'k1', 10)", nil)
+	_, _ = c.Eval("return redis.call('PEXPIRE', 'k1', 10)", nil)
+	if elapsed := time.Since(start); elapsed < time.Millisecond*20 || elapsed > time.Millisecond*40 {
+		t.Errorf("Eval() elapsed = %v", elapsed)
+	}
+
+	// 调用的延迟在ctx结束时提前返回
+	p.Reset()
+	p.Inject(OpSetNX, Fault{Latency: time.Second})
+	cc, _ := p.GetContext(context.TODO())
+	ctx, cancel = context.WithTimeout(context.TODO(), time.Millisecond*10)
+	defer cancel()
+	if _, err := cc.SetNX(ctx, "k2", "v", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SetNX() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := p.pool.(*Pool).Value("k2"); ok {
+		t.Errorf("SetNX() executed after ctx done")
+	}
+}
@@ -0,0 +1,392 @@
+package redistest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// status redis状态回复，如 OK
+type status string
+
+// eval 执行lua脚本，redis.call 与 redis.pcall 直接操作连接池中的数据，返回值按redis的规则转换。调用前必须持有锁
+func eval(p *Pool, script string, keys []string, args []interface{}) (result interface{}, err error) {
+	slot := -1
+	if p.cluster {
+		for _, key := range keys {
+			if slot >= 0 && KeySlot(key) != slot {
+				return nil, ErrCrossSlot
+			}
+			slot = KeySlot(key)
+		}
+	}
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	L.SetGlobal("KEYS", toLuaArray(L, keys))
+	argv := make([]string, 0, len(args))
+	for _, arg := range args {
+		argv = append(argv, argString(arg))
+	}
+	L.SetGlobal("ARGV", toLuaArray(L, argv))
+
+	redisLib := L.NewTable()
+	redisLib.RawSetString(
+		"call", L.NewFunction(
+			func(L *lua.LState) int {
+				reply, err := call(p, slot, L)
+				if err != nil {
+					// 不附加脚本中的位置，与redis一样以错误码开头
+					L.Error(lua.LString(err.Error()), 0)
+					return 0
+				}
+				L.Push(toLua(L, reply))
+				return 1
+			},
+		),
+	)
+	redisLib.RawSetString(
+		"pcall", L.NewFunction(
+			func(L *lua.LState) int {
+				reply, err := call(p, slot, L)
+				if err != nil {
+					reply = err
+				}
+				L.Push(toLua(L, reply))
+				return 1
+			},
+		),
+	)
+	redisLib.RawSetString(
+		"error_reply", L.NewFunction(
+			func(L *lua.LState) int {
+				t := L.NewTable()
+				t.RawSetString("err", lua.LString(L.CheckString(1)))
+				L.Push(t)
+				return 1
+			},
+		),
+	)
+	redisLib.RawSetString(
+		"status_reply", L.NewFunction(
+			func(L *lua.LState) int {
+				t := L.NewTable()
+				t.RawSetString("ok", lua.LString(L.CheckString(1)))
+				L.Push(t)
+				return 1
+			},
+		),
+	)
+	L.SetGlobal("redis", redisLib)
+
+	if err = L.DoString(script); err != nil {
+		if e, ok := err.(*lua.ApiError); ok && e.Type == lua.ApiErrorRun {
+			if msg, ok := e.Object.(lua.LString); ok {
+				return nil, errors.New(string(msg))
+			}
+		}
+		return nil, errors.WithStack(err)
+	}
+	if L.GetTop() == 0 {
+		return nil, nil
+	}
+	result = fromLua(L.Get(-1))
+	if err, ok := result.(error); ok {
+		return nil, err
+	}
+	if s, ok := result.(status); ok {
+		return string(s), nil
+	}
+	return result, nil
+}
+
+// call 执行脚本中的redis命令，集群模式下slot为声明的key所在的slot，没有声明key时为-1
+func call(p *Pool, slot int, L *lua.LState) (interface{}, error) {
+	n := L.GetTop()
+	if n == 0 {
+		return nil, errors.New("ERR Please specify at least one argument for this redis lib call")
+	}
+	args := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args = append(args, string(v))
+		case lua.LNumber:
+			args = append(args, strconv.FormatInt(int64(v), 10))
+		default:
+			return nil, errors.New("ERR Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	name := strings.ToUpper(args[0])
+	if p.cluster {
+		for _, key := range commandKeys(name, args[1:]) {
+			if KeySlot(key) != slot {
+				return nil, ErrNonLocalKey
+			}
+		}
+	}
+	return command(p, name, args[1:])
+}
+
+// commandKeys 命令访问的key
+func commandKeys(name string, args []string) []string {
+	switch {
+	case len(args) == 0:
+		return nil
+	case name == "DEL" || name == "EXISTS":
+		return args
+	default:
+		return args[:1]
+	}
+}
+
+// command 执行redis命令，只支持worker用到的字符串与过期时间相关命令
+func command(p *Pool, name string, args []string) (interface{}, error) {
+	switch name {
+	case "GET":
+		if len(args) != 1 {
+			return nil, errWrongArgs(name)
+		}
+		if e := p.get(args[0]); e != nil {
+			return e.value, nil
+		}
+		return nil, nil
+	case "SET":
+		return set(p, args)
+	case "DEL":
+		var n int64
+		for _, key := range args {
+			if p.get(key) != nil {
+				delete(p.data, key)
+				n++
+			}
+		}
+		return n, nil
+	case "EXISTS":
+		var n int64
+		for _, key := range args {
+			if p.get(key) != nil {
+				n++
+			}
+		}
+		return n, nil
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			return nil, errWrongArgs(name)
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, errors.New("ERR value is not an integer or out of range")
+		}
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if p.expire(args[0], time.Duration(n)*unit) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			return nil, errWrongArgs(name)
+		}
+		ttl := p.ttl(args[0])
+		if ttl < 0 {
+			return int64(ttl), nil
+		}
+		if name == "TTL" {
+			return int64((ttl + time.Second/2) / time.Second), nil
+		}
+		return ttl.Milliseconds(), nil
+	case "INCR", "INCRBY":
+		if len(args) < 1 {
+			return nil, errWrongArgs(name)
+		}
+		by := int64(1)
+		if name == "INCRBY" {
+			if len(args) != 2 {
+				return nil, errWrongArgs(name)
+			}
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return nil, errors.New("ERR value is not an integer or out of range")
+			}
+		}
+		var n int64
+		e := p.get(args[0])
+		if e != nil {
+			var err error
+			if n, err = strconv.ParseInt(e.value, 10, 64); err != nil {
+				return nil, errors.New("ERR value is not an integer or out of range")
+			}
+		} else {
+			e = &entry{}
+			p.data[args[0]] = e
+		}
+		n += by
+		e.value = strconv.FormatInt(n, 10)
+		return n, nil
+	default:
+		return nil, errors.Errorf("ERR unknown command '%s'", strings.ToLower(name))
+	}
+}
+
+// set SET key value [EX seconds|PX milliseconds] [NX|XX]
+func set(p *Pool, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errWrongArgs("SET")
+	}
+	key, value := args[0], args[1]
+	var (
+		ttl    time.Duration
+		nx, xx bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, errors.New("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return nil, errors.New("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return nil, errors.New("ERR syntax error")
+		}
+	}
+	exists := p.get(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil, nil
+	}
+	p.set(key, value, ttl)
+	return status("OK"), nil
+}
+
+func errWrongArgs(name string) error {
+	return errors.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+}
+
+// argString 参数转换为字符串，与redis客户端的处理方式一致
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toLuaArray(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// toLua redis回复转换为lua值
+func toLua(L *lua.LState, reply interface{}) lua.LValue {
+	switch v := reply.(type) {
+	case nil:
+		return lua.LFalse
+	case int64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case status:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case error:
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(v.Error()))
+		return t
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			t.Append(toLua(L, item))
+		}
+		return t
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua lua返回值转换为redis回复
+func fromLua(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		if v {
+			return int64(1)
+		}
+		return nil
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return errors.New(string(e))
+		}
+		if s, ok := v.RawGetString("ok").(lua.LString); ok {
+			return status(s)
+		}
+		result := make([]interface{}, 0, v.Len())
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			if s, ok := fromLua(item).(status); ok {
+				result = append(result, string(s))
+				continue
+			}
+			result = append(result, fromLua(item))
+		}
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,321 @@
+// Package redistest 提供内存实现的 redis.Pool，支持key过期与lua脚本，用于不依赖redis服务的单元测试
+package redistest
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// ErrScriptingDisabled 脚本已禁用
+var ErrScriptingDisabled = errors.New("ERR unknown command 'evalsha'")
+
+// ErrCrossSlot 集群模式下脚本声明的key不在同一个slot
+var ErrCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
+// ErrNonLocalKey 集群模式下脚本访问了与声明的key不在同一个slot的key
+var ErrNonLocalKey = errors.New("ERR Script attempted to access keys that do not hash to the same slot")
+
+// Option NewPool 可选配置
+type Option func(p *Pool)
+
+// WithClock 设置时钟，默认使用系统时钟
+func WithClock(clock Clock) Option {
+	return func(p *Pool) {
+		p.clock = clock
+	}
+}
+
+// WithScriptingDisabled 禁用脚本，Eval 返回 ErrScriptingDisabled，模拟禁用了脚本的redis服务
+func WithScriptingDisabled() Option {
+	return func(p *Pool) {
+		p.scripting = false
+	}
+}
+
+// WithCluster 模拟redis集群：脚本声明的key必须位于同一个slot，脚本内访问的key必须与声明的key位于同一个slot，
+// 否则返回 ErrCrossSlot 或 ErrNonLocalKey，用于验证key的 hash tag 设计
+func WithCluster() Option {
+	return func(p *Pool) {
+		p.cluster = true
+	}
+}
+
+// Pool 内存redis连接池，所有连接共享同一份数据
+type Pool struct {
+	mu        sync.Mutex
+	clock     Clock
+	scripting bool
+	cluster   bool
+	data      map[string]*entry
+}
+
+// entry key对应的值
+type entry struct {
+	value    string
+	expireAt time.Time // 零值表示不过期
+}
+
+// NewPool 新建内存连接池
+func NewPool(opts ...Option) *Pool {
+	p := &Pool{
+		clock:     systemClock{},
+		scripting: true,
+		data:      map[string]*entry{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Get 获取连接，连接的所有调用使用ctx
+func (p *Pool) Get(ctx context.Context) (redis.Conn, error) {
+	return redis.BindContext(ctx, &conn{pool: p}), nil
+}
+
+// GetContext 获取连接，ctx已结束时调用直接返回ctx的错误
+func (p *Pool) GetContext(_ context.Context) (redis.ContextConn, error) {
+	return &conn{pool: p}, nil
+}
+
+// Set 设置key，ttl为0时不过期
+func (p *Pool) Set(key, value string, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.set(key, value, ttl)
+}
+
+// Value 获取未过期的key的值
+func (p *Pool) Value(key string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.get(key)
+	if e == nil {
+		return "", false
+	}
+	return e.value, true
+}
+
+// TTL key剩余过期时间，key不存在时为-2，没有过期时间时为-1，与redis的 PTTL 一致
+func (p *Pool) TTL(key string) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ttl(key)
+}
+
+// Keys 所有未过期的key，按字典序排列
+func (p *Pool) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.data))
+	for key := range p.data {
+		if p.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Del 删除key
+func (p *Pool) Del(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.data, key)
+}
+
+// FlushAll 清空所有key
+func (p *Pool) FlushAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data = map[string]*entry{}
+}
+
+// get 获取未过期的key，已过期的key在此删除。调用前必须持有锁
+func (p *Pool) get(key string) *entry {
+	e, ok := p.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !p.clock.Now().Before(e.expireAt) {
+		delete(p.data, key)
+		return nil
+	}
+	return e
+}
+
+// set 设置key，ttl为0时不过期。调用前必须持有锁
+func (p *Pool) set(key, value string, ttl time.Duration) {
+	e := &entry{value: value}
+	if ttl > 0 {
+		e.expireAt = p.clock.Now().Add(ttl)
+	}
+	p.data[key] = e
+}
+
+// expire 设置过期时间，ttl不大于0时直接删除。调用前必须持有锁
+func (p *Pool) expire(key string, ttl time.Duration) bool {
+	e := p.get(key)
+	if e == nil {
+		return false
+	}
+	if ttl <= 0 {
+		delete(p.data, key)
+		return true
+	}
+	e.expireAt = p.clock.Now().Add(ttl)
+	return true
+}
+
+// ttl 剩余过期时间。调用前必须持有锁
+func (p *Pool) ttl(key string) time.Duration {
+	e := p.get(key)
+	switch {
+	case e == nil:
+		return -2
+	case e.expireAt.IsZero():
+		return -1
+	default:
+		return e.expireAt.Sub(p.clock.Now())
+	}
+}
+
+// conn 内存连接
+type conn struct {
+	pool *Pool
+}
+
+func (c *conn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if err := ctxErr(ctx); err != nil {
+		return false, err
+	}
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	if c.pool.get(key) != nil {
+		return false, nil
+	}
+	c.pool.set(key, value, ttl)
+	return true, nil
+}
+
+func (c *conn) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if err := ctxErr(ctx); err != nil {
+		return false, err
+	}
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	return c.pool.expire(key, ttl), nil
+}
+
+func (c *conn) Del(ctx context.Context, key string) (int64, error) {
+	if err := ctxErr(ctx); err != nil {
+		return 0, err
+	}
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	if c.pool.get(key) == nil {
+		return 0, nil
+	}
+	delete(c.pool.data, key)
+	return 1, nil
+}
+
+func (c *conn) PTTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctxErr(ctx); err != nil {
+		return 0, err
+	}
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	return c.pool.ttl(key), nil
+}
+
+// Eval 使用内置的lua解释器执行脚本，脚本执行期间独占连接池，与redis一样是原子的
+func (c *conn) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	if !c.pool.scripting {
+		return nil, ErrScriptingDisabled
+	}
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	return eval(c.pool, script, keys, args)
+}
+
+// Pipeline 依次执行命令，每条命令是原子的，命令之间不独占连接池。集群模式下多个key的命令要求key位于同一个slot
+func (c *conn) Pipeline(ctx context.Context, cmds []redis.Cmd) ([]redis.Reply, error) {
+	if err := ctxErr(ctx); err != nil {
+		return nil, err
+	}
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	var err error
+	replies := make([]redis.Reply, 0, len(cmds))
+	for _, cmd := range cmds {
+		value, e := c.do(ctx, cmd)
+		if err == nil {
+			err = e
+		}
+		replies = append(replies, redis.Reply{Value: value, Err: e})
+	}
+	return replies, err
+}
+
+// do 执行一条命令，EVAL 与 Eval 相同
+func (c *conn) do(ctx context.Context, cmd redis.Cmd) (interface{}, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("ERR empty command")
+	}
+	args := make([]string, 0, len(cmd))
+	for _, arg := range cmd {
+		args = append(args, argString(arg))
+	}
+	name := strings.ToUpper(args[0])
+	if name == "EVAL" {
+		if len(args) < 3 {
+			return nil, errWrongArgs(name)
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 0 || 3+n > len(args) {
+			return nil, errors.New("ERR Number of keys can't be greater than number of args")
+		}
+		return c.Eval(ctx, args[1], args[3:3+n], cmd[3+n:]...)
+	}
+
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	if c.pool.cluster {
+		keys := commandKeys(name, args[1:])
+		for _, key := range keys {
+			if KeySlot(key) != KeySlot(keys[0]) {
+				return nil, ErrCrossSlot
+			}
+		}
+	}
+	result, err := command(c.pool, name, args[1:])
+	if s, ok := result.(status); ok {
+		return string(s), err
+	}
+	return result, err
+}
+
+// ctxErr ctx已结束时返回ctx的错误，内存操作不会阻塞，只在调用前检查
+func ctxErr(ctx context.Context) error {
+	if ctx == nil || ctx.Err() == nil {
+		return nil
+	}
+	return errors.WithStack(ctx.Err())
+}
+
+// Close close
+func (c *conn) Close() error {
+	return nil
+}
@@ -0,0 +1,304 @@
+package redistest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+)
+
+func TestPool_expire(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := NewPool(WithClock(clock))
+	c, _ := p.Get(context.TODO())
+
+	if ok, err := c.SetNX("k1", "v1", time.Second); !ok || err != nil {
+		t.Fatalf("SetNX() = %v, %v", ok, err)
+	}
+	if ok, _ := c.SetNX("k1", "v2", time.Second); ok {
+		t.Errorf("SetNX() existing key = %v", ok)
+	}
+	clock.Advance(time.Millisecond * 999)
+	if ok, _ := c.Expire("k1", time.Second*2); !ok {
+		t.Errorf("Expire() = %v", ok)
+	}
+	clock.Advance(time.Second)
+	if got := p.TTL("k1"); got != time.Second {
+		t.Errorf("TTL() = %v", got)
+	}
+	if got, err := c.PTTL("k1"); got != time.Second || err != nil {
+		t.Errorf("PTTL() = %v, %v", got, err)
+	}
+	clock.Advance(time.Second)
+	if _, ok := p.Value("k1"); ok {
+		t.Errorf("Value() expired key exists")
+	}
+	if ok, _ := c.Expire("k1", time.Second); ok {
+		t.Errorf("Expire() expired key = %v", ok)
+	}
+	if ok, _ := c.SetNX("k1", "v3", 0); !ok {
+		t.Errorf("SetNX() expired key = %v", ok)
+	}
+	if got := p.TTL("k1"); got != -1 {
+		t.Errorf("TTL() = %v", got)
+	}
+	if got, _ := c.PTTL("k1"); got != redis.PTTLNoExpire {
+		t.Errorf("PTTL() = %v", got)
+	}
+	if n, _ := c.Del("k1"); n != 1 {
+		t.Errorf("Del() = %v", n)
+	}
+	if n, _ := c.Del("k1"); n != 0 {
+		t.Errorf("Del() = %v", n)
+	}
+	if got, _ := c.PTTL("k1"); got != redis.PTTLNoKey {
+		t.Errorf("PTTL() = %v", got)
+	}
+}
+
+func TestPool_Eval(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := NewPool(WithClock(clock))
+	p.Set("k1", "v1", time.Second)
+	tests := []struct {
+		name    string
+		script  string
+		keys    []string
+		args    []interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:   "test_01",
+			script: "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end return 0",
+			keys:   []string{"k1"},
+			args:   []interface{}{"v1", int64(5000)},
+			want:   int64(1),
+		},
+		{
+			name:   "test_02",
+			script: "if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) end return 0",
+			keys:   []string{"k1"},
+			args:   []interface{}{"v2", int64(5000)},
+			want:   int64(0),
+		},
+		{
+			name:   "test_03",
+			script: "return redis.call('PTTL', KEYS[1])",
+			keys:   []string{"k1"},
+			want:   int64(5000),
+		},
+		{
+			name:   "test_04",
+			script: "if redis.call('SET', KEYS[1], ARGV[1], 'PX', 100, 'NX') then return 1 end return 0",
+			keys:   []string{"k1"},
+			args:   []interface{}{"v2"},
+			want:   int64(0),
+		},
+		{
+			name:   "test_05",
+			script: "return redis.call('SET', KEYS[1], ARGV[1])",
+			keys:   []string{"k2"},
+			args:   []interface{}{3},
+			want:   "OK",
+		},
+		{
+			name:   "test_06",
+			script: "return {redis.call('INCR', KEYS[1]), redis.call('GET', KEYS[2]), redis.call('EXISTS', KEYS[1], KEYS[2], 'k3')}",
+			keys:   []string{"k2", "k1"},
+			want:   []interface{}{int64(4), "v1", int64(2)},
+		},
+		{
+			name:   "test_07",
+			script: "return redis.call('GET', 'k3')",
+			want:   nil,
+		},
+		{
+			name:    "test_08",
+			script:  "return redis.call('UNKNOWN')",
+			wantErr: true,
+		},
+		{
+			name:   "test_09",
+			script: "local r = redis.pcall('INCR', KEYS[1]) return r['err'] ~= nil",
+			keys:   []string{"k1"},
+			want:   int64(1),
+		},
+		{
+			name:    "test_10",
+			script:  "return redis.error_reply('ERR custom')",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c, _ := p.Get(context.TODO())
+				got, err := c.Eval(tt.script, tt.keys, tt.args...)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Eval() got = %#v, want %#v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestWithScriptingDisabled(t *testing.T) {
+	p := NewPool(WithScriptingDisabled())
+	c, _ := p.Get(context.TODO())
+	if _, err := c.Eval("return 1", nil); !errors.Is(err, ErrScriptingDisabled) {
+		t.Errorf("Eval() error = %v, want %v", err, ErrScriptingDisabled)
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want int
+	}{
+		{name: "test_01", key: "123456789", want: 12739},
+		{name: "test_02", key: "foo", want: 12182},
+		{name: "test_03", key: "{foo}:bar", want: 12182},
+		{name: "test_04", key: "x{foo}y{bar}", want: 12182},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := KeySlot(tt.key); got != tt.want {
+					t.Errorf("KeySlot() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+	if KeySlot("{}foo") == KeySlot("foo") {
+		t.Errorf("KeySlot() empty hash tag should hash the whole key")
+	}
+}
+
+func TestWithCluster(t *testing.T) {
+	p := NewPool(WithCluster())
+	c, _ := p.Get(context.TODO())
+	tests := []struct {
+		name    string
+		script  string
+		keys    []string
+		wantErr error
+	}{
+		{
+			name:   "test_01",
+			script: "redis.call('SET', KEYS[1], 1) return redis.call('INCR', '{app}:2')",
+			keys:   []string{"{app}:1"},
+		},
+		{
+			name:    "test_02",
+			script:  "return 1",
+			keys:    []string{"app:1", "app:2"},
+			wantErr: ErrCrossSlot,
+		},
+		{
+			name:    "test_03",
+			script:  "return redis.call('GET', 'app:2')",
+			keys:    []string{"app:1"},
+			wantErr: ErrNonLocalKey,
+		},
+		{
+			name:    "test_04",
+			script:  "return redis.call('DEL', KEYS[1], 'app:2')",
+			keys:    []string{"app:1"},
+			wantErr: ErrNonLocalKey,
+		},
+		{
+			name:    "test_05",
+			script:  "return redis.call('GET', 'app:1')",
+			wantErr: ErrNonLocalKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				_, err := c.Eval(tt.script, tt.keys)
+				if tt.wantErr == nil && err != nil || tt.wantErr != nil && !strings.Contains(fmt.Sprint(err), tt.wantErr.Error()) {
+					t.Errorf("Eval() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestPool_Pipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		cmds     []redis.Cmd
+		want     []interface{}
+		wantErrs []bool
+	}{
+		{
+			name: "test_01",
+			cmds: []redis.Cmd{
+				{"SET", "k1", "a", "PX", 1000},
+				{"GET", "k1"},
+				{"GET", "k2"},
+				{"INCR", "k1"},
+				{"EVAL", "return {KEYS[1], ARGV[1]}", 1, "k1", 2},
+				{"PTTL", "k1"},
+			},
+			want:     []interface{}{"OK", "a", nil, nil, []interface{}{"k1", "2"}, int64(1000)},
+			wantErrs: []bool{false, false, false, true, false, false},
+		},
+		{
+			// 集群中各命令分别路由，多个key的命令要求位于同一个slot
+			name: "test_02",
+			opts: []Option{WithCluster()},
+			cmds: []redis.Cmd{
+				{"SET", "app:1", "1"},
+				{"SET", "app:2", "2"},
+				{"EXISTS", "app:1", "app:2"},
+				{"EXISTS", "{app}:1", "{app}:2"},
+			},
+			want:     []interface{}{"OK", "OK", nil, int64(0)},
+			wantErrs: []bool{false, false, true, false},
+		},
+		{
+			name:     "test_03",
+			opts:     []Option{WithScriptingDisabled()},
+			cmds:     []redis.Cmd{{"EVAL", "return 1", 0}, {"EXISTS", "k1"}},
+			want:     []interface{}{nil, int64(0)},
+			wantErrs: []bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				p := NewPool(append(tt.opts, WithClock(NewFakeClock(time.Unix(0, 0))))...)
+				c, _ := p.Get(context.TODO())
+				replies, err := c.Pipeline(tt.cmds)
+				var (
+					got  []interface{}
+					errs []bool
+				)
+				for _, reply := range replies {
+					got = append(got, reply.Value)
+					errs = append(errs, reply.Err != nil)
+				}
+				if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(errs, tt.wantErrs) {
+					t.Errorf("Pipeline() = %v, errors %v, want %v, %v", got, errs, tt.want, tt.wantErrs)
+				}
+				if (err != nil) != slices.Contains(tt.wantErrs, true) {
+					t.Errorf("Pipeline() error = %v", err)
+				}
+			},
+		)
+	}
+}
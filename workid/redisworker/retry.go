@@ -0,0 +1,193 @@
+package redisworker
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen redis连续失败次数达到阈值，熔断期间不再请求redis
+var ErrCircuitOpen = errors.New("redis熔断中")
+
+// Operation 可单独设置重试策略的操作
+type Operation int
+
+const (
+	OpClaim   Operation = iota // 占用workID
+	OpRenew                    // 续约
+	OpRelease                  // 释放
+)
+
+// RetryPolicy 重试策略，零值为不重试
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数，包括第一次，小于1时为1
+	BaseDelay   time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 等待时间上限，0表示不限
+	Jitter      float64       // 抖动比例，取值[0,1]，实际等待时间在 [d*(1-Jitter), d] 之间随机，避免多个实例同时重试
+	Timeout     time.Duration // 每次尝试的超时时间，0表示只受调用方ctx限制；续约为0时使用心跳时间，避免一次续约阻塞后续心跳
+}
+
+// backoff 第attempt次重试前的等待时间，attempt从1开始
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// retryPolicies 各操作的重试策略
+type retryPolicies [OpRelease + 1]RetryPolicy
+
+// circuitBreaker 熔断器：连续失败达到阈值后熔断，冷却时间内直接返回 ErrCircuitOpen，冷却结束后放行请求试探，成功则恢复
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int           // 连续失败阈值
+	cooldown  time.Duration // 冷却时间
+	failures  int           // 连续失败次数
+	openUntil time.Time     // 熔断结束时间
+}
+
+// allow 是否允许请求
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold && time.Now().Before(b.openUntil) {
+		return errors.WithStack(ErrCircuitOpen)
+	}
+	return nil
+}
+
+// record 记录请求结果
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// do 按操作的重试策略执行redis请求，只有返回错误时重试，熔断或ctx结束时停止重试
+func (c *redisConn) do(ctx context.Context, op Operation, fn func(ctx context.Context, conn redis.ContextConn) error) error {
+	policy := c.retry[op]
+	timeout := policy.Timeout
+	if timeout <= 0 && op == OpRenew {
+		timeout = c.timeout
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = c.breaker.allow(); err != nil {
+			return err
+		}
+		err = c.attempt(ctx, timeout, fn)
+		if err != nil && ctx.Err() != nil {
+			// 调用方取消或超时，不计入熔断
+			return errors.WithStack(err)
+		}
+		if isPermanentError(err) {
+			// redis返回的错误说明服务可用，重试也不会成功
+			c.breaker.record(nil)
+			return errors.WithStack(err)
+		}
+		c.breaker.record(err)
+		if err == nil || attempt >= policy.MaxAttempts {
+			return errors.WithStack(err)
+		}
+
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// attempt 获取连接并执行一次请求，timeout大于0时限制本次请求的时间，结束后关闭连接
+func (c *redisConn) attempt(ctx context.Context, timeout time.Duration, fn func(ctx context.Context, conn redis.ContextConn) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := redis.NewContextPool(c.pool).GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	return fn(ctx, conn)
+}
+
+// permanentReplies 重试也不会成功的redis返回错误前缀：禁用脚本、没有权限、类型错误、集群中的key不在同一个slot。
+// 其它错误都会重试，包括故障切换期间的 READONLY、LOADING、BUSY、TRYAGAIN、CLUSTERDOWN、MASTERDOWN
+var permanentReplies = []string{
+	"NOSCRIPT",
+	"ERR unknown command",
+	"NOPERM",
+	"WRONGTYPE",
+	"CROSSSLOT",
+	"ERR Script attempted to access",
+}
+
+// isScriptingUnavailable redis禁用或不支持脚本，只有这种情况才能改用不依赖脚本的命令
+func isScriptingUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := errors.Cause(err).Error()
+	return strings.HasPrefix(msg, "NOSCRIPT") || strings.HasPrefix(msg, "ERR unknown command")
+}
+
+// isScriptUnusable 脚本无法执行：redis禁用脚本，或集群未使用 hash tag 时脚本访问的key不在同一个slot。
+// 占用workID只在这种情况下改用不依赖脚本的命令，网络错误、超时时脚本可能已在服务端执行成功，改用其它命令会重复占用。
+// 同样的原因，OpClaim 的重试不能盲目重新占用：claimScript 重试时先返回当前持有者已占用的workID，
+// stickyScript 把已属于当前持有者的key视为占用成功，SETNX 重试失败时检查key是否已属于当前持有者
+func isScriptUnusable(err error) bool {
+	if isScriptingUnavailable(err) {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	msg := errors.Cause(err).Error()
+	return strings.HasPrefix(msg, "CROSSSLOT") || strings.HasPrefix(msg, "ERR Script attempted to access")
+}
+
+// isPermanentError 是否为重试也不会成功的redis返回错误，如 ERR unknown command、NOSCRIPT No matching script，区别于网络错误与故障切换
+func isPermanentError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := errors.Cause(err).Error()
+	for _, prefix := range permanentReplies {
+		if strings.HasPrefix(msg, prefix) {
+			return true
+		}
+	}
+	return false
+}
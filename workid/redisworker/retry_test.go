@@ -0,0 +1,459 @@
+package redisworker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond * 10, MaxDelay: time.Millisecond * 30}
+	tests := []struct {
+		name    string
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "test_01",
+			attempt: 1,
+			want:    time.Millisecond * 10,
+		},
+		{
+			name:    "test_02",
+			attempt: 2,
+			want:    time.Millisecond * 20,
+		},
+		{
+			name:    "test_03",
+			attempt: 3,
+			want:    time.Millisecond * 30,
+		},
+		{
+			name:    "test_04",
+			attempt: 100,
+			want:    time.Millisecond * 30,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := policy.backoff(tt.attempt); got != tt.want {
+					t.Errorf("backoff() = %v, want %v", got, tt.want)
+				}
+				policy := policy
+				policy.Jitter = 0.5
+				if got := policy.backoff(tt.attempt); got < tt.want/2 || got > tt.want {
+					t.Errorf("backoff() with jitter = %v, want [%v, %v]", got, tt.want/2, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_retry(t *testing.T) {
+	pool := redistest.NewFaultPool(redistest.NewPool())
+	c := NewRedisWorker(
+		"qw-scrm", pool,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, OpRenew),
+	).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+
+	pool.Reset()
+	pool.FailNext(redistest.OpEval, 2, nil)
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+	if got := pool.Calls(redistest.OpEval); got != 3 {
+		t.Errorf("Calls() = %v, want 3", got)
+	}
+
+	// 释放不重试
+	pool.Reset()
+	pool.FailNext(redistest.OpEval, 1, nil)
+	if _, err := c.del(context.TODO()); !errors.Is(err, redistest.ErrInjected) {
+		t.Errorf("del() error = %v, want %v", err, redistest.ErrInjected)
+	}
+	if got := pool.Calls(redistest.OpEval); got != 1 {
+		t.Errorf("Calls() = %v, want 1", got)
+	}
+}
+
+func TestConn_circuitBreaker(t *testing.T) {
+	pool := redistest.NewFaultPool(redistest.NewPool())
+	pool.Inject(redistest.OpGet, redistest.Fault{Err: errors.New("dial tcp: connection refused")})
+	c := NewRedisWorker("qw-scrm", pool, WithCircuitBreaker(3, time.Minute)).Get(context.TODO()).(*redisConn)
+	// 网络错误不改用其它命令重复占用，连续失败3次后熔断
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetWorkID(context.TODO()); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("GetWorkID() error = %v, want connection refused", err)
+		}
+	}
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if got := pool.Calls(redistest.OpGet); got != 3 {
+		t.Errorf("Calls() = %v, want 3", got)
+	}
+
+	// 冷却结束后试探成功即恢复
+	pool.Reset()
+	c.breaker.openUntil = time.Now()
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Errorf("GetWorkID() error = %v", err)
+	}
+	if c.breaker.failures != 0 {
+		t.Errorf("failures = %v, want 0", c.breaker.failures)
+	}
+}
+
+func TestConn_circuitBreakerReplyError(t *testing.T) {
+	// 禁用脚本时redis返回错误，不计入熔断，可以回退为逐个尝试
+	pool := redistest.NewPool(redistest.WithScriptingDisabled())
+	c := NewRedisWorker(
+		"qw-scrm", pool,
+		WithCircuitBreaker(1, time.Minute),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3}),
+		WithUnfencedFallback(),
+	).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Errorf("GetWorkID() error = %v", err)
+	}
+}
+
+func TestConn_timeout(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		heartbeat time.Duration
+		wantState workid.LeaseState
+	}{
+		{
+			// 续约默认以心跳时间为超时时间
+			name:      "test_01",
+			heartbeat: time.Millisecond * 50,
+			wantState: workid.LeaseAtRisk,
+		},
+		{
+			name:      "test_02",
+			policy:    RetryPolicy{Timeout: time.Millisecond * 50},
+			heartbeat: time.Hour,
+			wantState: workid.LeaseAtRisk,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewFaultPool(redistest.NewPool())
+				worker := NewRedisWorker("qw-scrm", pool, WithRetryPolicy(tt.policy, OpRenew)).(*redisWorker)
+				worker.Heartbeat = tt.heartbeat
+				c := worker.Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				pool.Inject(redistest.OpEval, redistest.Fault{Latency: time.Second})
+				start := time.Now()
+				c.heartbeat(context.TODO())
+				if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+					t.Errorf("heartbeat() elapsed = %v, want timeout", elapsed)
+				}
+				if got := c.LeaseState(); got != tt.wantState {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.wantState)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_canceled(t *testing.T) {
+	// 调用方取消不计入熔断
+	pool := redistest.NewFaultPool(redistest.NewPool())
+	pool.Inject(redistest.OpEval, redistest.Fault{Latency: time.Second})
+	c := NewRedisWorker("qw-scrm", pool, WithCircuitBreaker(1, time.Minute)).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*50)
+	defer cancel()
+	if _, err := c.GetWorkID(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if c.breaker.failures != 0 {
+		t.Errorf("failures = %v, want 0", c.breaker.failures)
+	}
+}
+
+// legacyPool 只实现 redis.Pool 的连接池
+type legacyPool struct {
+	redis.Pool
+}
+
+func TestConn_legacyPool(t *testing.T) {
+	pool := redistest.NewPool()
+	c := NewRedisWorker("qw-scrm", legacyPool{pool}).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if got, err := c.GetWorkID(context.TODO()); err != nil || got != 0 {
+		t.Fatalf("GetWorkID() = %v, %v, want 0", got, err)
+	}
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	if _, ok := pool.Value(c.keyOf(0)); ok {
+		t.Errorf("Release() key not deleted")
+	}
+}
+
+func Test_isPermanentError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "test_01",
+			err:  errors.New("ERR unknown command 'evalsha'"),
+			want: true,
+		},
+		{
+			name: "test_02",
+			err:  errors.New("NOSCRIPT No matching script. Please use EVAL."),
+			want: true,
+		},
+		{
+			name: "test_03",
+			err:  errors.New("dial tcp 127.0.0.1:6379: connect: connection refused"),
+			want: false,
+		},
+		{
+			name: "test_04",
+			err:  errors.New("EOF"),
+			want: false,
+		},
+		{
+			name: "test_05",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "test_06",
+			err:  errors.New("NOPERM this user has no permissions to run the 'eval' command"),
+			want: true,
+		},
+		{
+			name: "test_07",
+			err:  errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"),
+			want: true,
+		},
+		{
+			name: "test_08",
+			err:  redistest.ErrCrossSlot,
+			want: true,
+		},
+		{
+			// 故障切换期间的错误可以重试
+			name: "test_09",
+			err:  errors.New("READONLY You can't write against a read only replica."),
+			want: false,
+		},
+		{
+			name: "test_10",
+			err:  errors.New("LOADING Redis is loading the dataset in memory"),
+			want: false,
+		},
+		{
+			name: "test_11",
+			err:  errors.New("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE."),
+			want: false,
+		},
+		{
+			name: "test_12",
+			err:  errors.New("TRYAGAIN Multiple keys request during rehashing of slot"),
+			want: false,
+		},
+		{
+			name: "test_13",
+			err:  errors.New("CLUSTERDOWN The cluster is down"),
+			want: false,
+		},
+		{
+			name: "test_14",
+			err:  errors.New("MASTERDOWN Link with MASTER is down and replica-serve-stale-data is set to 'no'."),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := isPermanentError(tt.err); got != tt.want {
+					t.Errorf("isPermanentError() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_retryFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantCalls    int
+		wantFailures int
+	}{
+		{
+			name:         "test_01",
+			err:          errors.New("READONLY You can't write against a read only replica."),
+			wantCalls:    3,
+			wantFailures: 3,
+		},
+		{
+			name:         "test_02",
+			err:          errors.New("LOADING Redis is loading the dataset in memory"),
+			wantCalls:    3,
+			wantFailures: 3,
+		},
+		{
+			// 重试也不会成功的错误只调用一次，不计入熔断
+			name:      "test_03",
+			err:       errors.New("NOPERM this user has no permissions to run the 'eval' command"),
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewFaultPool(redistest.NewPool())
+				c := NewRedisWorker(
+					"qw-scrm", pool,
+					WithCircuitBreaker(10, time.Minute),
+					WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, OpRenew),
+				).Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				pool.Reset()
+				pool.FailNext(redistest.OpEval, 3, tt.err)
+				if _, err := c.expire(context.TODO(), c.getKey(), c.ttl()); err == nil {
+					t.Errorf("expire() error = nil, want %v", tt.err)
+				}
+				if got := pool.Calls(redistest.OpEval); got != tt.wantCalls {
+					t.Errorf("Calls() = %v, want %v", got, tt.wantCalls)
+				}
+				// 可以重试的错误计入熔断
+				if got := c.breaker.failures; got != tt.wantFailures {
+					t.Errorf("failures = %v, want %v", got, tt.wantFailures)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_retryClaimLostReply(t *testing.T) {
+	// 占用请求已在redis执行但响应丢失，重试时不会再占用其它workID
+	tests := []struct {
+		name   string
+		op     redistest.Op
+		script string
+		held   []int // 重试前当前持有者有意保留的workID
+		claim  func(c *redisConn, held []int) (int, error)
+		want   int
+	}{
+		{
+			name:   "test_01",
+			op:     redistest.OpEval,
+			script: claimScript,
+			claim: func(c *redisConn, held []int) (int, error) {
+				return c.claimByScript(context.TODO(), 0, held)
+			},
+			want: 0,
+		},
+		{
+			// 保留的workID不会被当作上一次尝试占用的workID
+			name:   "test_02",
+			op:     redistest.OpEval,
+			script: claimScript,
+			held:   []int{0},
+			claim: func(c *redisConn, held []int) (int, error) {
+				return c.claimByScript(context.TODO(), 0, held)
+			},
+			want: 1,
+		},
+		{
+			name:   "test_03",
+			op:     redistest.OpEval,
+			script: stickyScript,
+			claim: func(c *redisConn, _ []int) (int, error) {
+				ok, err := c.claimPreferred(context.TODO(), 2, "previous-owner")
+				if !ok {
+					return -1, err
+				}
+				return 2, err
+			},
+			want: 2,
+		},
+		{
+			name: "test_04",
+			op:   redistest.OpSetNX,
+			claim: func(c *redisConn, _ []int) (int, error) {
+				ok, err := c.add(context.TODO(), c.keyOf(3), c.owner)
+				if !ok {
+					return -1, err
+				}
+				return 3, err
+			},
+			want: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				backend := redistest.NewPool()
+				pool := redistest.NewFaultPool(backend)
+				c := NewRedisWorker(
+					"qw-scrm", pool, WithMaxWorkID(4),
+					WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}, OpClaim),
+				).Get(context.TODO()).(*redisConn)
+				for _, n := range tt.held {
+					if ok, err := c.add(context.TODO(), c.keyOf(n), c.owner); !ok || err != nil {
+						t.Fatalf("add() = %v, %v", ok, err)
+					}
+				}
+				pool.Inject(
+					tt.op, redistest.Fault{
+						Err: redistest.ErrInjected, LoseReply: true, Times: 1,
+						Match: func(call redistest.Call) bool {
+							return tt.script == "" || call.Script == tt.script
+						},
+					},
+				)
+				got, err := tt.claim(c, tt.held)
+				if err != nil || got != tt.want {
+					t.Fatalf("claim() = %v, %v, want %v", got, err, tt.want)
+				}
+				var held []int
+				for n := 0; n < 4; n++ {
+					if v, _ := backend.Value(c.keyOf(n)); v == c.owner {
+						held = append(held, n)
+					}
+				}
+				if want := append(append([]int{}, tt.held...), tt.want); !reflect.DeepEqual(held, want) {
+					t.Errorf("held = %v, want %v", held, want)
+				}
+			},
+		)
+	}
+}
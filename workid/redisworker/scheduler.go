@@ -0,0 +1,222 @@
+package redisworker
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/pkg/errors"
+)
+
+// heartbeatJitter 心跳间隔随机减少的比例上限，避免同时启动的实例同时续约
+const heartbeatJitter = 0.1
+
+// scheduler 同一个 redisWorker 获取的所有连接共用的心跳调度。每轮通过一个脚本批量续约所有持有中的租约，
+// 租约丢失的连接在单独的协程中优先重新占用原来的workID，被其它实例占用时才占用新的workID。没有连接时心跳协程退出
+type scheduler struct {
+	worker      *redisWorker
+	mu          sync.Mutex
+	conns       map[*redisConn]struct{}
+	reacquiring map[*redisConn]chan struct{} // 进行中的重新占用，结束后关闭
+	stop        chan struct{}                // 关闭后心跳协程退出，心跳协程未运行时为空
+	round       chan struct{}                // 当前一轮心跳结束后关闭，没有进行中的心跳时为空
+}
+
+func newScheduler(worker *redisWorker) *scheduler {
+	return &scheduler{worker: worker, conns: map[*redisConn]struct{}{}, reacquiring: map[*redisConn]chan struct{}{}}
+}
+
+// add 加入心跳调度，心跳协程未运行时启动，心跳不受调用方ctx取消的影响
+func (s *scheduler) add(ctx context.Context, c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[c] = struct{}{}
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.run(context.WithoutCancel(ctx), s.stop)
+	}
+}
+
+// remove 移出心跳调度并等待进行中的一轮心跳与该连接的重新占用结束，之后不会再续约或占用该连接的key
+func (s *scheduler) remove(ctx context.Context, c *redisConn) error {
+	s.mu.Lock()
+	delete(s.conns, c)
+	if len(s.conns) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	round, reacquiring := s.round, s.reacquiring[c]
+	s.mu.Unlock()
+
+	for _, done := range []chan struct{}{round, reacquiring} {
+		if done == nil {
+			continue
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+	return nil
+}
+
+// run 按心跳时间加随机抖动定时续约，stop关闭时退出
+func (s *scheduler) run(ctx context.Context, stop <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.worker.logger.ErrorContext(ctx, "heartbeat scheduler panic", slog.Any("panic", r))
+		}
+	}()
+	timer := time.NewTimer(s.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		s.tick(ctx)
+		timer.Reset(s.interval())
+	}
+}
+
+// interval 下一次心跳的间隔，在心跳时间的基础上随机减少最多 heartbeatJitter
+func (s *scheduler) interval() time.Duration {
+	d := s.worker.Heartbeat
+	return d - time.Duration(rand.Float64()*heartbeatJitter*float64(d))
+}
+
+// tick 一轮心跳：批量续约持有中的租约，再为租约丢失的连接重新占用workID
+func (s *scheduler) tick(ctx context.Context) {
+	s.mu.Lock()
+	conns := make([]*redisConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	round := make(chan struct{})
+	s.round = round
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.round == round {
+			s.round = nil
+		}
+		s.mu.Unlock()
+		close(round)
+	}()
+
+	var held []*redisConn
+	for _, c := range conns {
+		if state := c.lease.Current(); state == workid.LeaseHeld || state == workid.LeaseAtRisk {
+			held = append(held, c)
+		}
+	}
+	renewBatch(ctx, held)
+	for _, c := range conns {
+		if c.lease.Current() != workid.LeaseLost || c.isClosed() {
+			continue
+		}
+		s.reacquire(ctx, c)
+	}
+}
+
+// reacquire 在单独的协程中为租约丢失的连接重新占用workID，等待上一个持有者的最后时间戳时不影响其它租约续约。
+// 同一个连接同时只有一个重新占用，已移出心跳调度的连接不再占用
+func (s *scheduler) reacquire(ctx context.Context, c *redisConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[c]; !ok {
+		return
+	}
+	if _, ok := s.reacquiring[c]; ok {
+		return
+	}
+	done := make(chan struct{})
+	s.reacquiring[c] = done
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.worker.logger.ErrorContext(ctx, "reacquire workid panic", slog.Any("panic", r))
+			}
+			s.mu.Lock()
+			delete(s.reacquiring, c)
+			s.mu.Unlock()
+			close(done)
+		}()
+		if err := c.reacquire(ctx); err != nil {
+			c.log().WarnContext(ctx, "reacquire workid", slog.Int("workID", c.currentID()), slog.Any("err", err))
+		}
+	}()
+}
+
+// renewBatch 通过一个脚本批量续约，redis返回错误(如禁用脚本、集群中的key不在同一个slot)时通过批量命令续约
+func renewBatch(ctx context.Context, conns []*redisConn) {
+	if len(conns) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(conns)*3)
+	args := make([]interface{}, 0, len(conns)*4+1)
+	args = append(args, lastKeyTTL.Milliseconds())
+	for _, c := range conns {
+		key := c.getKey()
+		keys = append(keys, key, c.metaKey(key), c.lastKey(key))
+		args = append(args, c.owner, c.ttl().Milliseconds(), c.meta(), c.lastTS.Load())
+	}
+	start := time.Now()
+	var result interface{}
+	err := conns[0].do(
+		ctx, OpRenew, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			result, err = conn.Eval(ctx, batchRenewScript, keys, args...)
+			return err
+		},
+	)
+	if isPermanentError(err) {
+		conns[0].log().WarnContext(ctx, "renew workid by batch script failed, fallback to pipeline", slog.Any("err", err))
+		renewPipeline(ctx, conns)
+		return
+	}
+	values, _ := result.([]interface{})
+	if err == nil && len(values) != len(conns) {
+		err = errors.Errorf("unexpected script result %T(%v)", result, result)
+	}
+	for i, c := range conns {
+		if err != nil {
+			c.renewed(ctx, start, false, err)
+			continue
+		}
+		n, e := toInt64(values[i])
+		c.renewed(ctx, start, n == 1, e)
+	}
+}
+
+// renewPipeline 每个租约执行一次 renewScript，所有脚本通过一次往返批量发送，集群中各租约的key不要求位于同一个slot
+func renewPipeline(ctx context.Context, conns []*redisConn) {
+	cmds := make([]redis.Cmd, 0, len(conns))
+	for _, c := range conns {
+		key := c.getKey()
+		cmds = append(
+			cmds, redis.Cmd{
+				"EVAL", renewScript, 3, key, c.metaKey(key), c.lastKey(key),
+				c.owner, c.ttl().Milliseconds(), c.meta(), c.lastTS.Load(), lastKeyTTL.Milliseconds(),
+			},
+		)
+	}
+	start := time.Now()
+	replies, err := conns[0].pipeline(ctx, OpRenew, cmds)
+	for i, c := range conns {
+		if replies == nil {
+			c.renewed(ctx, start, false, err)
+			continue
+		}
+		n, e := toInt64(replies[i].Value)
+		if replies[i].Err != nil {
+			e = errors.WithStack(replies[i].Err)
+		}
+		c.renewed(ctx, start, n == 1, e)
+	}
+}
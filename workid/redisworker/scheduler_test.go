@@ -0,0 +1,254 @@
+package redisworker
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
+)
+
+func TestScheduler_tick(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []redistest.Option
+		workerOpts []Option
+		wantEvals  int // 续约时调用 Eval 的次数
+		wantPipe   int // 续约时调用 Pipeline 的次数
+	}{
+		{
+			// 一个脚本批量续约
+			name:      "test_01",
+			wantEvals: 1,
+		},
+		{
+			// 集群中的key不在同一个slot，通过批量命令续约
+			name:      "test_02",
+			opts:      []redistest.Option{redistest.WithCluster()},
+			wantEvals: 1,
+			wantPipe:  1,
+		},
+		{
+			name:       "test_03",
+			opts:       []redistest.Option{redistest.WithCluster()},
+			workerOpts: []Option{WithHashTag()},
+			wantEvals:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool(tt.opts...)
+				fault := redistest.NewFaultPool(pool)
+				worker := NewRedisWorker("qw-scrm", fault, tt.workerOpts...).(*redisWorker)
+				var conns []*redisConn
+				for i := 0; i < 3; i++ {
+					c := worker.Get(context.TODO()).(*redisConn)
+					c.timerOnce.Do(func() {})
+					if _, err := c.GetWorkID(context.TODO()); err != nil {
+						t.Fatalf("GetWorkID() error = %v", err)
+					}
+					worker.scheduler.conns[c] = struct{}{}
+					conns = append(conns, c)
+				}
+				for _, c := range conns {
+					pool.Set(c.getKey(), c.owner, time.Second)
+				}
+				fault.Reset()
+				worker.scheduler.tick(context.TODO())
+				if got := fault.Calls(redistest.OpEval); got != tt.wantEvals {
+					t.Errorf("Eval called %v times, want %v", got, tt.wantEvals)
+				}
+				if got := fault.Calls(redistest.OpPipeline); got != tt.wantPipe {
+					t.Errorf("Pipeline called %v times, want %v", got, tt.wantPipe)
+				}
+				for _, c := range conns {
+					if got := c.LeaseState(); got != workid.LeaseHeld {
+						t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+					}
+					if ttl := pool.TTL(c.getKey()); ttl <= time.Second {
+						t.Errorf("TTL(%v) = %v, want renewed", c.getKey(), ttl)
+					}
+				}
+			},
+		)
+	}
+}
+
+// waitReacquire 等待连接进行中的重新占用结束
+func waitReacquire(s *scheduler, c *redisConn) {
+	s.mu.Lock()
+	done := s.reacquiring[c]
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func TestScheduler_reacquire(t *testing.T) {
+	tests := []struct {
+		name        string
+		other       bool // 租约丢失期间key被其它实例占用
+		wantWorkID  int
+		wantChanged []int
+	}{
+		{
+			// key过期后重新占用原来的workID
+			name:       "test_01",
+			wantWorkID: 0,
+		},
+		{
+			name:        "test_02",
+			other:       true,
+			wantWorkID:  1,
+			wantChanged: []int{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				worker := NewRedisWorker("qw-scrm", pool).(*redisWorker)
+				c := worker.Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				g := snowflake.NewSnowflakeGenerator(c)
+				if _, err := g.GenIntID(); err != nil {
+					t.Fatalf("GenIntID() error = %v", err)
+				}
+				var changed []int
+				c.OnWorkIDChange(
+					func(workID int) {
+						changed = append(changed, workID)
+					},
+				)
+				var states []workid.LeaseState
+				c.OnLeaseStateChange(
+					func(_ int, state workid.LeaseState) {
+						states = append(states, state)
+					},
+				)
+				epoch := c.Token().Epoch
+				worker.scheduler.conns[c] = struct{}{}
+
+				pool.Del(c.getKey())
+				if tt.other {
+					pool.Set(c.getKey(), "other", time.Minute)
+				}
+				worker.scheduler.tick(context.TODO())
+				waitReacquire(worker.scheduler, c)
+				if !slices.Equal(states, []workid.LeaseState{workid.LeaseLost, workid.LeaseHeld}) {
+					t.Errorf("lease states = %v", states)
+				}
+				if c.id != tt.wantWorkID || !slices.Equal(changed, tt.wantChanged) {
+					t.Errorf("workID = %v, changed %v, want %v, %v", c.id, changed, tt.wantWorkID, tt.wantChanged)
+				}
+				if v, _ := pool.Value(c.getKey()); v != c.owner {
+					t.Errorf("key %v = %v, want %v", c.getKey(), v, c.owner)
+				}
+				if got := c.Token(); got.WorkID != tt.wantWorkID || tt.wantWorkID == 0 && got.Epoch <= epoch {
+					t.Errorf("Token() = %+v, previous epoch %v", got, epoch)
+				}
+				id, err := g.GenIntID()
+				if err != nil {
+					t.Fatalf("GenIntID() error = %v", err)
+				}
+				if got := int(id >> 12 & 0x3ff); got != tt.wantWorkID {
+					t.Errorf("GenIntID() node = %v, want %v", got, tt.wantWorkID)
+				}
+			},
+		)
+	}
+}
+
+func TestScheduler_reacquireCooldown(t *testing.T) {
+	// 重新占用时等待上一个持有者的最后时间戳，不影响其它租约续约
+	pool := redistest.NewPool()
+	worker := NewRedisWorker("qw-scrm", pool, WithReuseCooldown(time.Second), WithTTL(time.Minute)).(*redisWorker)
+	var conns []*redisConn
+	for i := 0; i < 2; i++ {
+		c := worker.Get(context.TODO()).(*redisConn)
+		c.timerOnce.Do(func() {})
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+		worker.scheduler.conns[c] = struct{}{}
+		conns = append(conns, c)
+	}
+	lost, held := conns[0], conns[1]
+	pool.Del(lost.getKey())
+	pool.Set(lost.lastKey(lost.getKey()), strconv.FormatInt(time.Now().Add(time.Millisecond*300).UnixMilli(), 10), time.Minute)
+	pool.Set(held.getKey(), held.owner, time.Second)
+
+	start := time.Now()
+	worker.scheduler.tick(context.TODO())
+	if elapsed := time.Since(start); elapsed >= time.Millisecond*300 {
+		t.Errorf("tick() took %v, want not blocked by reacquire", elapsed)
+	}
+	if ttl := pool.TTL(held.getKey()); ttl <= time.Second {
+		t.Errorf("TTL(%v) = %v, want renewed", held.getKey(), ttl)
+	}
+	waitReacquire(worker.scheduler, lost)
+	if got := lost.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+	if time.Since(start) < time.Millisecond*300 {
+		t.Errorf("reacquire did not wait for previous holder's last timestamp")
+	}
+}
+
+func TestScheduler_run(t *testing.T) {
+	pool := redistest.NewFaultPool(redistest.NewPool())
+	worker := NewRedisWorker("qw-scrm", pool).(*redisWorker)
+	worker.Heartbeat = time.Millisecond * 20
+	var conns []*redisConn
+	for i := 0; i < 2; i++ {
+		c := worker.Get(context.TODO()).(*redisConn)
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+		conns = append(conns, c)
+	}
+	var renews atomic.Int32
+	pool.Inject(
+		redistest.OpEval, redistest.Fault{
+			Match: func(call redistest.Call) bool {
+				if call.Script == batchRenewScript {
+					renews.Add(1)
+				}
+				return false
+			},
+		},
+	)
+	time.Sleep(time.Millisecond * 100)
+	if got := renews.Load(); got == 0 {
+		t.Errorf("batch renew called %v times", got)
+	}
+	for _, c := range conns {
+		if err := c.Release(context.TODO()); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+	}
+	if worker.scheduler.stop != nil {
+		t.Errorf("scheduler still running after all conns released")
+	}
+	n := renews.Load()
+	time.Sleep(time.Millisecond * 60)
+	if got := renews.Load(); got != n {
+		t.Errorf("batch renew called after release: %v, want %v", got, n)
+	}
+}
+
+func TestScheduler_interval(t *testing.T) {
+	worker := NewRedisWorker("qw-scrm", redistest.NewPool(), WithHeartbeat(time.Second*10)).(*redisWorker)
+	for i := 0; i < 100; i++ {
+		got := worker.scheduler.interval()
+		if got > time.Second*10 || got < time.Second*9 {
+			t.Fatalf("interval() = %v, want [9s, 10s]", got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package redisworker
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// claimScript 从起始位置开始查找并占用第一个空闲的workID，没有空闲时返回-1。
+	// 重试时先查找上一次尝试可能已占用的workID：返回当前持有者占用的workID，不再占用新的workID。
+	// KEYS[1] 起始workID key，ARGV[1] key前缀，ARGV[2] workID上限，ARGV[3] 起始workID，ARGV[4] 持有者，ARGV[5] 过期时间(毫秒)，
+	// ARGV[6] 是否为重试(0或1)，之后为当前持有者有意保留、查找时排除的workID
+	claimScript = `local prefix, max, start, owner = ARGV[1], tonumber(ARGV[2]), tonumber(ARGV[3]), ARGV[4]
+if ARGV[6] == '1' then
+	local skipped = {}
+	for i = 7, #ARGV do
+		skipped[tonumber(ARGV[i])] = true
+	end
+	for n = 0, max - 1 do
+		if not skipped[n] and redis.call('GET', prefix .. n) == owner then
+			return n
+		end
+	end
+end
+for i = 0, max - 1 do
+	local n = (start + i) % max
+	if redis.call('SET', prefix .. n, owner, 'PX', ARGV[5], 'NX') then
+		return n
+	end
+end
+return -1`
+
+	// stickyScript 占用指定的workID，key不存在、已属于当前持有者或持有者等于指定的持有者时设置为当前持有者，否则返回0。
+	// 已属于当前持有者时视为占用成功，重试不会因为上一次尝试已占用而放弃该workID
+	// KEYS[1] workID key，ARGV[1] 持有者，ARGV[2] 过期时间(毫秒)，ARGV[3] 允许接管的持有者，为空时只占用空闲的workID
+	stickyScript = `local v = redis.call('GET', KEYS[1])
+if v and v ~= ARGV[1] and v ~= ARGV[3] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1`
+
+	// renewScript 续约，仅当key仍属于当前持有者时设置过期时间并更新元数据，最后时间戳大于已记录的值时更新。
+	// KEYS[1] workID key，KEYS[2] 元数据key，KEYS[3] 最后时间戳key，
+	// ARGV[1] 持有者，ARGV[2] 过期时间(毫秒)，ARGV[3] 元数据，ARGV[4] 最后时间戳，ARGV[5] 最后时间戳保留时间(毫秒)
+	renewScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[2])
+	if tonumber(ARGV[4]) > tonumber(redis.call('GET', KEYS[3]) or '0') then
+		redis.call('SET', KEYS[3], ARGV[4], 'PX', ARGV[5])
+	end
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+	// batchRenewScript 批量续约，每个租约与 renewScript 相同，返回每个租约的续约结果(0或1)。
+	// KEYS 每个租约依次为 workID key、元数据key、最后时间戳key，ARGV[1] 最后时间戳保留时间(毫秒)，
+	// 之后每个租约依次为 持有者、过期时间(毫秒)、元数据、最后时间戳
+	batchRenewScript = `local result = {}
+for i = 1, #KEYS / 3 do
+	local key, meta, last = KEYS[i * 3 - 2], KEYS[i * 3 - 1], KEYS[i * 3]
+	local owner, ttl, data, ts = ARGV[i * 4 - 2], ARGV[i * 4 - 1], ARGV[i * 4], ARGV[i * 4 + 1]
+	result[i] = 0
+	if redis.call('GET', key) == owner then
+		redis.call('SET', meta, data, 'PX', ttl)
+		if tonumber(ts) > tonumber(redis.call('GET', last) or '0') then
+			redis.call('SET', last, ts, 'PX', ARGV[1])
+		end
+		result[i] = redis.call('PEXPIRE', key, ttl)
+	end
+end
+return result`
+
+	// releaseScript 释放，仅当key仍属于当前持有者时删除key与元数据，最后时间戳大于已记录的值时更新，释放后保留。
+	// KEYS[1] workID key，KEYS[2] 元数据key，KEYS[3] 最后时间戳key，ARGV[1] 持有者，ARGV[2] 最后时间戳，ARGV[3] 最后时间戳保留时间(毫秒)
+	releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	if tonumber(ARGV[2]) > tonumber(redis.call('GET', KEYS[3]) or '0') then
+		redis.call('SET', KEYS[3], ARGV[2], 'PX', ARGV[3])
+	end
+	redis.call('DEL', KEYS[2])
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+	// epochScript 递增纪元，仅当key仍属于当前持有者时生效，递增后小于ARGV[2]时设置为ARGV[2]，返回新的纪元，不属于当前持有者时返回0。
+	// 纪元key不过期，workID释放后保留。KEYS[1] workID key，KEYS[2] 纪元key，ARGV[1] 持有者，ARGV[2] 最小纪元
+	epochScript = `if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local epoch = redis.call('INCR', KEYS[2])
+if epoch < tonumber(ARGV[2]) then
+	redis.call('SET', KEYS[2], ARGV[2])
+	return tonumber(ARGV[2])
+end
+return epoch`
+
+	// reserveScript 预留空闲的workID，key不过期。KEYS[1] workID key，ARGV[1] 预留标记
+	reserveScript = `if redis.call('SET', KEYS[1], ARGV[1], 'NX') then
+	return 1
+end
+return 0`
+
+	// unreserveScript 取消预留，仅当key是预留标记时删除。KEYS[1] workID key，ARGV[1] 预留标记前缀
+	unreserveScript = `local v = redis.call('GET', KEYS[1])
+if v and string.sub(v, 1, #ARGV[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+	// forceReleaseScript 强制释放，不校验持有者，删除key与元数据，返回删除的workID key数量。KEYS[1] workID key，KEYS[2] 元数据key
+	forceReleaseScript = `redis.call('DEL', KEYS[2])
+return redis.call('DEL', KEYS[1])`
+
+	// listScript 列出所有被占用的workID，依次返回 workID、持有者、剩余过期时间(毫秒)、元数据(不存在时为空字符串)。
+	// KEYS[1] 第一个workID key，ARGV[1] key前缀，ARGV[2] workID上限，ARGV[3] 元数据key前缀，ARGV[4] 元数据key后缀
+	listScript = `local prefix, max = ARGV[1], tonumber(ARGV[2])
+local result = {}
+for n = 0, max - 1 do
+	local owner = redis.call('GET', prefix .. n)
+	if owner then
+		local meta = redis.call('GET', ARGV[3] .. n .. ARGV[4]) or ''
+		table.insert(result, n)
+		table.insert(result, owner)
+		table.insert(result, redis.call('PTTL', prefix .. n))
+		table.insert(result, meta)
+	end
+end
+return result`
+)
+
+// toString 转换脚本返回的字符串结果，redigo返回[]byte
+func toString(result interface{}) (string, error) {
+	switch v := result.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", errors.Errorf("unexpected script result %T(%v)", result, result)
+	}
+}
+
+// toInt64 转换脚本返回的整数结果
+func toInt64(result interface{}) (int64, error) {
+	switch v := result.(type) {
+	case int64:
+		return v, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, errors.Errorf("unexpected script result %T(%v)", result, result)
+	}
+}
@@ -0,0 +1,66 @@
+package redisworker
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// preferredWorkID 优先尝试的workID，依次来自本地状态文件、稳定标识。previous为状态文件中记录的上一次运行的持有者
+func (c *redisConn) preferredWorkID() (workID int, previous string, ok bool) {
+	if c.stateFile != "" {
+		if data, err := os.ReadFile(c.stateFile); err == nil {
+			// 第一行为workID，第二行为持有者标识，旧版本的状态文件只有workID
+			lines := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)
+			if n, err := strconv.Atoi(strings.TrimSpace(lines[0])); err == nil && n >= 0 && n < c.max() {
+				if len(lines) > 1 {
+					previous = strings.TrimSpace(lines[1])
+				}
+				return n, previous, true
+			}
+		}
+	}
+	if c.identity == "" {
+		return 0, "", false
+	}
+	return identityWorkID(c.identity, c.max()), "", true
+}
+
+// identityWorkID 由稳定标识推导workID，StatefulSet的pod名使用序号，其它使用哈希值
+func identityWorkID(identity string, max int) int {
+	if i := strings.LastIndexByte(identity, '-'); i >= 0 {
+		if n, err := strconv.Atoi(identity[i+1:]); err == nil && n >= 0 {
+			return n % max
+		}
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(identity))
+	return int(h.Sum32() % uint32(max))
+}
+
+// claimPreferred 占用指定的workID，仍被上一次运行的持有者previous占用时接管，previous为空或由当前进程生成时只占用空闲的workID
+func (c *redisConn) claimPreferred(ctx context.Context, workID int, previous string) (bool, error) {
+	if previous == "" || isLocalOwner(previous) {
+		return c.add(ctx, c.keyOf(workID), c.owner)
+	}
+	success, err := c.eval(ctx, OpClaim, stickyScript, []string{c.keyOf(workID)}, c.owner, c.ttl().Milliseconds(), previous)
+	if isScriptUnusable(err) {
+		// redis禁用脚本时只尝试占用空闲的workID
+		c.log().WarnContext(ctx, "claim preferred workid by script failed", slog.Any("err", err))
+		return c.add(ctx, c.keyOf(workID), c.owner)
+	}
+	return success, err
+}
+
+// saveState 保存workID与持有者标识到本地状态文件
+func (c *redisConn) saveState(ctx context.Context, workID int) {
+	if c.stateFile == "" {
+		return
+	}
+	if err := os.WriteFile(c.stateFile, []byte(strconv.Itoa(workID)+"\n"+c.owner+"\n"), 0o644); err != nil {
+		c.log().WarnContext(ctx, "save workid state file", slog.String("path", c.stateFile), slog.Any("err", err))
+	}
+}
@@ -2,12 +2,16 @@ package redisworker
 
 import (
 	"context"
-	"github.com/gosharedlib/idgenerator/workid"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/lease"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
 	"github.com/pkg/errors"
+	"hash/fnv"
 	"log/slog"
+	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,29 +24,69 @@ const (
 
 // redisWorker workId生成器配置
 type redisWorker struct {
-	AppName   string        // 服务名
-	ModName   string        // 模块名
-	Heartbeat time.Duration // 心跳时间
-	pool      redis.Pool    // redis连接池
+	AppName   string          // 服务名
+	ModName   string          // 模块名
+	Heartbeat time.Duration   // 心跳时间
+	pool      redis.Pool      // redis连接池
+	strategy  ClaimStrategy   // workID查找策略
+	identity  string          // 稳定标识，为空时不根据标识推导workID
+	stateFile string          // 本地状态文件
+	retry     retryPolicies   // 各操作的重试策略
+	breaker   *circuitBreaker // 熔断器，为空时不熔断
+	keyPrefix string          // key前缀
+	maxWorkID int             // workID上限
+	ttl       time.Duration   // key过期时间，为0时为两倍心跳时间再加1秒
+	logger    *slog.Logger    // 日志
+	hashTag   bool            // key使用 hash tag
+	cooldown  time.Duration   // 等待上一个持有者最后时间戳的最长时间
+	unfenced  bool            // redis禁用脚本时允许以纪元0使用workID
+	scheduler *scheduler      // 所有连接共用的心跳调度
+	err       error           // 配置错误，获取workID时返回
 }
 
-// NewRedisWorker 获取workID配置
-func NewRedisWorker(appName string, pool redis.Pool) workid.Worker {
-	return &redisWorker{
+// NewRedisWorker 获取workID配置，配置错误时获取workID返回 ErrInvalidOption
+func NewRedisWorker(appName string, pool redis.Pool, opts ...Option) workid.Worker {
+	w := &redisWorker{
 		AppName:   appName,
 		ModName:   defaultModName,
 		Heartbeat: defaultTTL,
 		pool:      pool,
+		keyPrefix: workIDKey,
+		maxWorkID: maxWorkID,
+		logger:    slog.Default(),
+		cooldown:  defaultCooldown,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.err = w.validate()
+	w.scheduler = newScheduler(w)
+	return w
 }
 
-func (c *redisWorker) Get(_ context.Context) workid.Conn {
+// Get 获取一个租约，调用 Acquire 后才占用workID
+func (c *redisWorker) Get(_ context.Context) workid.Lease {
 	return &redisConn{
-		appName:   c.AppName,
-		modName:   c.ModName,
-		timeout:   c.Heartbeat,
-		pool:      c.pool,
-		timerOnce: new(sync.Once),
+		appName:     c.AppName,
+		modName:     c.ModName,
+		timeout:     c.Heartbeat,
+		pool:        c.pool,
+		strategy:    c.strategy,
+		identity:    c.identity,
+		stateFile:   c.stateFile,
+		retry:       c.retry,
+		breaker:     c.breaker,
+		prefix:      c.keyPrefix,
+		maxID:       c.maxWorkID,
+		leaseTTL:    c.ttl,
+		logger:      c.logger,
+		hashTag:     c.hashTag,
+		maxCooldown: c.cooldown,
+		unfenced:    c.unfenced,
+		scheduler:   c.scheduler,
+		err:         c.err,
+		owner:       newOwner(c.identity),
+		timerOnce:   new(sync.Once),
 	}
 }
 
@@ -62,128 +106,634 @@ func (c *redisWorker) SetModName(modName string) {
 	c.ModName = modName
 }
 
-// SetHeartbeat 设置心跳时间，如果小于1s，用默认心跳时间
+// SetHeartbeat 设置心跳时间，如果小于1s，用默认心跳时间。也可以通过 WithHeartbeat 设置。
+// 与 WithHeartbeat 相同重新校验配置，心跳时间不小于key过期时间时之后获取的租约返回 ErrInvalidOption
 func (c *redisWorker) SetHeartbeat(heartbeat time.Duration) *redisWorker {
 	if heartbeat < time.Second {
 		return c
 	}
 	c.Heartbeat = heartbeat
+	c.err = c.validate()
 	return c
 }
 
 // redisConn workID生成器配置
 type redisConn struct {
-	id        int           // id
-	appName   string        // 服务名
-	modName   string        // 模块名
-	timeout   time.Duration // key过期时间
-	pool      redis.Pool    // redis连接池
-	timerOnce *sync.Once
+	id          int             // 当前占用的workID，心跳协程重新占用时会修改，通过 currentID 读取
+	appName     string          // 服务名
+	modName     string          // 模块名
+	timeout     time.Duration   // key过期时间
+	pool        redis.Pool      // redis连接池
+	strategy    ClaimStrategy   // workID查找策略
+	identity    string          // 稳定标识
+	stateFile   string          // 本地状态文件
+	retry       retryPolicies   // 各操作的重试策略
+	breaker     *circuitBreaker // 熔断器，为空时不熔断
+	prefix      string          // key前缀，为空时为 workIDKey
+	maxID       int             // workID上限，为0时为 maxWorkID
+	leaseTTL    time.Duration   // key过期时间，为0时为两倍心跳时间再加1秒
+	logger      *slog.Logger    // 为空时使用 slog.Default
+	hashTag     bool            // key使用 hash tag
+	maxCooldown time.Duration   // 等待上一个持有者最后时间戳的最长时间，为0时不等待
+	unfenced    bool            // redis禁用脚本时允许以纪元0使用workID
+	scheduler   *scheduler      // 心跳调度，为空时单独启动心跳协程
+	err         error           // 配置错误
+	owner       string          // 持有者标识，作为key的值
+	started     time.Time       // 占用workID的时间，写入元数据
+	lastTS      atomic.Int64    // 已生成ID的最大时间戳(Unix毫秒)
+	timerOnce   *sync.Once
+	acquireMu   sync.Mutex    // 串行占用，并发 Acquire 时只占用一个workID
+	lease       lease.Tracker // 租约状态
+	mu          sync.Mutex    // 保护 id、started、closed、token、scheduled、onChange、stop、done
+	closed      bool          // 已释放
+	token       workid.Token  // 租约凭证
+	scheduled   bool          // 已加入心跳调度
+	onChange    []func(workID int)
+	stop        chan struct{} // 关闭后心跳协程退出
+	done        chan struct{} // 心跳协程退出后关闭
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *redisConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 占用workID，已占用时返回持有的workID，不会重复占用。
+// 租约丢失后由心跳重新占用，期间返回原来的workID与 workid.ErrLeaseLost，实现 workid.Lease
+func (c *redisConn) Acquire(ctx context.Context) (workID int, err error) {
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.isClosed() {
+		return 0, workid.ErrConnClosed
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	if held, ok, err := c.lease.Acquired(); ok {
+		return held, err
+	}
+	// 清理后重新占用时再次记录
+	rememberOwner(c.owner)
+	start := time.Now()
+	workID, err = c.claimCooled(ctx)
+	if err != nil {
+		return
+	}
+	if err = c.activate(ctx, workID, start); err != nil {
+		return 0, err
+	}
+	c.lease.Held(workID, start, c.ttl())
+	c.writeMeta(ctx)
+	c.startTimer(ctx)
+	return
+}
+
+// activate 占用成功后递增纪元并切换到该workID，递增失败时释放workID，
+// 只有设置了 WithUnfencedFallback 且redis禁用脚本时以纪元0继续使用
+func (c *redisConn) activate(ctx context.Context, workID int, start time.Time) error {
+	epoch, err := c.incrEpoch(ctx, workID, 0)
+	if c.unfenced && isScriptingUnavailable(err) {
+		c.log().WarnContext(ctx, "increase workid epoch, fallback to unfenced lease", slog.Int("workID", workID), slog.Any("err", err))
+		epoch, err = 0, nil
+	}
+	if err != nil {
+		if _, e := c.releaseKey(ctx, c.keyOf(workID), 0); e != nil {
+			c.log().WarnContext(ctx, "release workid", slog.Int("workID", workID), slog.Any("err", e))
+		}
+		return err
+	}
+	c.setID(workID, start)
+	c.setToken(workid.Token{WorkID: workID, Epoch: epoch, Owner: c.owner, AcquiredAt: start})
+	return nil
+}
+
+// writeMeta 写入元数据的同时续约，占用后可能等待过上一个持有者的最后时间戳
+func (c *redisConn) writeMeta(ctx context.Context) {
+	start := time.Now()
+	if ok, err := c.expire(ctx, c.getKey(), c.ttl()); err != nil {
+		// 元数据只用于查看，写入失败不影响使用
+		c.log().WarnContext(ctx, "write workid lease meta", slog.Int("workID", c.currentID()), slog.Any("err", err))
+	} else if ok {
+		c.lease.Held(c.currentID(), start, c.ttl())
+	}
+}
+
+// reacquire 租约丢失后重新占用workID：优先占用原来的workID，被其它实例占用时才占用新的workID。
+// workID变化时在租约恢复为持有之前通知生成器
+func (c *redisConn) reacquire(ctx context.Context) error {
+	start := time.Now()
+	previous := c.currentID()
+	workID, err := c.reclaim(ctx)
+	if err != nil {
+		return err
+	}
+	if workID < 0 {
+		if workID, err = c.claimCooled(ctx); err != nil {
+			return err
+		}
+	}
+	if err := c.activate(ctx, workID, start); err != nil {
+		return err
+	}
+	if c.isClosed() {
+		// 重新占用期间已释放，Release 没有删除新占用的key
+		c.setToken(workid.Token{})
+		if _, err := c.releaseKey(ctx, c.keyOf(workID), 0); err != nil {
+			c.log().WarnContext(ctx, "release workid", slog.Int("workID", workID), slog.Any("err", err))
+		}
+		return errors.WithStack(workid.ErrConnClosed)
+	}
+	if workID != previous {
+		c.log().WarnContext(ctx, "workid changed after lease lost", slog.Int("previous", previous), slog.Int("workID", workID))
+		c.mu.Lock()
+		listeners := append([]func(workID int){}, c.onChange...)
+		c.mu.Unlock()
+		for _, fn := range listeners {
+			fn(workID)
+		}
+	} else {
+		c.log().InfoContext(ctx, "workid reclaimed after lease lost", slog.Int("workID", workID))
+	}
+	c.lease.Reacquire(workID, start, c.ttl())
+	c.writeMeta(ctx)
+	return nil
+}
+
+// reclaim 重新占用原来的workID，key不存在或仍属于当前持有者时占用。被其它实例占用或需要等待上一个持有者太久时返回-1
+func (c *redisConn) reclaim(ctx context.Context) (int, error) {
+	workID := c.currentID()
+	key := c.keyOf(workID)
+	ok, err := c.eval(ctx, OpClaim, stickyScript, []string{key}, c.owner, c.ttl().Milliseconds(), c.owner)
+	if isScriptUnusable(err) {
+		// redis禁用脚本时只尝试占用空闲的workID
+		ok, err = c.add(ctx, key, c.owner)
+	}
+	if err != nil || !ok {
+		return -1, err
+	}
+	ok, err = c.cooldown(
+		ctx, workID, func() (int64, error) {
+			return c.previousTimestamp(ctx, workID)
+		},
+	)
+	if err == nil && ok {
+		return workID, nil
+	}
+	if _, e := c.releaseKey(ctx, key, 0); e != nil {
+		c.log().WarnContext(ctx, "release workid", slog.Int("workID", workID), slog.Any("err", e))
+	}
+	return -1, err
+}
+
+// claimCooled 占用workID并等待上一个持有者的最后时间戳，需要等待太久的workID暂时保留不释放，继续占用其它workID，结束后再释放
+func (c *redisConn) claimCooled(ctx context.Context) (workID int, err error) {
+	var skipped []int
+	defer func() {
+		for _, n := range skipped {
+			key := c.keyOf(n)
+			// 没有生成过ID，不更新最后时间戳
+			if _, e := c.releaseKey(ctx, key, 0); e != nil {
+				c.log().WarnContext(ctx, "release skipped workid", slog.Int("workID", n), slog.Any("err", e))
+			}
+		}
+	}()
+	for i := 0; i < c.max(); i++ {
+		// 保留的workID仍被当前持有者占用，不会被再次查找到；优先使用的workID只尝试一次
+		workID, err = c.claim(ctx, skipped)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := c.cooldown(
+			ctx, workID, func() (int64, error) {
+				return c.previousTimestamp(ctx, workID)
+			},
+		)
+		if err != nil {
+			skipped = append(skipped, workID)
+			return 0, err
+		}
+		if ok {
+			return workID, nil
+		}
+		skipped = append(skipped, workID)
+	}
+	return 0, errors.WithStack(workid.ErrNoWorkIDAvailable)
 }
 
-// GetWorkID 获取workID
-func (c *redisConn) GetWorkID(ctx context.Context) (workID int, err error) {
+// claim 查找并占用空闲的workID，skipped为空时优先使用重启前的workID，其次使用脚本一次完成查找，redis禁用脚本时批量查出空闲的workID后逐个尝试。
+// skipped为当前持有者有意保留的workID，脚本重试时不会当作上一次尝试占用的workID返回。
+// 网络错误、超时等直接返回，不再改用其它命令重复占用
+func (c *redisConn) claim(ctx context.Context, skipped []int) (workID int, err error) {
+	defer func() {
+		if err == nil {
+			c.saveState(ctx, workID)
+		}
+	}()
+	if preferred, previous, ok := c.preferredWorkID(); ok && len(skipped) == 0 {
+		success, err := c.claimPreferred(ctx, preferred, previous)
+		if err != nil {
+			return 0, errors.WithMessagef(err, "claim preferred workid %d", preferred)
+		}
+		if success {
+			return preferred, nil
+		}
+	}
+
+	offset := c.claimOffset()
+	workID, err = c.claimByScript(ctx, offset, skipped)
+	if !isScriptUnusable(err) {
+		return workID, err
+	}
+	c.log().WarnContext(ctx, "claim workid by script failed, fallback to scan", slog.Any("err", err))
+
+	free, err := c.freeWorkIDs(ctx, offset)
+	if err != nil && !isPermanentError(err) {
+		return 0, err
+	}
+	if err != nil {
+		// 批量查询失败时逐个尝试所有workID
+		c.log().WarnContext(ctx, "find free workid by pipeline", slog.Any("err", err))
+		free = free[:0]
+		for i := 0; i < c.max(); i++ {
+			free = append(free, (offset+i)%c.max())
+		}
+	}
 	workID, err = createWorkID(
-		maxWorkID, func(n int) (bool, error) {
-			key := workIDKey + c.appName + ":" + c.modName + ":" + strconv.Itoa(n)
-			return c.add(ctx, key, "1")
+		len(free), func(i int) (bool, error) {
+			return c.add(ctx, c.keyOf(free[i]), c.owner)
 		},
 	)
-	c.id = workID
-	c.startTimer(ctx)
-	return
+	if err != nil {
+		return 0, err
+	}
+	return free[workID], nil
 }
 
+// freeWorkIDs 通过批量命令一次查出所有空闲的workID，从offset开始按顺序排列
+func (c *redisConn) freeWorkIDs(ctx context.Context, offset int) ([]int, error) {
+	max := c.max()
+	cmds := make([]redis.Cmd, 0, max)
+	for i := 0; i < max; i++ {
+		cmds = append(cmds, redis.Cmd{"EXISTS", c.keyOf((offset + i) % max)})
+	}
+	replies, err := c.pipeline(ctx, OpClaim, cmds)
+	if err != nil {
+		return nil, err
+	}
+	var free []int
+	for i, reply := range replies {
+		if n, _ := toInt64(reply.Value); n == 0 {
+			free = append(free, (offset+i)%max)
+		}
+	}
+	return free, nil
+}
+
+// claimByScript 通过脚本一次查找并占用空闲的workID，重试时先查找上一次尝试可能已占用的workID，skipped除外
+func (c *redisConn) claimByScript(ctx context.Context, offset int, skipped []int) (int, error) {
+	var (
+		result  interface{}
+		retried int
+	)
+	err := c.do(
+		ctx, OpClaim, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			args := []interface{}{c.keyPrefix(), c.max(), offset, c.owner, c.ttl().Milliseconds(), retried}
+			for _, n := range skipped {
+				args = append(args, n)
+			}
+			retried = 1
+			result, err = conn.Eval(ctx, claimScript, []string{c.keyOf(offset)}, args...)
+			return err
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := toInt64(result)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.WithStack(workid.ErrNoWorkIDAvailable)
+	}
+	return int(n), nil
+}
+
+// claimOffset 按查找策略计算起始workID
+func (c *redisConn) claimOffset() int {
+	switch c.strategy {
+	case ClaimRandom:
+		return rand.Intn(c.max())
+	case ClaimHashed:
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(hostname()))
+		return int(h.Sum32() % uint32(c.max()))
+	default:
+		return 0
+	}
+}
+
+// CleanWorkID 停止心跳并删除workID，仅删除当前持有者的key，key已被删除或被其它实例占用时返回 workid.ErrLeaseNotOwned。
+// 租约回到未持有状态，之后可以通过 Acquire 重新占用
 func (c *redisConn) CleanWorkID(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	defer forgetOwner(c.owner)
+	if c.stopHeartbeat(ctx) {
+		// 重新占用时再启动心跳
+		c.timerOnce = new(sync.Once)
+	}
+	c.lease.Reset()
+	c.setToken(workid.Token{})
 	success, err := c.del(ctx)
 	if err != nil {
 		return err
 	}
-
 	if !success {
-		err = errors.Errorf("del workid[%d] has fail", c.id)
+		return workid.NewLeaseError("clean", c.currentID(), workid.ErrLeaseNotOwned)
 	}
-
 	return nil
 }
 
-// heartbeat 心跳
+// Release 释放workID：停止心跳并删除key，之后再获取workID返回 workid.ErrConnClosed。租约已丢失时不删除key，避免删掉其它实例的workID。
+// ctx结束时不再等待心跳停止，仍在 lease.ReleaseTimeout 内删除key
+func (c *redisConn) Release(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	defer forgetOwner(c.owner)
+
+	c.stopHeartbeat(ctx)
+	state := c.lease.Current()
+	c.lease.Release()
+	c.setToken(workid.Token{})
+	if state != workid.LeaseHeld && state != workid.LeaseAtRisk {
+		return nil
+	}
+	ctx, cancel := lease.CleanupContext(ctx)
+	defer cancel()
+	_, err := c.del(ctx)
+	return err
+}
+
+// stopHeartbeat 移出心跳调度或停止心跳协程，等待进行中的续约与重新占用结束，ctx结束时不再等待。返回心跳是否启动过
+func (c *redisConn) stopHeartbeat(ctx context.Context) bool {
+	c.mu.Lock()
+	stop, done, scheduled := c.stop, c.done, c.scheduled
+	c.stop, c.done, c.scheduled = nil, nil, false
+	c.mu.Unlock()
+
+	if scheduled {
+		if err := c.scheduler.remove(ctx, c); err != nil {
+			c.log().WarnContext(ctx, "wait for heartbeat to stop", slog.Any("err", err))
+		}
+	}
+	if stop != nil {
+		close(stop)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			c.log().WarnContext(ctx, "wait for heartbeat to stop", slog.Any("err", ctx.Err()))
+		}
+	}
+	return scheduled || stop != nil
+}
+
+func (c *redisConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// LeaseState 获取租约状态，超过TTL未续约成功即为丢失
+func (c *redisConn) LeaseState() workid.LeaseState {
+	return c.lease.Current()
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *redisConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	c.lease.Listen(fn)
+}
+
+// OnWorkIDChange 注册workID变化回调，租约丢失后重新占用到不同的workID时调用，实现 workid.WorkIDNotifier
+func (c *redisConn) OnWorkIDChange(fn func(workID int)) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.onChange = append(c.onChange, fn)
+	c.mu.Unlock()
+}
+
+// ID 当前持有的workID，未占用、租约已丢失或已释放时返回false，实现 workid.Lease
+func (c *redisConn) ID() (int, bool) {
+	return c.lease.ID()
+}
+
+// Renew 立即续约一次，不影响心跳调度，实现 workid.Lease
+func (c *redisConn) Renew(ctx context.Context) error {
+	if c.isClosed() {
+		return workid.ErrConnClosed
+	}
+	if err := c.lease.Renewable(); err != nil {
+		return err
+	}
+	return c.renew(ctx)
+}
+
+// heartbeat 单独续约，redis不支持批量续约或未使用心跳调度时使用
 func (c *redisConn) heartbeat(ctx context.Context) {
-	success, err := c.expire(ctx, c.getKey(), c.timeout*2+time.Second)
-	if err != nil || !success {
-		slog.WarnContext(ctx, "heartbeat", slog.Any("success", success), slog.Any("err", err))
+	_ = c.renew(ctx)
+}
+
+// renew 续约一次并变更租约状态，key已不存在或不属于当前持有者时返回 workid.ErrLeaseLost
+func (c *redisConn) renew(ctx context.Context) error {
+	start := time.Now()
+	success, err := c.expire(ctx, c.getKey(), c.ttl())
+	c.renewed(ctx, start, success, err)
+	if err == nil && !success {
+		err = workid.NewLeaseError("renew", c.currentID(), workid.ErrLeaseLost)
+	}
+	return err
+}
+
+// renewed 根据续约结果变更租约状态，start为发起续约前的时间
+func (c *redisConn) renewed(ctx context.Context, start time.Time, success bool, err error) {
+	switch {
+	case err != nil:
+		c.lease.Fail()
+		c.log().WarnContext(ctx, "heartbeat", slog.Int("workID", c.currentID()), slog.Any("state", c.lease.Current()), slog.Any("err", err))
+	case !success:
+		c.lease.Lose()
+		c.log().ErrorContext(ctx, "heartbeat: workid key not exists or owned by others", slog.Int("workID", c.currentID()))
+	default:
+		c.lease.Held(c.currentID(), start, c.ttl())
 	}
 }
 
+// ttl key过期时间，默认为两倍心跳时间再加1秒，允许一次心跳失败
+func (c *redisConn) ttl() time.Duration {
+	if c.leaseTTL > 0 {
+		return c.leaseTTL
+	}
+	return c.timeout*2 + time.Second
+}
+
+// max workID上限
+func (c *redisConn) max() int {
+	if c.maxID > 0 {
+		return c.maxID
+	}
+	return maxWorkID
+}
+
+// log 日志
+func (c *redisConn) log() *slog.Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	return slog.Default()
+}
+
 // add 新增workID
 func (c *redisConn) add(ctx context.Context, key, value string) (bool, error) {
 	var (
-		conn    redis.Conn
 		success bool
-		err     error
+		retried bool
 	)
-	conn, err = c.pool.Get(ctx)
-	if err != nil {
-		err = errors.WithStack(err)
-		return success, err
-	}
-	success, err = conn.SetNX(key, value, c.timeout*2+time.Second)
-	return success, errors.WithStack(err)
+	err := c.do(
+		ctx, OpClaim, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			success, err = conn.SetNX(ctx, key, value, c.ttl())
+			if err != nil || success || !retried {
+				retried = true
+				return err
+			}
+			// 上一次尝试可能已设置成功，key已属于当前持有者时视为占用成功
+			replies, err := conn.Pipeline(ctx, []redis.Cmd{{"GET", key}})
+			if err != nil {
+				return err
+			}
+			if err := replies[0].Err; err != nil {
+				return err
+			}
+			owner, _ := toString(replies[0].Value)
+			success = owner == value
+			return nil
+		},
+	)
+	return success, err
 }
 
-// del 删除workID
+// del 删除workID，仅删除当前持有者的key
 func (c *redisConn) del(ctx context.Context) (bool, error) {
-	var (
-		conn    redis.Conn
-		success bool
-		err     error
+	key := c.getKey()
+	return c.releaseKey(ctx, key, c.lastTS.Load())
+}
+
+// releaseKey 删除当前持有者的key与元数据，last大于已记录的值时更新最后时间戳
+func (c *redisConn) releaseKey(ctx context.Context, key string, last int64) (bool, error) {
+	return c.eval(
+		ctx, OpRelease, releaseScript, []string{key, c.metaKey(key), c.lastKey(key)}, c.owner, last, lastKeyTTL.Milliseconds(),
+	)
+}
+
+// eval 执行返回0或1的脚本
+func (c *redisConn) eval(ctx context.Context, op Operation, script string, keys []string, args ...interface{}) (bool, error) {
+	var result interface{}
+	err := c.do(
+		ctx, op, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			result, err = conn.Eval(ctx, script, keys, args...)
+			return err
+		},
 	)
-	conn, err = c.pool.Get(ctx)
 	if err != nil {
-		err = errors.WithStack(err)
-		return success, err
+		return false, err
 	}
+	n, err := toInt64(result)
+	return n == 1, err
+}
 
-	result, err := conn.Del(c.getKey())
-	return result == 1, errors.WithStack(err)
+// pipeline 一次往返批量执行命令，redis对单条命令返回的错误记录在对应的结果中
+func (c *redisConn) pipeline(ctx context.Context, op Operation, cmds []redis.Cmd) ([]redis.Reply, error) {
+	var replies []redis.Reply
+	err := c.do(
+		ctx, op, func(ctx context.Context, conn redis.ContextConn) (err error) {
+			replies, err = conn.Pipeline(ctx, cmds)
+			return err
+		},
+	)
+	if len(replies) != len(cmds) {
+		return nil, err
+	}
+	return replies, err
+}
+
+// currentID 当前占用的workID
+func (c *redisConn) currentID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// setID 记录占用的workID与占用时间
+func (c *redisConn) setID(workID int, start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id, c.started = workID, start
 }
 
 func (c *redisConn) getKey() string {
-	return workIDKey + c.appName + ":" + c.modName + ":" + strconv.Itoa(c.id)
+	return c.keyOf(c.currentID())
 }
 
-// expire 设置workerID过期时间
+// keyOf workID对应的key
+func (c *redisConn) keyOf(workID int) string {
+	return c.keyPrefix() + strconv.Itoa(workID)
+}
+
+// keyPrefix workID key前缀，使用 hash tag 时为 workid:{app:mod}:，同一应用模块的key位于redis集群的同一个slot
+func (c *redisConn) keyPrefix() string {
+	prefix := c.prefix
+	if prefix == "" {
+		prefix = workIDKey
+	}
+	if c.hashTag {
+		return prefix + "{" + c.appName + ":" + c.modName + "}:"
+	}
+	return prefix + c.appName + ":" + c.modName + ":"
+}
+
+// expire 设置workerID过期时间并更新元数据与最后时间戳，仅当key仍属于当前持有者时生效
 func (c *redisConn) expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
-	var (
-		conn    redis.Conn
-		success bool
-		err     error
+	return c.eval(
+		ctx, OpRenew, renewScript, []string{key, c.metaKey(key), c.lastKey(key)},
+		c.owner, ttl.Milliseconds(), c.meta(), c.lastTS.Load(), lastKeyTTL.Milliseconds(),
 	)
-	conn, err = c.pool.Get(ctx)
-	if err != nil {
-		err = errors.WithStack(err)
-		return success, err
-	}
-	success, err = conn.Expire(key, ttl)
-	return success, errors.WithStack(err)
 }
 
-// startTimer 启动定时器
+// startTimer 加入心跳调度，未使用心跳调度时单独启动定时器，心跳不受调用方ctx取消的影响，通过 Release 停止
 func (c *redisConn) startTimer(ctx context.Context) {
 	c.timerOnce.Do(
 		func() {
-			go func() {
-				defer func() {
-					if r := recover(); r != nil {
-						slog.ErrorContext(ctx, "startTimer panic", slog.Any("panic", r))
-					}
-				}()
-
-				for {
-					time.Sleep(c.timeout)
-					c.heartbeat(ctx)
-				}
-			}()
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			if c.scheduler != nil {
+				c.scheduler.add(ctx, c)
+				c.scheduled = true
+				return
+			}
+			c.stop, c.done = make(chan struct{}), make(chan struct{})
+			go lease.KeepAlive(context.WithoutCancel(ctx), c.timeout, c.stop, c.done, c.heartbeat, &c.lease, c.log())
 		},
 	)
 }
@@ -203,11 +753,12 @@ func createWorkID(times int, f func(n int) (bool, error)) (int, error) {
 		}
 	}
 	if err != nil {
-		err = errors.Wrap(err, "没有可用的workid")
+		// 最后一次尝试出错时无法确定是否还有空闲的workID，返回原始错误
+		err = errors.WithMessage(err, "claim workid")
 		return workID, err
 	}
 	if !success {
-		err = errors.New("没有可用的workid")
+		err = errors.WithStack(workid.ErrNoWorkIDAvailable)
 		return workID, err
 	}
 
@@ -2,6 +2,9 @@ package redisworker
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"sync"
@@ -10,9 +13,12 @@ import (
 
 	goRedis "github.com/go-redis/redis"
 	rediGo "github.com/gomodule/redigo/redis"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis/goredis"
-	"github.com/gosharedlib/idgenerator/workid/redisworker/redis/redigo"
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/goredis"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redigo"
+	"github.com/gosharedlib/idgenerator/v2/workid/redisworker/redis/redistest"
 )
 
 func TestConfig_GetWorkID(t *testing.T) {
@@ -25,34 +31,7 @@ func TestConfig_GetWorkID(t *testing.T) {
 	type args struct {
 		ctx context.Context
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
-	rediGoPool := redigo.NewPool(
-		&rediGo.Pool{
-			MaxIdle:     1024,
-			MaxActive:   60000,
-			IdleTimeout: time.Minute,
-			Dial: func() (rediGo.Conn, error) {
-				conn, err := rediGo.Dial(
-					"tcp", "192.168.0.128:6379",
-					rediGo.DialConnectTimeout(time.Millisecond*200),
-					rediGo.DialReadTimeout(time.Millisecond*500),
-					rediGo.DialWriteTimeout(time.Millisecond*500),
-					rediGo.DialPassword("yourpassword"),
-					rediGo.DialDatabase(0),
-				)
-				if err != nil {
-					return nil, err
-				}
-				return conn, nil
-			},
-		},
-	)
+	pool := redistest.NewPool()
 	tests := []struct {
 		name    string
 		fields  fields
@@ -77,7 +56,7 @@ func TestConfig_GetWorkID(t *testing.T) {
 			fields: fields{
 				AppName:   "qw-scrm",
 				ModName:   "company",
-				pool:      rediGoPool,
+				pool:      pool,
 				Heartbeat: time.Second * 10,
 			},
 			args: args{
@@ -120,13 +99,7 @@ func TestConfig_heartbeat(t *testing.T) {
 	type args struct {
 		ctx context.Context
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
+	pool := redistest.NewPool()
 	tests := []struct {
 		name    string
 		fields  fields
@@ -240,34 +213,7 @@ func TestConfig_add(t *testing.T) {
 		key   string
 		value string
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
-	rediGoPool := redigo.NewPool(
-		&rediGo.Pool{
-			MaxIdle:     1024,
-			MaxActive:   60000,
-			IdleTimeout: time.Minute,
-			Dial: func() (rediGo.Conn, error) {
-				conn, err := rediGo.Dial(
-					"tcp", "192.168.0.128:6379",
-					rediGo.DialConnectTimeout(time.Millisecond*200),
-					rediGo.DialReadTimeout(time.Millisecond*500),
-					rediGo.DialWriteTimeout(time.Millisecond*500),
-					rediGo.DialPassword("yourpassword"),
-					rediGo.DialDatabase(0),
-				)
-				if err != nil {
-					return nil, err
-				}
-				return conn, nil
-			},
-		},
-	)
+	pool := redistest.NewPool()
 	tests := []struct {
 		name    string
 		fields  fields
@@ -297,7 +243,7 @@ func TestConfig_add(t *testing.T) {
 			fields: fields{
 				AppName:   "qw-scrm",
 				ModName:   "cus",
-				pool:      rediGoPool,
+				pool:      pool,
 				Heartbeat: time.Second * 10,
 				timerOnce: new(sync.Once),
 			},
@@ -347,34 +293,7 @@ func TestConfig_expire(t *testing.T) {
 		key string
 		ttl time.Duration
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
-	rediGoPool := redigo.NewPool(
-		&rediGo.Pool{
-			MaxIdle:     1024,
-			MaxActive:   60000,
-			IdleTimeout: time.Minute,
-			Dial: func() (rediGo.Conn, error) {
-				conn, err := rediGo.Dial(
-					"tcp", "192.168.0.128:6379",
-					rediGo.DialConnectTimeout(time.Millisecond*200),
-					rediGo.DialReadTimeout(time.Millisecond*500),
-					rediGo.DialWriteTimeout(time.Millisecond*500),
-					rediGo.DialPassword("yourpassword"),
-					rediGo.DialDatabase(0),
-				)
-				if err != nil {
-					return nil, err
-				}
-				return conn, nil
-			},
-		},
-	)
+	pool := redistest.NewPool()
 	tests := []struct {
 		name    string
 		fields  fields
@@ -404,7 +323,7 @@ func TestConfig_expire(t *testing.T) {
 			fields: fields{
 				AppName:   "qw-scrm",
 				ModName:   "cus",
-				pool:      rediGoPool,
+				pool:      pool,
 				Heartbeat: time.Second * 10,
 				timerOnce: new(sync.Once),
 			},
@@ -427,7 +346,7 @@ func TestConfig_expire(t *testing.T) {
 					timeout:   tt.fields.Heartbeat,
 					timerOnce: tt.fields.timerOnce,
 				}
-				_, _ = c.add(tt.args.ctx, tt.args.key, "1")
+				_, _ = c.add(tt.args.ctx, tt.args.key, c.owner)
 				got, err := c.expire(tt.args.ctx, tt.args.key, tt.args.ttl)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("sRem() error = %v, wantErr %v", err, tt.wantErr)
@@ -518,8 +437,10 @@ func TestWorker_SetHeartbeat(t *testing.T) {
 	tests := []struct {
 		name          string
 		fields        fields
+		ttl           time.Duration
 		args          args
 		wantHeartbeat time.Duration
+		wantErr       error
 	}{
 		{
 			name: "test_01",
@@ -543,6 +464,20 @@ func TestWorker_SetHeartbeat(t *testing.T) {
 			},
 			wantHeartbeat: defaultTTL,
 		},
+		{
+			// 心跳时间不小于key过期时间
+			name: "test_03",
+			fields: fields{
+				AppName:   "qw-scrm",
+				Heartbeat: time.Second,
+			},
+			ttl: time.Second * 5,
+			args: args{
+				heartbeat: time.Second * 5,
+			},
+			wantHeartbeat: time.Second * 5,
+			wantErr:       ErrInvalidOption,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(
@@ -552,13 +487,25 @@ func TestWorker_SetHeartbeat(t *testing.T) {
 					ModName:   tt.fields.ModName,
 					Heartbeat: tt.fields.Heartbeat,
 					pool:      tt.fields.pool,
+					keyPrefix: workIDKey,
+					maxWorkID: maxWorkID,
+					ttl:       tt.ttl,
 				}
 				if got := c.SetHeartbeat(tt.args.heartbeat); !reflect.DeepEqual(got.Heartbeat, tt.wantHeartbeat) {
 					t.Errorf("SetHeartbeat() = %v, want %v", got, tt.wantHeartbeat)
 				}
+				if !errors.Is(c.err, tt.wantErr) {
+					t.Errorf("SetHeartbeat() err = %v, want %v", c.err, tt.wantErr)
+				}
 			},
 		)
 	}
+	// 之后获取的租约返回配置错误
+	worker := NewRedisWorker("qw-scrm", redistest.NewPool(), WithTTL(time.Second*5)).(*redisWorker)
+	c := worker.SetHeartbeat(time.Second * 10).Get(context.TODO())
+	if _, err := c.Acquire(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Acquire() error = %v, want %v", err, ErrInvalidOption)
+	}
 }
 
 func TestWorker_add(t *testing.T) {
@@ -757,13 +704,7 @@ func TestConfig_GetWorkIDErr(t *testing.T) {
 	type args struct {
 		ctx context.Context
 	}
-	goRedisOpt := &goRedis.Options{
-		Network:  "tcp",
-		Addr:     "192.168.0.128:6379",
-		Password: "yourpassword",
-		DB:       0,
-	}
-	pool := goredis.NewPool(goRedis.NewClient(goRedisOpt))
+	pool := redistest.NewPool()
 	tests := []struct {
 		name    string
 		fields  fields
@@ -813,3 +754,797 @@ func TestConfig_GetWorkIDErr(t *testing.T) {
 		)
 	}
 }
+
+func TestConn_Owner(t *testing.T) {
+	pool := redistest.NewPool()
+	worker := NewRedisWorker("qw-scrm", pool)
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	// key过期后被其它实例占用，原持有者不能续约或删除
+	other := worker.Get(context.TODO()).(*redisConn)
+	other.timerOnce.Do(func() {})
+	pool.Del(c.getKey())
+	if _, err := other.GetWorkID(context.TODO()); err != nil || other.id != c.id {
+		t.Fatalf("GetWorkID() other = %v, err %v", other.id, err)
+	}
+	if got, err := c.expire(context.TODO(), c.getKey(), c.ttl()); err != nil || got {
+		t.Errorf("expire() got = %v, err %v", got, err)
+	}
+	if got, err := c.del(context.TODO()); err != nil || got {
+		t.Errorf("del() got = %v, err %v", got, err)
+	}
+	if got, _ := pool.Value(other.getKey()); got != other.owner {
+		t.Errorf("key %s owner = %v, want %v", other.getKey(), got, other.owner)
+	}
+}
+
+func TestConn_localOwner(t *testing.T) {
+	// 释放或清理后不再记录持有者标识，重新占用时再次记录
+	worker := NewRedisWorker("qw-scrm", redistest.NewPool())
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if !isLocalOwner(c.owner) {
+		t.Errorf("isLocalOwner() = false after Get()")
+	}
+	if _, err := c.Acquire(context.TODO()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if isLocalOwner(c.owner) {
+		t.Errorf("isLocalOwner() = true after CleanWorkID()")
+	}
+	if _, err := c.Acquire(context.TODO()); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if !isLocalOwner(c.owner) {
+		t.Errorf("isLocalOwner() = false after Acquire()")
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if isLocalOwner(c.owner) {
+		t.Errorf("isLocalOwner() = true after Release()")
+	}
+
+	// 多数派租约的各节点使用同一个持有者标识，节点原来生成的标识不再记录
+	_, _, pools := newQuorumPools(3)
+	var before int
+	localOwners.Range(
+		func(_, _ any) bool {
+			before++
+			return true
+		},
+	)
+	q := NewQuorumWorker("qw-scrm", pools).Get(context.TODO()).(*quorumConn)
+	var after int
+	localOwners.Range(
+		func(_, _ any) bool {
+			after++
+			return true
+		},
+	)
+	if after != before+1 {
+		t.Errorf("localOwners grew by %d, want 1", after-before)
+	}
+	if err := q.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if isLocalOwner(q.nodes[0].owner) {
+		t.Errorf("isLocalOwner() = true after quorum Release()")
+	}
+}
+
+func TestConn_LeaseState(t *testing.T) {
+	tests := []struct {
+		name      string
+		expireErr error
+		delete    bool
+		deadline  time.Duration
+		want      workid.LeaseState
+	}{
+		{
+			name: "test_01",
+			want: workid.LeaseHeld,
+		},
+		{
+			name:      "test_02",
+			expireErr: errors.New("i/o timeout"),
+			want:      workid.LeaseAtRisk,
+		},
+		{
+			name:      "test_03",
+			expireErr: errors.New("i/o timeout"),
+			deadline:  -time.Millisecond,
+			want:      workid.LeaseLost,
+		},
+		{
+			name:   "test_04",
+			delete: true,
+			want:   workid.LeaseLost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				faultPool := redistest.NewFaultPool(pool)
+				c := &redisConn{
+					appName:   "qw-scrm",
+					modName:   defaultModName,
+					timeout:   time.Second,
+					pool:      faultPool,
+					timerOnce: new(sync.Once),
+				}
+				var changes []workid.LeaseState
+				c.OnLeaseStateChange(
+					func(_ int, state workid.LeaseState) {
+						changes = append(changes, state)
+					},
+				)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if tt.expireErr != nil {
+					faultPool.FailNext(redistest.OpEval, 1, tt.expireErr)
+				}
+				if tt.delete {
+					pool.Del(c.getKey())
+				}
+				if tt.deadline != 0 {
+					c.lease.Held(c.id, time.Now(), tt.deadline)
+				}
+				c.heartbeat(context.TODO())
+				if got := c.LeaseState(); got != tt.want {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.want)
+				}
+				if got := changes[len(changes)-1]; got != tt.want {
+					t.Errorf("OnLeaseStateChange() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_LeaseStateExpired(t *testing.T) {
+	c := &redisConn{
+		appName:   "qw-scrm",
+		modName:   defaultModName,
+		timeout:   time.Second,
+		pool:      redistest.NewPool(),
+		timerOnce: new(sync.Once),
+	}
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	// 心跳协程停顿超过TTL，不需要等心跳失败即可判定丢失
+	c.lease.Held(c.id, time.Now(), 0)
+	if got := c.LeaseState(); got != workid.LeaseLost {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseLost)
+	}
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseLost {
+		t.Errorf("LeaseState() after heartbeat = %v, want %v", got, workid.LeaseLost)
+	}
+}
+
+func TestConn_Release(t *testing.T) {
+	pool := redistest.NewPool()
+	c := NewRedisWorker("qw-scrm", pool).Get(context.TODO()).(*redisConn)
+	var changes []workid.LeaseState
+	c.OnLeaseStateChange(
+		func(_ int, state workid.LeaseState) {
+			changes = append(changes, state)
+		},
+	)
+	ctx, cancel := context.WithCancel(context.TODO())
+	if _, err := c.GetWorkID(ctx); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	// 调用方ctx取消不影响心跳
+	cancel()
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	// 没有其它连接时心跳调度退出
+	c.scheduler.mu.Lock()
+	if len(c.scheduler.conns) != 0 || c.scheduler.stop != nil {
+		t.Errorf("Release() heartbeat not stopped")
+	}
+	c.scheduler.mu.Unlock()
+	if _, ok := pool.Value(c.getKey()); ok {
+		t.Errorf("Release() key %s not deleted", c.getKey())
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if !reflect.DeepEqual(changes, []workid.LeaseState{workid.LeaseHeld, workid.LeaseNone}) {
+		t.Errorf("OnLeaseStateChange() got = %v", changes)
+	}
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Errorf("Release() again error = %v", err)
+	}
+}
+
+func TestConn_ReleaseTimeout(t *testing.T) {
+	// 等待进行中的心跳超时仍删除key，之后不会再占用
+	mem := redistest.NewPool()
+	pool := redistest.NewFaultPool(mem)
+	worker := NewRedisWorker("qw-scrm", pool, WithHeartbeat(time.Millisecond*10)).(*redisWorker)
+	c := worker.Get(context.TODO()).(*redisConn)
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	pool.Inject(
+		redistest.OpEval, redistest.Fault{
+			Latency: time.Millisecond * 300,
+			Match: func(call redistest.Call) bool {
+				return call.Script == batchRenewScript
+			},
+		},
+	)
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*20)
+	defer cancel()
+	if err := c.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, ok := mem.Value(c.getKey()); ok {
+		t.Errorf("Release() key %s not deleted", c.getKey())
+	}
+	time.Sleep(time.Millisecond * 400)
+	if _, ok := mem.Value(c.getKey()); ok {
+		t.Errorf("key %s claimed again after Release()", c.getKey())
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+}
+
+func TestConn_Acquire(t *testing.T) {
+	pool := redistest.NewPool()
+	worker := NewRedisWorker("qw-scrm", pool)
+	lease := worker.Get(context.TODO())
+	c := lease.(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, ok := lease.ID(); ok {
+		t.Errorf("ID() ok before Acquire")
+	}
+	if err := lease.Renew(context.TODO()); !errors.Is(err, workid.ErrNotAcquired) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrNotAcquired)
+	}
+
+	// 并发重复占用只占用一个workID
+	var wg sync.WaitGroup
+	ids, errs := make([]int, 5), make([]error, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = lease.Acquire(context.TODO())
+		}(i)
+	}
+	wg.Wait()
+	for i := range ids {
+		if ids[i] != 0 || errs[i] != nil {
+			t.Errorf("Acquire() = %v, %v, want 0", ids[i], errs[i])
+		}
+	}
+	// 生成器直接使用租约，不再占用新的workID
+	g := snowflake.NewSnowflakeGenerator(lease)
+	if _, err := g.GenIntID(); err != nil {
+		t.Fatalf("GenIntID() error = %v", err)
+	}
+	if got, err := lease.GetWorkID(context.TODO()); got != 0 || err != nil {
+		t.Errorf("GetWorkID() = %v, %v, want 0", got, err)
+	}
+	if leases, err := worker.List(context.TODO()); err != nil || len(leases) != 1 {
+		t.Errorf("List() = %v, %v, want 1 lease", leases, err)
+	}
+	if got, ok := lease.ID(); got != 0 || !ok {
+		t.Errorf("ID() = %v, %v, want 0, true", got, ok)
+	}
+
+	pool.Set(c.getKey(), c.owner, time.Second)
+	if err := lease.Renew(context.TODO()); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if ttl := pool.TTL(c.getKey()); ttl <= time.Second {
+		t.Errorf("TTL() = %v, want renewed", ttl)
+	}
+	// key被删除后续约判定为丢失，重复占用返回原来的workID与 workid.ErrLeaseLost
+	pool.Del(c.getKey())
+	if err := lease.Renew(context.TODO()); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if _, ok := lease.ID(); ok {
+		t.Errorf("ID() ok after lease lost")
+	}
+	if got, err := lease.Acquire(context.TODO()); got != 0 || !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Acquire() = %v, %v, want 0, %v", got, err, workid.ErrLeaseLost)
+	}
+
+	if err := lease.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := lease.Acquire(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	if err := lease.Renew(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+}
+
+func TestConn_CleanWorkID(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string // 清理前key的值，为空时删除key
+		wantErr error
+	}{
+		{
+			name:  "test_01",
+			value: "self",
+		},
+		{
+			// key被其它实例占用时不删除
+			name:    "test_02",
+			value:   "other",
+			wantErr: workid.ErrLeaseNotOwned,
+		},
+		{
+			name:    "test_03",
+			wantErr: workid.ErrLeaseNotOwned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				c := NewRedisWorker("qw-scrm", pool).Get(context.TODO()).(*redisConn)
+				c.timerOnce.Do(func() {})
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				switch tt.value {
+				case "":
+					pool.Del(c.getKey())
+				case "other":
+					pool.Set(c.getKey(), "other", time.Minute)
+				}
+				err := c.CleanWorkID(context.TODO())
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CleanWorkID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				var leaseErr *workid.LeaseError
+				if err != nil && (!errors.As(err, &leaseErr) || leaseErr.WorkID != c.id) {
+					t.Errorf("CleanWorkID() error = %#v, want LeaseError of workid %v", err, c.id)
+				}
+				if v, ok := pool.Value(c.getKey()); tt.value == "self" && ok || tt.value == "other" && v != "other" {
+					t.Errorf("key %v = %v, %v after clean", c.getKey(), v, ok)
+				}
+				if got := c.LeaseState(); got != workid.LeaseNone {
+					t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_CleanWorkIDScheduled(t *testing.T) {
+	// 清理后停止心跳，其它实例占用同一个workID时不会冲突，也不会被心跳重新占用
+	pool := redistest.NewPool()
+	c := NewRedisWorker("qw-scrm", pool, WithMaxWorkID(1), WithHeartbeat(time.Millisecond*10)).Get(context.TODO()).(*redisConn)
+	g, err := snowflake.NewGenerator(c)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if _, err := g.GenIntID(); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("GenIntID() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+
+	other := NewRedisWorker("qw-scrm", pool, WithMaxWorkID(1), WithHeartbeat(time.Millisecond*10)).Get(context.TODO()).(*redisConn)
+	if got, err := other.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() other = %v, %v, want 0", got, err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	if v, _ := pool.Value(c.keyOf(0)); v != other.owner {
+		t.Errorf("key %v = %v, want %v", c.keyOf(0), v, other.owner)
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if _, err := c.Acquire(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	// 其它实例释放后可以重新占用，心跳重新启动
+	if err := other.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() other error = %v", err)
+	}
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() after clean = %v, %v, want 0", got, err)
+	}
+	defer c.Release(context.TODO())
+	c.mu.Lock()
+	scheduled := c.scheduled
+	c.mu.Unlock()
+	if !scheduled {
+		t.Errorf("heartbeat not restarted after Acquire()")
+	}
+	if _, err := g.GenIntID(); err != nil {
+		t.Errorf("GenIntID() error = %v", err)
+	}
+}
+
+func TestConn_claim(t *testing.T) {
+	tests := []struct {
+		name              string
+		strategy          ClaimStrategy
+		taken             []int
+		scriptingDisabled bool
+		full              bool
+		want              int
+		wantErr           error
+	}{
+		{
+			name:  "test_01",
+			taken: []int{0, 1, 3},
+			want:  2,
+		},
+		{
+			name:              "test_02",
+			taken:             []int{0, 1, 3},
+			want:              2,
+			scriptingDisabled: true,
+		},
+		{
+			name:    "test_03",
+			full:    true,
+			wantErr: workid.ErrNoWorkIDAvailable,
+		},
+		{
+			name:              "test_04",
+			full:              true,
+			wantErr:           workid.ErrNoWorkIDAvailable,
+			scriptingDisabled: true,
+		},
+		{
+			name:     "test_05",
+			strategy: ClaimHashed,
+			want:     -1,
+		},
+		{
+			name:     "test_06",
+			strategy: ClaimRandom,
+			want:     -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var opts []redistest.Option
+				if tt.scriptingDisabled {
+					opts = append(opts, redistest.WithScriptingDisabled())
+				}
+				pool := redistest.NewPool(opts...)
+				c := NewRedisWorker("qw-scrm", pool, WithClaimStrategy(tt.strategy)).Get(context.TODO()).(*redisConn)
+				for _, n := range tt.taken {
+					pool.Set(c.keyOf(n), "other", time.Minute)
+				}
+				for n := 0; tt.full && n < maxWorkID; n++ {
+					pool.Set(c.keyOf(n), "other", time.Minute)
+				}
+				got, err := c.claim(context.TODO(), nil)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("claim() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if err != nil {
+					return
+				}
+				if tt.want >= 0 && got != tt.want {
+					t.Errorf("claim() got = %v, want %v", got, tt.want)
+				}
+				if owner, _ := pool.Value(c.keyOf(got)); owner != c.owner {
+					t.Errorf("claim() key %s owner = %v, want %v", c.keyOf(got), owner, c.owner)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_claimScriptError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantSetNX bool
+		wantErr   bool
+	}{
+		{
+			// 超时时脚本可能已在服务端执行成功，直接返回错误
+			name:    "test_01",
+			err:     context.DeadlineExceeded,
+			wantErr: true,
+		},
+		{
+			name:    "test_02",
+			err:     errors.New("READONLY You can't write against a read only replica."),
+			wantErr: true,
+		},
+		{
+			// 禁用脚本时批量查出空闲的workID后逐个尝试占用
+			name:      "test_03",
+			err:       errors.New("NOSCRIPT No matching script."),
+			wantSetNX: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewFaultPool(redistest.NewPool())
+				c := NewRedisWorker("qw-scrm", pool).Get(context.TODO()).(*redisConn)
+				pool.Inject(
+					redistest.OpEval, redistest.Fault{
+						Err: tt.err,
+						Match: func(call redistest.Call) bool {
+							return call.Script == claimScript
+						},
+					},
+				)
+				_, err := c.claim(context.TODO(), nil)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("claim() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if got := pool.Calls(redistest.OpSetNX) > 0; got != tt.wantSetNX {
+					t.Errorf("SetNX called = %v, want %v", got, tt.wantSetNX)
+				}
+			},
+		)
+	}
+}
+
+func Test_identityWorkID(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		want     int
+	}{
+		{
+			name:     "test_01",
+			identity: "qw-scrm-3",
+			want:     3,
+		},
+		{
+			name:     "test_02",
+			identity: "qw-scrm-1027",
+			want:     3,
+		},
+		{
+			name:     "test_03",
+			identity: "qw-scrm",
+			want:     identityWorkID("qw-scrm", maxWorkID),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := identityWorkID(tt.identity, maxWorkID); got != tt.want || got < 0 || got >= maxWorkID {
+					t.Errorf("identityWorkID() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_claimSticky(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity string
+		state    string
+		holder   string
+		want     int
+	}{
+		{
+			name:     "test_01",
+			identity: "qw-scrm-5",
+			want:     5,
+		},
+		{
+			// 只接管状态文件中记录的上一次运行的持有者
+			name:     "test_02",
+			identity: "qw-scrm-5",
+			state:    "5\nqw-scrm-5:1:dead\n",
+			holder:   "qw-scrm-5:1:dead",
+			want:     5,
+		},
+		{
+			name:     "test_03",
+			identity: "qw-scrm-5",
+			holder:   "qw-scrm-6:1:alive",
+			want:     0,
+		},
+		{
+			name:   "test_04",
+			state:  "5",
+			holder: "",
+			want:   5,
+		},
+		{
+			name:   "test_05",
+			state:  "5",
+			holder: "host:1:alive",
+			want:   0,
+		},
+		{
+			name:     "test_06",
+			identity: "qw-scrm-7",
+			state:    "5\nqw-scrm-7:1:dead",
+			holder:   "qw-scrm-7:1:dead",
+			want:     5,
+		},
+		{
+			// 相同标识的其它持有者仍然存活，不接管
+			name:     "test_07",
+			identity: "qw-scrm-5",
+			holder:   "qw-scrm-5:1:alive",
+			want:     0,
+		},
+		{
+			name:     "test_08",
+			identity: "qw-scrm-5",
+			state:    "5\nqw-scrm-5:1:dead",
+			holder:   "qw-scrm-5:1:alive",
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				pool := redistest.NewPool()
+				path := filepath.Join(t.TempDir(), "workid")
+				opts := []Option{WithStateFile(path)}
+				if tt.identity != "" {
+					opts = append(opts, WithStickyIdentity(tt.identity))
+				}
+				if tt.state != "" {
+					if err := os.WriteFile(path, []byte(tt.state), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				c := NewRedisWorker("qw-scrm", pool, opts...).Get(context.TODO()).(*redisConn)
+				if tt.holder != "" {
+					pool.Set(c.keyOf(5), tt.holder, time.Minute)
+				}
+				got, err := c.claim(context.TODO(), nil)
+				if err != nil {
+					t.Fatalf("claim() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("claim() got = %v, want %v", got, tt.want)
+				}
+				if data, _ := os.ReadFile(path); string(data) != strconv.Itoa(got)+"\n"+c.owner+"\n" {
+					t.Errorf("claim() state file = %s, want %v", data, got)
+				}
+			},
+		)
+	}
+}
+
+func TestConn_claimStickySameProcess(t *testing.T) {
+	// 同一进程的多个租约使用相同的稳定标识和状态文件，不会互相接管
+	pool := redistest.NewPool()
+	path := filepath.Join(t.TempDir(), "workid")
+	worker := NewRedisWorker("qw-scrm", pool, WithStickyIdentity("pod-3"), WithStateFile(path))
+	seen := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		c := worker.Get(context.TODO()).(*redisConn)
+		c.timerOnce.Do(func() {})
+		workID, err := c.GetWorkID(context.TODO())
+		if err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+		if seen[workID] {
+			t.Errorf("GetWorkID() = %v, already held by another lease", workID)
+		}
+		seen[workID] = true
+		if got := c.LeaseState(); got != workid.LeaseHeld {
+			t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+		}
+	}
+	if !seen[3] {
+		t.Errorf("GetWorkID() = %v, want 3 for the first lease", seen)
+	}
+}
+
+func TestConn_expiredTakeover(t *testing.T) {
+	clock := redistest.NewFakeClock(time.Now())
+	pool := redistest.NewPool(redistest.WithClock(clock))
+	worker := NewRedisWorker("qw-scrm", pool)
+	c := worker.Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	if got := pool.TTL(c.getKey()); got != c.ttl() {
+		t.Errorf("TTL() = %v, want %v", got, c.ttl())
+	}
+
+	// 心跳停顿超过TTL，key过期后被其它实例占用
+	clock.Advance(c.ttl())
+	other := worker.Get(context.TODO()).(*redisConn)
+	other.timerOnce.Do(func() {})
+	if _, err := other.GetWorkID(context.TODO()); err != nil || other.id != c.id {
+		t.Fatalf("GetWorkID() other = %v, err %v", other.id, err)
+	}
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseLost {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseLost)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	if got, _ := pool.Value(other.getKey()); got != other.owner {
+		t.Errorf("key %s owner = %v, want %v", other.getKey(), got, other.owner)
+	}
+}
+
+func TestConn_heartbeatFaults(t *testing.T) {
+	pool := redistest.NewFaultPool(redistest.NewPool())
+	c := NewRedisWorker("qw-scrm", pool).Get(context.TODO()).(*redisConn)
+	c.timerOnce.Do(func() {})
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	isRenew := func(call redistest.Call) bool {
+		return call.Script == renewScript
+	}
+	steps := []struct {
+		fault redistest.Fault
+		want  workid.LeaseState
+	}{
+		{
+			fault: redistest.Fault{Err: redistest.ErrInjected, Times: 2, Match: isRenew},
+			want:  workid.LeaseAtRisk,
+		},
+		{
+			want: workid.LeaseAtRisk,
+		},
+		{
+			want: workid.LeaseHeld,
+		},
+		{
+			// 续约请求没有到达redis，无法确认仍持有workID
+			fault: redistest.Fault{Drop: true, Times: 1, Match: isRenew},
+			want:  workid.LeaseLost,
+		},
+	}
+	for i, step := range steps {
+		if step.fault.Times > 0 {
+			pool.Inject(redistest.OpEval, step.fault)
+		}
+		c.heartbeat(context.TODO())
+		if got := c.LeaseState(); got != step.want {
+			t.Errorf("step %d LeaseState() = %v, want %v", i, got, step.want)
+		}
+	}
+	// 占用、读取最后时间戳、递增纪元、写入元数据各一次，心跳4次
+	if got := pool.Calls(redistest.OpEval); got != 8 {
+		t.Errorf("Calls() = %v, want 8", got)
+	}
+}
@@ -0,0 +1,39 @@
+package workid
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const releaseTimeout = time.Second * 5 // 收到信号后释放workID的超时时间
+
+// ReleaseOnSignal 收到信号后释放conn持有的workID，再取消返回的ctx，默认监听 SIGINT、SIGTERM。
+// 监听信号后进程不会再被这些信号直接终止，调用方应在返回的ctx结束后自行退出；调用返回的cancel可停止监听且不释放workID
+func ReleaseOnSignal(ctx context.Context, conn Conn, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+
+	signalCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer signal.Stop(ch)
+
+		select {
+		case sig := <-ch:
+			releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+			if err := conn.Release(releaseCtx); err != nil {
+				slog.ErrorContext(releaseCtx, "release workid on signal", slog.Any("signal", sig), slog.Any("err", err))
+			}
+			releaseCancel()
+			cancel()
+		case <-signalCtx.Done():
+		}
+	}()
+	return signalCtx, cancel
+}
@@ -0,0 +1,105 @@
+package sqlworker
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Dialect 数据库方言，不同数据库的占位符、当前时间与冲突处理语法不同。
+// 单元测试只在 SQLite 上执行，MySQL 与 PostgreSQL 只校验生成的语句，未经真实数据库测试
+type Dialect int
+
+const (
+	MySQL      Dialect = iota + 1 // MySQL 5.7+，驱动如 github.com/go-sql-driver/mysql
+	PostgreSQL                    // PostgreSQL 9.5+，驱动如 github.com/jackc/pgx/v5/stdlib
+	SQLite                        // SQLite 3.24+，驱动如 modernc.org/sqlite
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case MySQL:
+		return "mysql"
+	case PostgreSQL:
+		return "postgres"
+	case SQLite:
+		return "sqlite"
+	default:
+		return "unknown"
+	}
+}
+
+// now 数据库当前时间的毫秒时间戳，同一条语句内取值相同。所有实例以数据库时钟判断过期，不受各实例本地时钟偏差影响
+func (d Dialect) now() string {
+	switch d {
+	case MySQL:
+		return "CAST(UNIX_TIMESTAMP(NOW(3)) * 1000 AS SIGNED)"
+	case PostgreSQL:
+		return "CAST(EXTRACT(EPOCH FROM NOW()) * 1000 AS BIGINT)"
+	default:
+		return "CAST((JULIANDAY('now') - 2440587.5) * 86400000 AS INTEGER)"
+	}
+}
+
+// insertIgnore 主键冲突时不插入，通过影响行数判断是否插入成功。
+// MySQL 使用 INSERT IGNORE，不使用 ON DUPLICATE KEY UPDATE：开启 clientFoundRows 时后者冲突的行也计为影响1行，会误判为占用成功
+func (d Dialect) insertIgnore(insert string) string {
+	if d == MySQL {
+		return "INSERT IGNORE" + strings.TrimPrefix(insert, "INSERT")
+	}
+	return insert + " ON CONFLICT DO NOTHING"
+}
+
+// rebind 将 ? 占位符替换为方言的占位符，语句中不能出现字符串字面量的 ?
+func (d Dialect) rebind(query string) string {
+	if d != PostgreSQL {
+		return query
+	}
+	var (
+		b strings.Builder
+		n int
+	)
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// DefaultTable 默认租约表名
+const DefaultTable = "workid_lease"
+
+// Migrate 创建租约表，表已存在时不做修改。table为空时使用 DefaultTable。
+// 时间字段为数据库时钟的毫秒时间戳，三种数据库使用相同的表结构
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect, table string) error {
+	if table == "" {
+		table = DefaultTable
+	}
+	if !validTable(table) {
+		return errors.Wrapf(ErrInvalidOption, "invalid table name %q", table)
+	}
+	if dialect < MySQL || dialect > SQLite {
+		return errors.Wrapf(ErrInvalidOption, "unsupported dialect %d", dialect)
+	}
+	_, err := db.ExecContext(
+		ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+	app_name     VARCHAR(64)  NOT NULL,
+	mod_name     VARCHAR(64)  NOT NULL,
+	slot         INT          NOT NULL,
+	owner        VARCHAR(128) NOT NULL,
+	meta         VARCHAR(512) NOT NULL DEFAULT '',
+	started_at   BIGINT       NOT NULL,
+	heartbeat_at BIGINT       NOT NULL,
+	expires_at   BIGINT       NOT NULL,
+	PRIMARY KEY (app_name, mod_name, slot)
+)`,
+	)
+	return errors.WithStack(err)
+}
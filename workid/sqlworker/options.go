@@ -0,0 +1,79 @@
+package sqlworker
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidOption 配置错误
+var ErrInvalidOption = errors.New("sqlworker配置错误")
+
+// Option NewSQLWorker 可选配置
+type Option func(w *sqlWorker)
+
+// WithTable 设置租约表名，默认 workid_lease，可以带库名如 infra.workid_lease
+func WithTable(table string) Option {
+	return func(w *sqlWorker) {
+		w.table = table
+	}
+}
+
+// WithMaxWorkID 设置workID上限，workID取值为[0, max)，默认1024。不能超过雪花算法节点位数允许的范围
+func WithMaxWorkID(max int) Option {
+	return func(w *sqlWorker) {
+		w.maxWorkID = max
+	}
+}
+
+// WithTTL 设置租约过期时间，默认30s
+func WithTTL(ttl time.Duration) Option {
+	return func(w *sqlWorker) {
+		w.ttl = ttl
+	}
+}
+
+// WithHeartbeat 设置续约间隔，必须小于过期时间，默认为过期时间的1/3
+func WithHeartbeat(heartbeat time.Duration) Option {
+	return func(w *sqlWorker) {
+		w.heartbeat = heartbeat
+	}
+}
+
+// WithLogger 设置日志，默认使用 slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *sqlWorker) {
+		if logger != nil {
+			w.logger = logger
+		}
+	}
+}
+
+// tablePattern 表名只能是标识符，表名拼接在语句中，不能包含其它字符
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func validTable(table string) bool {
+	return tablePattern.MatchString(table)
+}
+
+// validate 校验配置
+func (w *sqlWorker) validate() error {
+	switch {
+	case w.db == nil:
+		return errors.Wrap(ErrInvalidOption, "db is nil")
+	case w.dialect < MySQL || w.dialect > SQLite:
+		return errors.Wrapf(ErrInvalidOption, "unsupported dialect %d", w.dialect)
+	case !validTable(w.table):
+		return errors.Wrapf(ErrInvalidOption, "invalid table name %q", w.table)
+	case w.maxWorkID < 1 || w.maxWorkID-1 > snowflake.MaxNodeID():
+		return errors.Wrapf(ErrInvalidOption, "max workid %d out of range [1, %d]", w.maxWorkID, snowflake.MaxNodeID()+1)
+	case w.ttl < time.Millisecond:
+		return errors.Wrapf(ErrInvalidOption, "ttl %s must be at least 1ms", w.ttl)
+	case w.heartbeat <= 0 || w.heartbeat >= w.ttl:
+		return errors.Wrapf(ErrInvalidOption, "heartbeat %s must be positive and less than ttl %s", w.heartbeat, w.ttl)
+	}
+	return nil
+}
@@ -0,0 +1,450 @@
+// Package sqlworker 基于关系数据库租约表的workID分配：每个workID一行(slot, owner, expires_at)，
+// 通过条件INSERT/UPDATE占用空闲或已过期的workID，定时续约，续约时行已不属于当前持有者则判定为丢失。
+// 独立的go module，数据库驱动由使用方引入
+package sqlworker
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/gosharedlib/idgenerator/v2/workid/lease"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxWorkID      = 1024             // 机器码上限
+	defaultModName = "default_mod"    // 默认模块名
+	defaultTTL     = time.Second * 30 // 默认租约过期时间
+)
+
+// sqlWorker workID生成器配置
+type sqlWorker struct {
+	appName   string
+	modName   string
+	db        *sql.DB
+	dialect   Dialect
+	table     string        // 租约表名
+	maxWorkID int           // workID上限
+	ttl       time.Duration // 租约过期时间
+	heartbeat time.Duration // 续约间隔
+	logger    *slog.Logger
+	err       error // 配置错误，获取workID时返回
+}
+
+// NewSQLWorker 获取workID配置，db的驱动需要与dialect一致，租约表需要提前通过 Migrate 创建。
+// 配置错误时获取workID返回 ErrInvalidOption
+func NewSQLWorker(appName string, db *sql.DB, dialect Dialect, opts ...Option) workid.Worker {
+	w := &sqlWorker{
+		appName:   appName,
+		modName:   defaultModName,
+		db:        db,
+		dialect:   dialect,
+		table:     DefaultTable,
+		maxWorkID: maxWorkID,
+		ttl:       defaultTTL,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.heartbeat == 0 {
+		w.heartbeat = w.ttl / 3
+	}
+	w.err = w.validate()
+	return w
+}
+
+// Get 获取一个租约，调用 Acquire 后才占用workID
+func (w *sqlWorker) Get(_ context.Context) workid.Lease {
+	return &sqlConn{
+		worker:    w,
+		appName:   w.appName,
+		modName:   w.modName,
+		owner:     newOwner(),
+		timerOnce: new(sync.Once),
+	}
+}
+
+// SetAppName 设置应用名
+func (w *sqlWorker) SetAppName(appName string) {
+	if appName == "" {
+		return
+	}
+	w.appName = appName
+}
+
+// SetModName 设置模块名。如果一个服务里面多个业务需要各自的workId，则必须单独设置，否则不需要设置。默认值： default_mod
+func (w *sqlWorker) SetModName(modName string) {
+	if modName == "" {
+		return
+	}
+	w.modName = modName
+}
+
+// exec 执行语句并返回影响行数
+func (w *sqlWorker) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := w.db.ExecContext(ctx, w.dialect.rebind(query), args...)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	n, err := result.RowsAffected()
+	return n, errors.WithStack(err)
+}
+
+// List 列出当前应用模块所有未过期的租约，按workID排序
+func (w *sqlWorker) List(ctx context.Context) ([]workid.LeaseInfo, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	now := w.dialect.now()
+	rows, err := w.db.QueryContext(
+		ctx, w.dialect.rebind(
+			`SELECT slot, owner, meta, started_at, heartbeat_at, expires_at - `+now+` FROM `+w.table+
+				` WHERE app_name = ? AND mod_name = ? AND expires_at > `+now+` ORDER BY slot`,
+		), w.appName, w.modName,
+	)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var leases []workid.LeaseInfo
+	for rows.Next() {
+		var (
+			info                      workid.LeaseInfo
+			meta                      string
+			started, heartbeat, ttlMS int64
+		)
+		if err := rows.Scan(&info.WorkID, &info.Owner, &meta, &started, &heartbeat, &ttlMS); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var m leaseMeta
+		if err := json.Unmarshal([]byte(meta), &m); err == nil {
+			info.Hostname, info.PID, info.Version = m.Hostname, m.PID, m.Version
+		}
+		info.StartedAt, info.LastHeartbeat = time.UnixMilli(started), time.UnixMilli(heartbeat)
+		info.TTL = time.Duration(ttlMS) * time.Millisecond
+		leases = append(leases, info)
+	}
+	return leases, errors.WithStack(rows.Err())
+}
+
+// leaseMeta 租约元数据，只用于查看
+type leaseMeta struct {
+	Hostname string `json:"hostname"`
+	PID      int    `json:"pid"`
+	Version  string `json:"version"`
+}
+
+// sqlConn workID连接
+type sqlConn struct {
+	id        int
+	worker    *sqlWorker
+	appName   string
+	modName   string
+	owner     string // 持有者标识
+	timerOnce *sync.Once
+	acquireMu sync.Mutex    // 串行占用，并发 Acquire 时只占用一个workID
+	lease     lease.Tracker // 租约状态
+	mu        sync.Mutex    // 保护 closed、stop、done
+	closed    bool          // 已释放
+	stop      chan struct{} // 关闭后心跳协程退出
+	done      chan struct{} // 心跳协程退出后关闭
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *sqlConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 占用workID：依次插入空闲的workID或接管已过期的workID。
+// 已占用时返回持有的workID，不会重复占用，租约已丢失时同时返回 workid.ErrLeaseLost，实现 workid.Lease
+func (c *sqlConn) Acquire(ctx context.Context) (int, error) {
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.isClosed() {
+		return 0, workid.ErrConnClosed
+	}
+	w := c.worker
+	if w.err != nil {
+		return 0, w.err
+	}
+	if workID, ok, err := c.lease.Acquired(); ok {
+		return workID, err
+	}
+	start := time.Now()
+	workID, err := c.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	c.id = workID
+	c.lease.Held(workID, start, w.ttl)
+	c.startTimer(ctx)
+	return workID, nil
+}
+
+// claim 查找并占用空闲或已过期的workID。并发占用同一个workID时，条件INSERT/UPDATE只有一个实例成功
+func (c *sqlConn) claim(ctx context.Context) (int, error) {
+	w := c.worker
+	now := w.dialect.now()
+	rows, err := w.db.QueryContext(
+		ctx, w.dialect.rebind(
+			`SELECT slot, CASE WHEN expires_at <= `+now+` THEN 1 ELSE 0 END FROM `+w.table+
+				` WHERE app_name = ? AND mod_name = ?`,
+		), c.appName, c.modName,
+	)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	expired := make(map[int]bool)
+	for rows.Next() {
+		var (
+			slot int
+			flag int
+		)
+		if err := rows.Scan(&slot, &flag); err != nil {
+			_ = rows.Close()
+			return 0, errors.WithStack(err)
+		}
+		expired[slot] = flag == 1
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	data, _ := json.Marshal(leaseMeta{Hostname: hostname(), PID: os.Getpid(), Version: workid.Version})
+	meta, ttl := string(data), w.ttl.Milliseconds()
+	for n := 0; n < w.maxWorkID; n++ {
+		var affected int64
+		isExpired, exists := expired[n]
+		switch {
+		case !exists:
+			affected, err = w.exec(
+				ctx, w.dialect.insertIgnore(
+					`INSERT INTO `+w.table+` (app_name, mod_name, slot, owner, meta, started_at, heartbeat_at, expires_at)`+
+						` VALUES (?, ?, ?, ?, ?, `+now+`, `+now+`, `+now+` + ?)`,
+				), c.appName, c.modName, n, c.owner, meta, ttl,
+			)
+		case isExpired:
+			// 接管已过期的workID，条件中再次判断过期，避免覆盖刚续约成功的持有者
+			affected, err = w.exec(
+				ctx, `UPDATE `+w.table+` SET owner = ?, meta = ?, started_at = `+now+`, heartbeat_at = `+now+`, expires_at = `+now+` + ?`+
+					` WHERE app_name = ? AND mod_name = ? AND slot = ? AND expires_at <= `+now,
+				c.owner, meta, ttl, c.appName, c.modName, n,
+			)
+		default:
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if affected == 1 {
+			return n, nil
+		}
+	}
+	return 0, errors.WithStack(workid.ErrNoWorkIDAvailable)
+}
+
+// ID 当前持有的workID，未占用、租约已丢失或已释放时返回false，实现 workid.Lease
+func (c *sqlConn) ID() (int, bool) {
+	return c.lease.ID()
+}
+
+// Renew 立即续约一次，不影响定时心跳，实现 workid.Lease
+func (c *sqlConn) Renew(ctx context.Context) error {
+	if c.isClosed() {
+		return workid.ErrConnClosed
+	}
+	if c.worker.err != nil {
+		return c.worker.err
+	}
+	if err := c.lease.Renewable(); err != nil {
+		return err
+	}
+	return c.renew(ctx)
+}
+
+// heartbeat 心跳
+func (c *sqlConn) heartbeat(ctx context.Context) {
+	_ = c.renew(ctx)
+}
+
+// renew 续约，行已被删除、被接管或已过期时判定为丢失并返回 workid.ErrLeaseLost
+func (c *sqlConn) renew(ctx context.Context) error {
+	w := c.worker
+	ctx, cancel := context.WithTimeout(ctx, w.heartbeat)
+	defer cancel()
+	start := time.Now()
+	now := w.dialect.now()
+	affected, err := w.exec(
+		ctx, `UPDATE `+w.table+` SET heartbeat_at = `+now+`, expires_at = `+now+` + ?`+
+			` WHERE app_name = ? AND mod_name = ? AND slot = ? AND owner = ? AND expires_at > `+now,
+		w.ttl.Milliseconds(), c.appName, c.modName, c.id, c.owner,
+	)
+	switch {
+	case err != nil:
+		c.lease.Fail()
+		w.logger.WarnContext(ctx, "heartbeat", slog.Int("workID", c.id), slog.Any("state", c.lease.Current()), slog.Any("err", err))
+		return err
+	case affected == 0:
+		c.lease.Lose()
+		w.logger.ErrorContext(ctx, "heartbeat: workid lease expired or owned by others", slog.Int("workID", c.id))
+		return workid.NewLeaseError("renew", c.id, workid.ErrLeaseLost)
+	default:
+		c.lease.Held(c.id, start, w.ttl)
+		return nil
+	}
+}
+
+// startTimer 启动定时器，心跳不受调用方ctx取消的影响，通过 Release 停止
+func (c *sqlConn) startTimer(ctx context.Context) {
+	c.timerOnce.Do(
+		func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.closed {
+				return
+			}
+			c.stop, c.done = make(chan struct{}), make(chan struct{})
+			go lease.KeepAlive(context.WithoutCancel(ctx), c.worker.heartbeat, c.stop, c.done, c.heartbeat, &c.lease, c.worker.logger)
+		},
+	)
+}
+
+// CleanWorkID 停止心跳并删除workID，仅删除当前持有者的行，行已被删除或被接管时返回 workid.ErrLeaseNotOwned。
+// 租约回到未持有状态，之后可以通过 Acquire 重新占用
+func (c *sqlConn) CleanWorkID(ctx context.Context) error {
+	w := c.worker
+	if w.err != nil {
+		return w.err
+	}
+	c.acquireMu.Lock()
+	defer c.acquireMu.Unlock()
+	if c.stopHeartbeat(ctx) {
+		// 重新占用时再启动心跳
+		c.timerOnce = new(sync.Once)
+	}
+	c.lease.Reset()
+	affected, err := w.exec(
+		ctx, `DELETE FROM `+w.table+` WHERE app_name = ? AND mod_name = ? AND slot = ? AND owner = ?`,
+		c.appName, c.modName, c.id, c.owner,
+	)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return workid.NewLeaseError("clean", c.id, workid.ErrLeaseNotOwned)
+	}
+	return nil
+}
+
+// Release 释放workID：停止心跳并删除当前持有者的行，之后再获取workID返回 workid.ErrConnClosed
+func (c *sqlConn) Release(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.stopHeartbeat(ctx)
+	state := c.lease.Current()
+	c.lease.Release()
+	if state != workid.LeaseHeld && state != workid.LeaseAtRisk {
+		return nil
+	}
+	// 条件中包含持有者，租约已被接管时不会删除其它实例的workID
+	ctx, cancel := lease.CleanupContext(ctx)
+	defer cancel()
+	w := c.worker
+	_, err := w.exec(
+		ctx, `DELETE FROM `+w.table+` WHERE app_name = ? AND mod_name = ? AND slot = ? AND owner = ?`,
+		c.appName, c.modName, c.id, c.owner,
+	)
+	return err
+}
+
+// stopHeartbeat 停止心跳协程并等待退出，ctx结束时不再等待，返回心跳是否启动过
+func (c *sqlConn) stopHeartbeat(ctx context.Context) bool {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+	if stop == nil {
+		return false
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.worker.logger.WarnContext(ctx, "wait for heartbeat to stop", slog.Any("err", ctx.Err()))
+	}
+	return true
+}
+
+func (c *sqlConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// LeaseState 获取租约状态，超过TTL未续约成功即为丢失
+func (c *sqlConn) LeaseState() workid.LeaseState {
+	return c.lease.Current()
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *sqlConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	c.lease.Listen(fn)
+}
+
+// Health 租约健康状态，持有中或有风险时从数据库读取剩余过期时间，记录已被删除或接管时为0
+func (c *sqlConn) Health(ctx context.Context) (workid.Health, error) {
+	health := c.lease.Health()
+	if health.State != workid.LeaseHeld && health.State != workid.LeaseAtRisk {
+		return health, nil
+	}
+	w := c.worker
+	var ms int64
+	err := w.db.QueryRowContext(
+		ctx, w.dialect.rebind(
+			`SELECT expires_at - `+w.dialect.now()+` FROM `+w.table+` WHERE app_name = ? AND mod_name = ? AND slot = ? AND owner = ?`,
+		), c.appName, c.modName, c.id, c.owner,
+	).Scan(&ms)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		health.TTL = 0
+	case err != nil:
+		return health, errors.WithStack(err)
+	default:
+		health.TTL = max(time.Duration(ms)*time.Millisecond, 0)
+	}
+	return health, nil
+}
+
+// newOwner 生成持有者标识：主机名:进程号:随机数
+func newOwner() string {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	return hostname() + ":" + strconv.Itoa(os.Getpid()) + ":" + hex.EncodeToString(nonce)
+}
+
+// hostname 主机名，获取失败时为 unknown
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
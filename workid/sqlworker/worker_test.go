@@ -0,0 +1,380 @@
+package sqlworker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	_ "modernc.org/sqlite"
+)
+
+// newDB 新建SQLite数据库并创建租约表
+func newDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "workid.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := Migrate(context.TODO(), db, SQLite, ""); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	// 重复执行不报错
+	if err := Migrate(context.TODO(), db, SQLite, ""); err != nil {
+		t.Fatalf("Migrate() again error = %v", err)
+	}
+	return db
+}
+
+// getConn 获取不启动心跳协程的连接
+func getConn(worker workid.Worker) *sqlConn {
+	c := worker.Get(context.TODO()).(*sqlConn)
+	c.timerOnce.Do(func() {})
+	return c
+}
+
+func TestSQLConn_GetWorkID(t *testing.T) {
+	db := newDB(t)
+	worker := NewSQLWorker("qw-scrm", db, SQLite, WithMaxWorkID(2))
+	var conns []*sqlConn
+	for i := 0; i < 2; i++ {
+		c := getConn(worker)
+		got, err := c.GetWorkID(context.TODO())
+		if err != nil || got != i {
+			t.Fatalf("GetWorkID() = %v, %v, want %v", got, err, i)
+		}
+		conns = append(conns, c)
+	}
+	if _, err := getConn(worker).GetWorkID(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	// 过期的workID可以被接管，原持有者续约时判定为丢失
+	if _, err := db.Exec(`UPDATE workid_lease SET expires_at = 0 WHERE slot = 1`); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	c := getConn(worker)
+	if got, err := c.GetWorkID(context.TODO()); err != nil || got != 1 {
+		t.Errorf("GetWorkID() takeover = %v, %v, want 1", got, err)
+	}
+	conns[1].heartbeat(context.TODO())
+	if got := conns[1].LeaseState(); got != workid.LeaseLost {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseLost)
+	}
+	// 已丢失的租约释放时不删除新持有者的行
+	if err := conns[1].Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	c.heartbeat(context.TODO())
+	if got := c.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+
+	if err := conns[0].Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := conns[0].GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	// 释放后的workID可以被重新占用
+	c = getConn(worker)
+	g := snowflake.NewSnowflakeGenerator(c)
+	if _, err := g.GenIntID(); err != nil || c.id != 0 {
+		t.Errorf("GenIntID() error = %v, workID = %v", err, c.id)
+	}
+}
+
+func TestSQLConn_Acquire(t *testing.T) {
+	db := newDB(t)
+	worker := NewSQLWorker("qw-scrm", db, SQLite, WithMaxWorkID(2))
+	c := getConn(worker)
+	if err := c.Renew(context.TODO()); !errors.Is(err, workid.ErrNotAcquired) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrNotAcquired)
+	}
+	// 重复占用返回持有的workID，不会插入新的行
+	for i := 0; i < 2; i++ {
+		if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+			t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+		}
+	}
+	if leases, err := worker.List(context.TODO()); err != nil || len(leases) != 1 {
+		t.Errorf("List() = %+v, %v, want 1 lease", leases, err)
+	}
+	if err := c.Renew(context.TODO()); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM workid_lease`); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if err := c.Renew(context.TODO()); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if got, err := c.Acquire(context.TODO()); got != 0 || !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("Acquire() = %v, %v, want 0, %v", got, err, workid.ErrLeaseLost)
+	}
+	var leaseErr *workid.LeaseError
+	if err := c.CleanWorkID(context.TODO()); !errors.Is(err, workid.ErrLeaseNotOwned) || !errors.As(err, &leaseErr) || leaseErr.WorkID != 0 {
+		t.Errorf("CleanWorkID() error = %v, want %v", err, workid.ErrLeaseNotOwned)
+	}
+}
+
+func TestSQLConn_CleanWorkID(t *testing.T) {
+	// 清理后停止心跳，其它实例占用同一个workID时不会冲突
+	db := newDB(t)
+	opts := []Option{WithMaxWorkID(1), WithTTL(time.Second * 5), WithHeartbeat(time.Millisecond * 50)}
+	c := NewSQLWorker("qw-scrm", db, SQLite, opts...).Get(context.TODO()).(*sqlConn)
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() = %v, %v, want 0", got, err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Fatalf("CleanWorkID() error = %v", err)
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+
+	other := NewSQLWorker("qw-scrm", db, SQLite, opts...).Get(context.TODO()).(*sqlConn)
+	if got, err := other.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() other = %v, %v, want 0", got, err)
+	}
+	time.Sleep(time.Millisecond * 150)
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if leases, err := other.worker.List(context.TODO()); err != nil || len(leases) != 1 || leases[0].Owner != other.owner {
+		t.Errorf("List() = %+v, %v, want lease of %v", leases, err, other.owner)
+	}
+	if _, err := c.Acquire(context.TODO()); !errors.Is(err, workid.ErrNoWorkIDAvailable) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrNoWorkIDAvailable)
+	}
+
+	// 其它实例释放后可以重新占用，心跳重新启动
+	if err := other.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() other error = %v", err)
+	}
+	if got, err := c.Acquire(context.TODO()); got != 0 || err != nil {
+		t.Fatalf("Acquire() after clean = %v, %v, want 0", got, err)
+	}
+	c.mu.Lock()
+	started := c.stop != nil
+	c.mu.Unlock()
+	if !started {
+		t.Errorf("heartbeat not restarted after Acquire()")
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestSQLConn_heartbeat(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(db *sql.DB)
+		want  workid.LeaseState
+	}{
+		{
+			name: "test_01",
+			want: workid.LeaseHeld,
+		},
+		{
+			// 行被运维删除
+			name: "test_02",
+			setup: func(db *sql.DB) {
+				_, _ = db.Exec(`DELETE FROM workid_lease`)
+			},
+			want: workid.LeaseLost,
+		},
+		{
+			// 被其它实例接管
+			name: "test_03",
+			setup: func(db *sql.DB) {
+				_, _ = db.Exec(`UPDATE workid_lease SET owner = 'other'`)
+			},
+			want: workid.LeaseLost,
+		},
+		{
+			// 数据库不可用时未超过TTL为有风险
+			name: "test_04",
+			setup: func(db *sql.DB) {
+				_ = db.Close()
+			},
+			want: workid.LeaseAtRisk,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				db := newDB(t)
+				c := getConn(NewSQLWorker("qw-scrm", db, SQLite))
+				var changes []workid.LeaseState
+				c.OnLeaseStateChange(
+					func(_ int, state workid.LeaseState) {
+						changes = append(changes, state)
+					},
+				)
+				if _, err := c.GetWorkID(context.TODO()); err != nil {
+					t.Fatalf("GetWorkID() error = %v", err)
+				}
+				if tt.setup != nil {
+					tt.setup(db)
+				}
+				c.heartbeat(context.TODO())
+				if got := c.LeaseState(); got != tt.want {
+					t.Errorf("LeaseState() = %v, want %v", got, tt.want)
+				}
+				if got := changes[len(changes)-1]; got != tt.want {
+					t.Errorf("OnLeaseStateChange() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestSQLConn_Health(t *testing.T) {
+	db := newDB(t)
+	c := getConn(NewSQLWorker("qw-scrm", db, SQLite))
+	if _, err := c.GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	got, err := c.Health(context.TODO())
+	if err != nil || got.State != workid.LeaseHeld || got.TTL <= defaultTTL-time.Second*2 || got.TTL > defaultTTL || got.LastHeartbeat.IsZero() {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+	// 行已被删除时剩余过期时间为0
+	if _, err := db.Exec(`DELETE FROM workid_lease`); err != nil {
+		t.Fatalf("Exec() error = %v", err)
+	}
+	if got, err = c.Health(context.TODO()); err != nil || got.TTL != 0 {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+	_ = c.Release(context.TODO())
+	if got, err = c.Health(context.TODO()); err != nil || got.State != workid.LeaseNone {
+		t.Errorf("Health() after release = %+v, %v", got, err)
+	}
+}
+
+func TestSQLWorker_List(t *testing.T) {
+	db := newDB(t)
+	worker := NewSQLWorker("qw-scrm", db, SQLite, WithTTL(time.Second*10))
+	var conns []*sqlConn
+	for i := 0; i < 3; i++ {
+		c := getConn(worker)
+		if _, err := c.GetWorkID(context.TODO()); err != nil {
+			t.Fatalf("GetWorkID() error = %v", err)
+		}
+		conns = append(conns, c)
+	}
+	_ = conns[1].Release(context.TODO())
+	// 其它模块的租约不列出
+	worker.SetModName("other")
+	if _, err := getConn(worker).GetWorkID(context.TODO()); err != nil {
+		t.Fatalf("GetWorkID() error = %v", err)
+	}
+	worker.SetModName("default_mod")
+
+	leases, err := worker.List(context.TODO())
+	if err != nil || len(leases) != 2 {
+		t.Fatalf("List() = %+v, %v", leases, err)
+	}
+	host, _ := os.Hostname()
+	for i, want := range []int{0, 2} {
+		lease := leases[i]
+		if lease.WorkID != want || lease.Owner != conns[want].owner || lease.Hostname != host || lease.PID != os.Getpid() ||
+			lease.Version != workid.Version || lease.TTL <= time.Second*9 || lease.TTL > time.Second*10 ||
+			time.Since(lease.StartedAt) > time.Minute || time.Since(lease.LastHeartbeat) > time.Minute {
+			t.Errorf("List() lease = %+v", lease)
+		}
+	}
+}
+
+func TestDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		insert  bool
+		want    string
+	}{
+		{
+			name:    "test_01",
+			dialect: PostgreSQL,
+			query:   "UPDATE t SET owner = ? WHERE slot = ? AND owner = ?",
+			want:    "UPDATE t SET owner = $1 WHERE slot = $2 AND owner = $3",
+		},
+		{
+			name:    "test_02",
+			dialect: MySQL,
+			query:   "UPDATE t SET owner = ? WHERE slot = ?",
+			want:    "UPDATE t SET owner = ? WHERE slot = ?",
+		},
+		{
+			name:    "test_03",
+			dialect: MySQL,
+			query:   "INSERT INTO t (slot) VALUES (?)",
+			insert:  true,
+			want:    "INSERT IGNORE INTO t (slot) VALUES (?)",
+		},
+		{
+			name:    "test_04",
+			dialect: PostgreSQL,
+			query:   "INSERT INTO t (slot) VALUES (?)",
+			insert:  true,
+			want:    "INSERT INTO t (slot) VALUES ($1) ON CONFLICT DO NOTHING",
+		},
+		{
+			name:    "test_05",
+			dialect: SQLite,
+			query:   "INSERT INTO t (slot) VALUES (?)",
+			insert:  true,
+			want:    "INSERT INTO t (slot) VALUES (?) ON CONFLICT DO NOTHING",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				query := tt.query
+				if tt.insert {
+					query = tt.dialect.insertIgnore(query)
+				}
+				if got := tt.dialect.rebind(query); got != tt.want {
+					t.Errorf("rebind() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestNewSQLWorker_options(t *testing.T) {
+	db := &sql.DB{}
+	tests := []struct {
+		name    string
+		db      *sql.DB
+		dialect Dialect
+		opts    []Option
+	}{
+		{name: "test_01", dialect: SQLite},
+		{name: "test_02", db: db},
+		{name: "test_03", db: db, dialect: SQLite, opts: []Option{WithTable("workid; DROP TABLE t")}},
+		{name: "test_04", db: db, dialect: SQLite, opts: []Option{WithMaxWorkID(maxWorkID + 1)}},
+		{name: "test_05", db: db, dialect: SQLite, opts: []Option{WithTTL(time.Second), WithHeartbeat(time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				c := NewSQLWorker("qw-scrm", tt.db, tt.dialect, tt.opts...).Get(context.TODO())
+				if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, ErrInvalidOption) {
+					t.Errorf("GetWorkID() error = %v, want %v", err, ErrInvalidOption)
+				}
+			},
+		)
+	}
+	if err := Migrate(context.TODO(), db, MySQL, "infra.workid-lease"); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Migrate() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
@@ -0,0 +1,257 @@
+// Package staticworker 固定workID，从字面量、环境变量或StatefulSet主机名序号解析，
+// 适用于StatefulSet、固定的虚拟机与本地开发，不依赖redis等外部存储，也不需要续约
+package staticworker
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidWorkID workID无法解析或超出雪花算法节点位数允许的范围
+var ErrInvalidWorkID = errors.New("workid无效")
+
+// Source workID来源
+type Source func() (int, error)
+
+// Literal 固定的workID
+func Literal(id int) Source {
+	return func() (int, error) {
+		return id, nil
+	}
+}
+
+// Env 从环境变量读取workID，环境变量不存在或不是整数时返回 ErrInvalidWorkID
+func Env(name string) Source {
+	return func() (int, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return 0, errors.Wrapf(ErrInvalidWorkID, "env %s not set", name)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return 0, errors.Wrapf(ErrInvalidWorkID, "env %s=%q is not an integer", name, value)
+		}
+		return id, nil
+	}
+}
+
+// ordinalPattern StatefulSet的Pod主机名格式为 <statefulset名>-<序号>
+var ordinalPattern = regexp.MustCompile(`-(\d+)$`)
+
+// hostname 获取主机名，测试时替换
+var hostname = os.Hostname
+
+// Ordinal 从主机名解析StatefulSet的Pod序号，如 order-service-3 为3
+func Ordinal() Source {
+	return func() (int, error) {
+		host, err := hostname()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		// 主机名可能是FQDN，只取第一段
+		host = strings.SplitN(host, ".", 2)[0]
+		match := ordinalPattern.FindStringSubmatch(host)
+		if match == nil {
+			return 0, errors.Wrapf(ErrInvalidWorkID, "hostname %q has no statefulset ordinal", host)
+		}
+		id, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, errors.Wrapf(ErrInvalidWorkID, "hostname %q ordinal out of range", host)
+		}
+		return id, nil
+	}
+}
+
+// Option NewConn 可选配置
+type Option func(c *staticConn)
+
+// WithOffset 解析出的workID加上偏移量，多个StatefulSet共用同一个workID空间时用于划分区间
+func WithOffset(offset int) Option {
+	return func(c *staticConn) {
+		c.offset = offset
+	}
+}
+
+// WithModulus 解析出的workID先对modulus取模再加偏移量，0表示不取模
+func WithModulus(modulus int) Option {
+	return func(c *staticConn) {
+		c.modulus = modulus
+	}
+}
+
+// staticConn 固定workID连接
+type staticConn struct {
+	source    Source
+	offset    int
+	modulus   int
+	mu        sync.Mutex // 保护以下字段
+	id        int
+	state     workid.LeaseState
+	heldAt    time.Time // 最近一次获取workID的时间
+	closed    bool
+	listeners []workid.LeaseListener
+}
+
+// NewConn 获取固定workID连接，workID = source()%modulus + offset，取值必须在[0, snowflake.MaxNodeID()]内。
+// 固定workID的唯一性由部署保证，获取成功后租约状态一直为持有
+func NewConn(source Source, opts ...Option) workid.Lease {
+	c := &staticConn{source: source}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetWorkID 获取workID，与 Acquire 相同
+func (c *staticConn) GetWorkID(ctx context.Context) (int, error) {
+	return c.Acquire(ctx)
+}
+
+// Acquire 解析workID，解析成功后重复调用返回已解析的workID，不再重新解析，实现 workid.Lease。
+// 解析不持有锁，解析后在同一把锁内再次检查是否已释放再变更状态，与 Release 并发时不会在释放后变为持有
+func (c *staticConn) Acquire(_ context.Context) (int, error) {
+	if id, ok, err := c.acquired(); ok || err != nil {
+		return id, err
+	}
+	id, err := c.resolve()
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, workid.ErrConnClosed
+	}
+	if c.state == workid.LeaseHeld {
+		// 并发的 Acquire 已解析成功
+		id = c.id
+		c.mu.Unlock()
+		return id, nil
+	}
+	c.id = id
+	c.heldAt = time.Now()
+	c.transit(workid.LeaseHeld)
+	return id, nil
+}
+
+// acquired 已解析时返回workID，已释放时返回 workid.ErrConnClosed
+func (c *staticConn) acquired() (int, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, false, workid.ErrConnClosed
+	}
+	return c.id, c.state == workid.LeaseHeld, nil
+}
+
+// resolve 解析workID并校验范围
+func (c *staticConn) resolve() (int, error) {
+	if c.source == nil {
+		return 0, errors.Wrap(ErrInvalidWorkID, "source is nil")
+	}
+	if c.modulus < 0 {
+		return 0, errors.Wrapf(ErrInvalidWorkID, "modulus %d is negative", c.modulus)
+	}
+	id, err := c.source()
+	if err != nil {
+		return 0, err
+	}
+	if c.modulus > 0 {
+		id %= c.modulus
+	}
+	id += c.offset
+	if id < 0 || id > snowflake.MaxNodeID() {
+		return 0, errors.Wrapf(ErrInvalidWorkID, "workid %d out of range [0, %d]", id, snowflake.MaxNodeID())
+	}
+	return id, nil
+}
+
+// ID 已解析的workID，未解析或已释放时返回false，实现 workid.Lease
+func (c *staticConn) ID() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id, c.state == workid.LeaseHeld
+}
+
+// Renew 固定workID不需要续约，未解析时返回 workid.ErrNotAcquired，实现 workid.Lease
+func (c *staticConn) Renew(_ context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return workid.ErrConnClosed
+	}
+	if c.state != workid.LeaseHeld {
+		return errors.WithStack(workid.ErrNotAcquired)
+	}
+	return nil
+}
+
+// CleanWorkID 固定workID不需要清理
+func (c *staticConn) CleanWorkID(_ context.Context) error {
+	return nil
+}
+
+// LeaseState 获取租约状态，获取workID成功后为持有，释放后为未持有
+func (c *staticConn) LeaseState() workid.LeaseState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// Health 租约健康状态，持有中时不会过期，TTL为-1
+func (c *staticConn) Health(_ context.Context) (workid.Health, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	health := workid.Health{WorkID: c.id, State: c.state, LastHeartbeat: c.heldAt}
+	if c.state == workid.LeaseHeld {
+		health.TTL = -1
+	}
+	return health, nil
+}
+
+// OnLeaseStateChange 注册租约状态变更回调
+func (c *staticConn) OnLeaseStateChange(fn workid.LeaseListener) {
+	if fn == nil {
+		return
+	}
+	c.mu.Lock()
+	c.listeners = append(c.listeners, fn)
+	c.mu.Unlock()
+}
+
+// Release 释放workID，之后再获取workID返回 workid.ErrConnClosed
+func (c *staticConn) Release(_ context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.transit(workid.LeaseNone)
+	return nil
+}
+
+// transit 变更状态并在释放锁后通知回调，调用前必须持有锁
+func (c *staticConn) transit(state workid.LeaseState) {
+	if c.state == state {
+		c.mu.Unlock()
+		return
+	}
+	c.state = state
+	id := c.id
+	listeners := append([]workid.LeaseListener(nil), c.listeners...)
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(id, state)
+	}
+}
@@ -0,0 +1,211 @@
+package staticworker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gosharedlib/idgenerator/v2/snowflake"
+	"github.com/gosharedlib/idgenerator/v2/workid"
+)
+
+func TestStaticConn_GetWorkID(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		hostname string
+		source   Source
+		opts     []Option
+		want     int
+		wantErr  error
+	}{
+		{
+			name:   "test_01",
+			source: Literal(7),
+			want:   7,
+		},
+		{
+			name:   "test_02",
+			env:    " 12 ",
+			source: Env("IDGEN_WORK_ID"),
+			want:   12,
+		},
+		{
+			name:    "test_03",
+			env:     "abc",
+			source:  Env("IDGEN_WORK_ID"),
+			wantErr: ErrInvalidWorkID,
+		},
+		{
+			name:    "test_04",
+			source:  Env("IDGEN_WORK_ID_NOT_SET"),
+			wantErr: ErrInvalidWorkID,
+		},
+		{
+			name:     "test_05",
+			hostname: "order-service-3",
+			source:   Ordinal(),
+			want:     3,
+		},
+		{
+			name:     "test_06",
+			hostname: "order-service-13.order-service.default.svc.cluster.local",
+			source:   Ordinal(),
+			opts:     []Option{WithModulus(10), WithOffset(100)},
+			want:     103,
+		},
+		{
+			name:     "test_07",
+			hostname: "localhost",
+			source:   Ordinal(),
+			wantErr:  ErrInvalidWorkID,
+		},
+		{
+			name:    "test_08",
+			source:  Literal(snowflake.MaxNodeID()),
+			opts:    []Option{WithOffset(1)},
+			wantErr: ErrInvalidWorkID,
+		},
+		{
+			name:    "test_09",
+			source:  Literal(-1),
+			wantErr: ErrInvalidWorkID,
+		},
+		{
+			name:    "test_10",
+			source:  Literal(1),
+			opts:    []Option{WithModulus(-1)},
+			wantErr: ErrInvalidWorkID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if tt.env != "" {
+					t.Setenv("IDGEN_WORK_ID", tt.env)
+				}
+				if tt.hostname != "" {
+					defer func(origin func() (string, error)) { hostname = origin }(hostname)
+					hostname = func() (string, error) { return tt.hostname, nil }
+				}
+				c := NewConn(tt.source, tt.opts...)
+				got, err := c.GetWorkID(context.TODO())
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetWorkID() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					if state := c.LeaseState(); state != workid.LeaseNone {
+						t.Errorf("LeaseState() = %v, want %v", state, workid.LeaseNone)
+					}
+					return
+				}
+				if got != tt.want {
+					t.Errorf("GetWorkID() got = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestStaticConn_Release(t *testing.T) {
+	c := NewConn(Literal(5))
+	var changes []workid.LeaseState
+	c.OnLeaseStateChange(
+		func(workID int, state workid.LeaseState) {
+			if workID != 5 {
+				t.Errorf("OnLeaseStateChange() workID = %v, want 5", workID)
+			}
+			changes = append(changes, state)
+		},
+	)
+	g := snowflake.NewSnowflakeGenerator(c)
+	if _, err := g.GenIntID(); err != nil {
+		t.Fatalf("GenIntID() error = %v", err)
+	}
+	if err := c.CleanWorkID(context.TODO()); err != nil {
+		t.Errorf("CleanWorkID() error = %v", err)
+	}
+	if got := c.LeaseState(); got != workid.LeaseHeld {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseHeld)
+	}
+	if got, err := c.Health(context.TODO()); err != nil || got.WorkID != 5 || got.TTL != -1 || got.LastHeartbeat.IsZero() {
+		t.Errorf("Health() = %+v, %v", got, err)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if got, err := c.Health(context.TODO()); err != nil || got.State != workid.LeaseNone || got.TTL != 0 {
+		t.Errorf("Health() after release = %+v, %v", got, err)
+	}
+	if _, err := g.GenIntID(); !errors.Is(err, workid.ErrLeaseLost) {
+		t.Errorf("GenIntID() error = %v, want %v", err, workid.ErrLeaseLost)
+	}
+	if _, err := c.GetWorkID(context.TODO()); !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("GetWorkID() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	if len(changes) != 2 || changes[0] != workid.LeaseHeld || changes[1] != workid.LeaseNone {
+		t.Errorf("OnLeaseStateChange() changes = %v", changes)
+	}
+}
+
+func TestStaticConn_Acquire(t *testing.T) {
+	var resolved int
+	c := NewConn(
+		func() (int, error) {
+			resolved++
+			return resolved, nil
+		},
+	)
+	if err := c.Renew(context.TODO()); !errors.Is(err, workid.ErrNotAcquired) {
+		t.Errorf("Renew() error = %v, want %v", err, workid.ErrNotAcquired)
+	}
+	// 解析成功后重复占用返回已解析的workID
+	for i := 0; i < 2; i++ {
+		if got, err := c.Acquire(context.TODO()); got != 1 || err != nil {
+			t.Fatalf("Acquire() = %v, %v, want 1", got, err)
+		}
+	}
+	if got, ok := c.ID(); got != 1 || !ok {
+		t.Errorf("ID() = %v, %v, want 1, true", got, ok)
+	}
+	if err := c.Renew(context.TODO()); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, ok := c.ID(); ok {
+		t.Errorf("ID() ok after release")
+	}
+}
+
+func TestStaticConn_AcquireRelease(t *testing.T) {
+	// 解析期间释放，解析完成后不会变为持有
+	resolving, proceed := make(chan struct{}), make(chan struct{})
+	c := NewConn(
+		func() (int, error) {
+			close(resolving)
+			<-proceed
+			return 1, nil
+		},
+	)
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Acquire(context.TODO())
+		done <- err
+	}()
+	<-resolving
+	if err := c.Release(context.TODO()); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	close(proceed)
+	if err := <-done; !errors.Is(err, workid.ErrConnClosed) {
+		t.Errorf("Acquire() error = %v, want %v", err, workid.ErrConnClosed)
+	}
+	if got := c.LeaseState(); got != workid.LeaseNone {
+		t.Errorf("LeaseState() = %v, want %v", got, workid.LeaseNone)
+	}
+	if _, ok := c.ID(); ok {
+		t.Errorf("ID() ok after release")
+	}
+}
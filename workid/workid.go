@@ -1,14 +1,165 @@
 package workid
 
-import "context"
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLeaseLost workID租约已丢失，该workID可能已被其它实例占用，继续使用会产生重复ID
+var ErrLeaseLost = errors.New("workid租约已丢失")
+
+// ErrNoWorkIDAvailable 没有可用的workID，所有workID都已被占用
+var ErrNoWorkIDAvailable = errors.New("没有可用的workid")
+
+// ErrConnClosed 连接已释放，不能再获取workID
+var ErrConnClosed = errors.New("workid连接已释放")
+
+// ErrNotAcquired 租约尚未占用workID
+var ErrNotAcquired = errors.New("workid尚未占用")
+
+// ErrLeaseNotOwned workID已不属于当前持有者，key已被删除或被其它实例占用，清理时不会删除其它实例的workID
+var ErrLeaseNotOwned = errors.New("workid不属于当前持有者")
+
+// LeaseError 某个workID的租约操作失败，Err为 ErrLeaseLost、ErrLeaseNotOwned 等错误。
+// 可以通过 errors.Is 判断原因，通过 errors.As 取得workID
+type LeaseError struct {
+	Op     string // 操作，如 renew、clean
+	WorkID int
+	Err    error
+}
+
+func (e *LeaseError) Error() string {
+	return e.Op + " workid[" + strconv.Itoa(e.WorkID) + "]: " + e.Err.Error()
+}
+
+func (e *LeaseError) Unwrap() error {
+	return e.Err
+}
+
+// NewLeaseError 新建带调用栈的 LeaseError
+func NewLeaseError(op string, workID int, err error) error {
+	return errors.WithStack(&LeaseError{Op: op, WorkID: workID, Err: err})
+}
 
 type Worker interface {
-	Get(ctx context.Context) Conn
-	SetAppName(appName string) // 设置应用名
-	SetModName(modName string) // 设置模块名，如果一个应用不同的模块需要单独的workID
+	Get(ctx context.Context) Lease                 // 获取一个租约，调用 Lease.Acquire 后才占用workID
+	SetAppName(appName string)                     // 设置应用名
+	SetModName(modName string)                     // 设置模块名，如果一个应用不同的模块需要单独的workID
+	List(ctx context.Context) ([]LeaseInfo, error) // 列出当前应用模块所有有效的租约，按workID排序
+}
+
+// Version 库版本，写入租约元数据，便于排查不同版本的实例
+const Version = "2.0.0"
+
+// LeaseInfo 租约信息，用于运维查看workID被哪个实例持有
+type LeaseInfo struct {
+	WorkID        int           `json:"workId"`
+	Owner         string        `json:"owner"`         // 持有者标识
+	Hostname      string        `json:"hostname"`      // 主机名，缺少元数据时为空
+	PID           int           `json:"pid"`           // 进程号，缺少元数据时为0
+	StartedAt     time.Time     `json:"startedAt"`     // 占用时间，缺少元数据时为零值
+	LastHeartbeat time.Time     `json:"lastHeartbeat"` // 最近一次续约时间，缺少元数据时为零值
+	Version       string        `json:"version"`       // 持有者使用的库版本，缺少元数据时为空
+	TTL           time.Duration `json:"ttl"`           // 剩余过期时间
 }
 
 type Conn interface {
-	GetWorkID(ctx context.Context) (int, error) // 获取workID
+	GetWorkID(ctx context.Context) (int, error) // 获取workID，实现 Lease 时与 Lease.Acquire 相同
 	CleanWorkID(ctx context.Context) error      // 清理workID
+	LeaseState() LeaseState                     // 获取租约状态
+	OnLeaseStateChange(fn LeaseListener)        // 注册租约状态变更回调，可用于告警或重启服务
+	Release(ctx context.Context) error          // 释放workID：停止心跳并删除key，之后再获取workID返回 ErrConnClosed
+	Health(ctx context.Context) (Health, error) // 租约健康状态，读取存储中的剩余过期时间失败时返回本地估算的值与错误
+}
+
+// Lease workID租约，生命周期为 Acquire 占用、Renew 续约、Release 释放。
+// 同一个租约最多占用一个workID，重复 Acquire 返回已持有的workID，释放后不能再占用，需要重新 Worker.Get
+type Lease interface {
+	Conn
+	Acquire(ctx context.Context) (int, error) // 占用workID，已占用时直接返回持有的workID，租约已丢失时同时返回 ErrLeaseLost
+	ID() (int, bool)                          // 当前持有的workID，未占用、租约已丢失或已释放时返回false
+	Renew(ctx context.Context) error          // 立即续约一次，不影响定时心跳。未占用时返回 ErrNotAcquired，租约已丢失时返回 ErrLeaseLost
+}
+
+// Health 租约健康状态，用于监控与就绪探针
+type Health struct {
+	WorkID              int           `json:"workId"`
+	State               LeaseState    `json:"state"`
+	TTL                 time.Duration `json:"ttl"`                 // 剩余过期时间，未持有时为0，不会过期时为-1
+	LastHeartbeat       time.Time     `json:"lastHeartbeat"`       // 最近一次续约成功的时间，占用workID也算一次
+	ConsecutiveFailures int           `json:"consecutiveFailures"` // 连续续约失败的次数，续约成功后清零
+}
+
+// TimestampObserver 可选接口，Conn实现该接口时雪花算法生成器在每次生成ID后调用，记录已生成ID的最大时间戳。
+// 实现方在续约与释放时保存该时间戳，下一个占用该workID的实例等待本地时钟超过它之后再使用，避免时钟偏差导致重复ID
+type TimestampObserver interface {
+	ObserveTimestamp(ms int64) // ms为ID中的时间戳(Unix毫秒)
+}
+
+// Token 租约凭证。Epoch为fencing token，同一个workID每次被占用时递增，
+// 存储层记录见过的最大Epoch并拒绝携带更小Epoch的写入，租约丢失后仍在运行的旧持有者就无法覆盖新持有者的数据
+type Token struct {
+	WorkID     int       `json:"workId"`
+	Epoch      int64     `json:"epoch"`      // 纪元，从1开始递增，为0时表示实现方无法提供纪元
+	Owner      string    `json:"owner"`      // 持有者标识
+	AcquiredAt time.Time `json:"acquiredAt"` // 占用时间
+}
+
+// Fencer 可选接口，Conn实现该接口时每次占用workID都会递增该workID的纪元
+type Fencer interface {
+	GetToken(ctx context.Context) (Token, error) // 获取workID并返回租约凭证，与 Conn.GetWorkID 相同，已占用时返回当前的租约凭证
+	Token() Token                                // 当前租约凭证，未持有时为零值
+}
+
+// WorkIDNotifier 可选接口，Conn在租约丢失后重新占用到不同的workID时，在租约恢复为持有之前调用回调。
+// 雪花算法生成器据此切换workID，回调返回之前生成ID仍返回 ErrLeaseLost
+type WorkIDNotifier interface {
+	OnWorkIDChange(fn func(workID int))
+}
+
+// LeaseListener 租约状态变更回调
+type LeaseListener func(workID int, state LeaseState)
+
+// LeaseState workID租约状态
+type LeaseState int32
+
+const (
+	LeaseNone   LeaseState = iota // 未持有或已释放
+	LeaseHeld                     // 持有中，最近一次续约成功
+	LeaseAtRisk                   // 有风险，续约失败但尚未超过TTL
+	LeaseLost                     // 已丢失，超过TTL或key已不存在，支持重新占用的实现占用成功后恢复为持有
+)
+
+func (s LeaseState) String() string {
+	switch s {
+	case LeaseNone:
+		return "none"
+	case LeaseHeld:
+		return "held"
+	case LeaseAtRisk:
+		return "at-risk"
+	case LeaseLost:
+		return "lost"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText 序列化为状态名称
+func (s LeaseState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText 从状态名称解析
+func (s *LeaseState) UnmarshalText(text []byte) error {
+	for _, state := range []LeaseState{LeaseNone, LeaseHeld, LeaseAtRisk, LeaseLost} {
+		if state.String() == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return errors.Errorf("unknown lease state %q", text)
 }
@@ -0,0 +1,20 @@
+package workid
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLeaseError(t *testing.T) {
+	err := NewLeaseError("renew", 3, ErrLeaseLost)
+	if !errors.Is(err, ErrLeaseLost) || errors.Is(err, ErrLeaseNotOwned) {
+		t.Errorf("errors.Is() mismatch for %v", err)
+	}
+	var leaseErr *LeaseError
+	if !errors.As(err, &leaseErr) || leaseErr.Op != "renew" || leaseErr.WorkID != 3 {
+		t.Errorf("errors.As() = %+v", leaseErr)
+	}
+	if got, want := err.Error(), "renew workid[3]: "+ErrLeaseLost.Error(); got != want {
+		t.Errorf("Error() = %v, want %v", got, want)
+	}
+}